@@ -0,0 +1,302 @@
+package starlet
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.starlark.net/starlark"
+)
+
+// auditedCapabilities are the capabilities of the modules whose builtin calls are audited.
+const auditedCapabilities = CapFileSystem | CapNetwork | CapProcess
+
+// AuditEvent describes a call of a builtin from a module touching the filesystem, network or process of the host, see SetAuditSink.
+type AuditEvent struct {
+	Time     time.Time     `json:"time"`               // when the call started
+	Module   string        `json:"module"`             // name of the module, e.g. "file"
+	Function string        `json:"function"`           // name of the builtin in the module, e.g. "read_string"
+	Args     []string      `json:"args"`               // sanitized arguments, keyword ones as "name=value"
+	Outcome  string        `json:"outcome"`            // "ok" or "error"
+	Error    string        `json:"error,omitempty"`    // error returned by the builtin, if any
+	Duration time.Duration `json:"duration"`           // time spent in the builtin, in nanoseconds in JSON
+	Position string        `json:"position,omitempty"` // where the script makes the call, e.g. "main.star:3:1"
+}
+
+// Outcomes of audit events.
+const (
+	AuditOutcomeOK    = "ok"
+	AuditOutcomeError = "error"
+)
+
+// AuditSink receives the audit events of a Machine.
+// It's invoked synchronously after each audited call on the goroutine running the script, while the machine is locked. An error returned by the sink fails the call, so a script cannot go on unaudited.
+type AuditSink interface {
+	Audit(e AuditEvent) error
+}
+
+// SetAuditSink sets the sink receiving an event for every call of the builtins from the modules classified with CapFileSystem, CapNetwork or CapProcess, see ModuleCapability; nil stops auditing.
+//
+// The arguments are sanitized: the values of keywords, dict keys and URL query parameters looking like credentials, e.g. "auth" or "password", are redacted, also within lists, tuples and sets; the passwords in URLs are masked, bytes are summarized by their length, and long values are truncated.
+// It takes effect at once, even for the modules already loaded. Calls stubbed by the dry-run mode or replayed from a trace don't touch the host, so they are not audited.
+func (m *Machine) SetAuditSink(sink AuditSink) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.audit = sink
+}
+
+// auditDict wraps the builtins of the audited modules in the dict.
+// A member is classified by the module it comes from in origin, or by its own name as a module.
+func (m *Machine) auditDict(d starlark.StringDict, origin map[string]string) {
+	reg := m.registry.orDefault()
+	for k, v := range d {
+		module := k
+		if o, ok := origin[k]; ok {
+			module = o
+		}
+		if cap, ok := reg.moduleCapability(module); ok && cap.Intersects(auditedCapabilities) {
+			d[k] = mapBuiltins(k, v, m.auditBuiltin(module))
+		}
+	}
+}
+
+// auditLoader wraps the lazy loader so the builtins of the audited modules are wrapped.
+func (m *Machine) auditLoader(ld NamedModuleLoader) NamedModuleLoader {
+	return func(s string) (starlark.StringDict, error) {
+		d, err := ld(s)
+		if err != nil || d == nil {
+			return d, err
+		}
+		if cap, ok := m.registry.orDefault().moduleCapability(s); !ok || !cap.Intersects(auditedCapabilities) {
+			return d, nil
+		}
+		// copy to keep the dicts owned by the module intact
+		nd := make(starlark.StringDict, len(d))
+		for k, v := range d {
+			nd[k] = mapBuiltins(s+"."+k, v, m.auditBuiltin(s))
+		}
+		return nd, nil
+	}
+}
+
+// auditBuiltin returns a wrapper of the builtins of the given module, which sends an event to the audit sink after each call, if set.
+// The sink is checked on each call, so the builtins are wrapped whether it's set or not.
+func (m *Machine) auditBuiltin(module string) func(name string, b *starlark.Builtin) *starlark.Builtin {
+	return func(name string, b *starlark.Builtin) *starlark.Builtin {
+		fn := strings.TrimPrefix(name, module+".")
+		w := starlark.NewBuiltin(b.Name(), func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			sink := m.audit
+			if sink == nil {
+				return b.CallInternal(thread, args, kwargs)
+			}
+			e := AuditEvent{
+				Time:     time.Now(),
+				Module:   module,
+				Function: fn,
+				Args:     sanitizeArgs(args, kwargs),
+				Outcome:  AuditOutcomeOK,
+			}
+			if thread.CallStackDepth() > 1 {
+				e.Position = thread.CallFrame(1).Pos.String()
+			}
+			res, err := b.CallInternal(thread, args, kwargs)
+			e.Duration = time.Since(e.Time)
+			if err != nil {
+				e.Outcome, e.Error = AuditOutcomeError, err.Error()
+			}
+			if ae := sink.Audit(e); ae != nil {
+				return nil, fmt.Errorf("audit: %w", ae)
+			}
+			return res, err
+		})
+		if recv := b.Receiver(); recv != nil {
+			w = w.BindReceiver(recv)
+		}
+		return w
+	}
+}
+
+// maxAuditArgLen is the number of characters an audited argument is truncated to.
+const maxAuditArgLen = 256
+
+// auditRedacted replaces the values of credentials in audited arguments.
+const auditRedacted = "[REDACTED]"
+
+// sanitizeArgs renders the arguments of a call for an audit event.
+func sanitizeArgs(args starlark.Tuple, kwargs []starlark.Tuple) []string {
+	ss := make([]string, 0, len(args)+len(kwargs))
+	for _, a := range args {
+		ss = append(ss, sanitizeValue(a))
+	}
+	for _, kv := range kwargs {
+		k, _ := starlark.AsString(kv[0])
+		v := auditRedacted
+		if !isSensitiveName(k) {
+			v = sanitizeValue(kv[1])
+		}
+		ss = append(ss, k+"="+v)
+	}
+	return ss
+}
+
+// sanitizeValue renders a value for an audit event, with the credentials in it redacted.
+func sanitizeValue(v starlark.Value) string {
+	s := renderSanitized(v, make(map[starlark.Value]bool))
+	if _, ok := v.(starlark.String); ok {
+		// truncated before quoting
+		return s
+	}
+	return truncateAuditArg(s)
+}
+
+// renderSanitized renders a value with the credentials in it redacted, including the ones in the dicts, lists, tuples and sets in it.
+// The path holds the containers being rendered, a container met again in it is a cycle and rendered like Starlark does.
+func renderSanitized(v starlark.Value, path map[starlark.Value]bool) string {
+	switch t := v.(type) {
+	case starlark.String:
+		return starlark.String(truncateAuditArg(redactURL(string(t)))).String()
+	case starlark.Bytes:
+		return fmt.Sprintf("<%d bytes>", len(t))
+	case *starlark.Dict:
+		if path[t] {
+			return "{...}"
+		}
+		path[t] = true
+		defer delete(path, t)
+
+		parts := make([]string, 0, t.Len())
+		for _, kv := range t.Items() {
+			val := auditRedacted
+			if k, ok := starlark.AsString(kv[0]); !ok || !isSensitiveName(k) {
+				val = renderSanitized(kv[1], path)
+			}
+			parts = append(parts, renderSanitized(kv[0], path)+": "+val)
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case *starlark.List:
+		if path[t] {
+			return "[...]"
+		}
+		path[t] = true
+		defer delete(path, t)
+		return "[" + renderSanitizedItems(t, path) + "]"
+	case starlark.Tuple:
+		if len(t) == 1 {
+			return "(" + renderSanitized(t[0], path) + ",)"
+		}
+		return "(" + renderSanitizedItems(t, path) + ")"
+	case *starlark.Set:
+		return "set([" + renderSanitizedItems(t, path) + "])"
+	}
+	return v.String()
+}
+
+// renderSanitizedItems renders the items of a sequence with the credentials in them redacted, separated by commas.
+func renderSanitizedItems(seq starlark.Iterable, path map[starlark.Value]bool) string {
+	var parts []string
+	iter := seq.Iterate()
+	defer iter.Done()
+	var x starlark.Value
+	for iter.Next(&x) {
+		parts = append(parts, renderSanitized(x, path))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// redactURL masks the password and redacts the query parameters looking like credentials, e.g. "token" or "api_key", if the string is a URL with any of them; other strings are returned as they are.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	q := redactQuery(u.RawQuery)
+	if u.User == nil && q == u.RawQuery {
+		return s
+	}
+	u.RawQuery = q
+	return u.Redacted()
+}
+
+// redactQuery redacts the values of the parameters looking like credentials in the raw query, keeping the others and the order as they are.
+func redactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, p := range params {
+		k, _, found := strings.Cut(p, "=")
+		if !found {
+			continue
+		}
+		if name, err := url.QueryUnescape(k); err == nil && isSensitiveName(name) {
+			params[i] = k + "=" + auditRedacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// truncateAuditArg truncates the string to maxAuditArgLen characters, noting how many are left out.
+func truncateAuditArg(s string) string {
+	n := utf8.RuneCountInString(s)
+	if n <= maxAuditArgLen {
+		return s
+	}
+	return fmt.Sprintf("%s...(%d more)", string([]rune(s)[:maxAuditArgLen]), n-maxAuditArgLen)
+}
+
+// sensitiveNames are the parts of the names of keywords, dict keys and URL query parameters whose values are redacted.
+var sensitiveNames = []string{"auth", "password", "passwd", "secret", "token", "cookie", "api_key", "apikey", "credential"}
+
+// isSensitiveName reports whether the name looks like one of a credential.
+func isSensitiveName(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitiveNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONLinesAuditSink is an AuditSink writing each event as a line of JSON.
+type JSONLinesAuditSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	c   io.Closer
+}
+
+// NewJSONLinesAuditSink creates a JSONLinesAuditSink writing to the given writer.
+func NewJSONLinesAuditSink(w io.Writer) *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{enc: json.NewEncoder(w)}
+}
+
+// OpenJSONLinesAuditSink creates a JSONLinesAuditSink appending to the file at the given path, which is created if not exists. Close it to close the file.
+func OpenJSONLinesAuditSink(path string) (*JSONLinesAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesAuditSink{enc: json.NewEncoder(f), c: f}, nil
+}
+
+// Audit writes the event as a line of JSON.
+func (s *JSONLinesAuditSink) Audit(e AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(e)
+}
+
+// Close closes the underlying file if the sink is opened by OpenJSONLinesAuditSink, it does nothing otherwise.
+func (s *JSONLinesAuditSink) Close() error {
+	if s.c == nil {
+		return nil
+	}
+	return s.c.Close()
+}
@@ -0,0 +1,386 @@
+package starlet
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	itn "github.com/1set/starlet/internal"
+)
+
+// CacheStats is a snapshot of the counters of a bounded ByteCache.
+type CacheStats struct {
+	Hits      uint64 // number of Get calls that found a valid entry
+	Misses    uint64 // number of Get calls that found nothing or a corrupted entry
+	Evictions uint64 // number of entries removed to honour the limits
+	Entries   int    // number of entries currently held
+	Bytes     int64  // total size of the values currently held
+}
+
+// errCacheEntryTooLarge is returned by Set for a value that alone exceeds the size limit of a cache.
+var errCacheEntryTooLarge = errors.New("cache entry exceeds the size limit")
+
+// lruIndex keeps the entries of a bounded cache in the order of recent use, and tells which ones to evict to honour the limits.
+// It's not concurrency-safe, the owning cache guards it with its own lock.
+type lruIndex struct {
+	maxEntries int
+	maxBytes   int64
+	order      *list.List // front is the most recently used
+	items      map[string]*list.Element
+	size       int64
+	stats      CacheStats
+}
+
+type lruItem struct {
+	key  string
+	size int64
+}
+
+func newLRUIndex(maxEntries int, maxBytes int64) *lruIndex {
+	return &lruIndex{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// fits reports whether a value of the given size can be held at all.
+func (x *lruIndex) fits(size int64) bool {
+	return x.maxBytes <= 0 || size <= x.maxBytes
+}
+
+// touch marks the key as the most recently used, and reports whether it exists.
+func (x *lruIndex) touch(key string) bool {
+	el, ok := x.items[key]
+	if ok {
+		x.order.MoveToFront(el)
+	}
+	return ok
+}
+
+// put adds or updates the key as the most recently used, and returns the keys to evict.
+func (x *lruIndex) put(key string, size int64) (evicted []string) {
+	if el, ok := x.items[key]; ok {
+		it := el.Value.(*lruItem)
+		x.size += size - it.size
+		it.size = size
+		x.order.MoveToFront(el)
+	} else {
+		x.items[key] = x.order.PushFront(&lruItem{key: key, size: size})
+		x.size += size
+	}
+	for x.over() {
+		el := x.order.Back()
+		if el == nil || el.Value.(*lruItem).key == key {
+			break
+		}
+		evicted = append(evicted, x.drop(el))
+		x.stats.Evictions++
+	}
+	return evicted
+}
+
+// pushBack adds a key as the least recently used, it's for loading existing entries in the order of their age.
+func (x *lruIndex) pushBack(key string, size int64) {
+	x.items[key] = x.order.PushBack(&lruItem{key: key, size: size})
+	x.size += size
+}
+
+// remove drops the key if it exists.
+func (x *lruIndex) remove(key string) {
+	if el, ok := x.items[key]; ok {
+		x.drop(el)
+	}
+}
+
+func (x *lruIndex) drop(el *list.Element) string {
+	it := x.order.Remove(el).(*lruItem)
+	delete(x.items, it.key)
+	x.size -= it.size
+	return it.key
+}
+
+func (x *lruIndex) over() bool {
+	return (x.maxEntries > 0 && x.order.Len() > x.maxEntries) || (x.maxBytes > 0 && x.size > x.maxBytes)
+}
+
+func (x *lruIndex) snapshot() CacheStats {
+	st := x.stats
+	st.Entries = x.order.Len()
+	st.Bytes = x.size
+	return st
+}
+
+// LRUMemoryCache is an in-memory ByteCache bounded by the number of entries and the total size of values, it evicts the least recently used entries to honour the limits.
+type LRUMemoryCache struct {
+	_     itn.DoNotCompare
+	mu    sync.Mutex
+	data  map[string][]byte
+	index *lruIndex
+}
+
+// NewLRUMemoryCache creates a new LRUMemoryCache holding at most maxEntries entries and maxBytes bytes of values, a non-positive limit means unlimited.
+func NewLRUMemoryCache(maxEntries int, maxBytes int64) *LRUMemoryCache {
+	return &LRUMemoryCache{
+		data:  make(map[string][]byte),
+		index: newLRUIndex(maxEntries, maxBytes),
+	}
+}
+
+// Get returns the value for the given key, and whether the key exists.
+func (c *LRUMemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.index.touch(key) {
+		c.index.stats.Misses++
+		return nil, false
+	}
+	c.index.stats.Hits++
+	return c.data[key], true
+}
+
+// Set sets the value for the given key, and evicts the least recently used entries if the limits are exceeded.
+// It returns an error if the value alone exceeds the size limit.
+func (c *LRUMemoryCache) Set(key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.index.fits(int64(len(value))) {
+		return errCacheEntryTooLarge
+	}
+	c.data[key] = value
+	for _, k := range c.index.put(key, int64(len(value))) {
+		delete(c.data, k)
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the counters of the cache.
+func (c *LRUMemoryCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.index.snapshot()
+}
+
+const (
+	diskCacheMagic   = "SLC1"
+	diskCacheSuffix  = ".slc"
+	diskCacheTemp    = "tmp-"
+	diskCacheHashLen = sha256.Size
+	// diskCacheTempAge is the age of a temporary file after which it's taken as left behind by an interrupted write, a younger one may be being written by another process sharing the directory.
+	diskCacheTempAge = time.Hour
+)
+
+// DiskCache is a directory-backed ByteCache, so compiled programs survive restarts of the process.
+//
+// Each entry is stored in a file named after the hash of the key, along with the key and a checksum of the value; a file is written to a temporary file and renamed into place, so a crash never leaves a partial entry behind.
+// An entry failing the verification is removed and reported as a miss. Like LRUMemoryCache, it evicts the least recently used entries to honour the limits, and the order of use survives restarts via the modification time of the files.
+type DiskCache struct {
+	_     itn.DoNotCompare
+	mu    sync.Mutex
+	dir   string
+	index *lruIndex
+}
+
+// NewDiskCache creates a new DiskCache in the given directory holding at most maxEntries entries and maxBytes bytes of values, a non-positive limit means unlimited.
+// The directory is created if it does not exist, and the existing entries in it are adopted, evicting the oldest ones if the limits are exceeded; the temporary files older than an hour are removed, while the younger ones are kept for the writes in progress of other processes sharing the directory.
+func NewDiskCache(dir string, maxEntries int, maxBytes int64) (*DiskCache, error) {
+	if dir == "" {
+		return nil, errors.New("no cache directory given")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	c := &DiskCache{
+		dir:   dir,
+		index: newLRUIndex(maxEntries, maxBytes),
+	}
+	if err := c.scan(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// scan adopts the existing entries in the directory, from the most to the least recently used.
+func (c *DiskCache) scan() error {
+	des, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	type found struct {
+		name string
+		size int64
+		mod  time.Time
+	}
+	var files []found
+	for _, de := range des {
+		name := de.Name()
+		if de.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(name, diskCacheTemp) {
+			// left behind by an interrupted write, if it's stale
+			if fi, err := de.Info(); err == nil && time.Since(fi.ModTime()) > diskCacheTempAge {
+				_ = os.Remove(filepath.Join(c.dir, name))
+			}
+			continue
+		}
+		if !strings.HasSuffix(name, diskCacheSuffix) {
+			continue
+		}
+		fi, err := de.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, found{name, fi.Size(), fi.ModTime()})
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].mod.After(files[j].mod) })
+	for _, f := range files {
+		c.index.pushBack(f.name, f.size)
+	}
+	for c.index.over() {
+		name := c.index.drop(c.index.order.Back())
+		c.index.stats.Evictions++
+		_ = os.Remove(filepath.Join(c.dir, name))
+	}
+	return nil
+}
+
+// fileName returns the name of the file for the given key.
+func (c *DiskCache) fileName(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:]) + diskCacheSuffix
+}
+
+// Get returns the value for the given key, and whether a valid entry exists.
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	name := c.fileName(key)
+	if !c.index.touch(name) {
+		c.index.stats.Misses++
+		return nil, false
+	}
+	path := filepath.Join(c.dir, name)
+	b, err := os.ReadFile(path)
+	var value []byte
+	if err == nil {
+		value, err = decodeDiskCacheEntry(key, b)
+	}
+	if err != nil {
+		// missing or corrupted: drop it and report a miss
+		c.index.remove(name)
+		_ = os.Remove(path)
+		c.index.stats.Misses++
+		return nil, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	c.index.stats.Hits++
+	return value, true
+}
+
+// Set writes the value for the given key atomically, and evicts the least recently used entries if the limits are exceeded.
+// It returns an error if the value alone exceeds the size limit or the file cannot be written.
+func (c *DiskCache) Set(key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := encodeDiskCacheEntry(key, value)
+	size := int64(len(data))
+	if !c.index.fits(size) {
+		return errCacheEntryTooLarge
+	}
+
+	// write to a temporary file and rename it into place
+	tmp, err := os.CreateTemp(c.dir, diskCacheTemp+"*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if ce := tmp.Close(); err == nil {
+		err = ce
+	}
+	name := c.fileName(key)
+	if err == nil {
+		err = os.Rename(tmpName, filepath.Join(c.dir, name))
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+
+	for _, n := range c.index.put(name, size) {
+		_ = os.Remove(filepath.Join(c.dir, n))
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the counters of the cache, the size counts the files of the entries.
+func (c *DiskCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.index.snapshot()
+}
+
+// encodeDiskCacheEntry lays out an entry as: magic, key length (uint32), key, SHA-256 of the value, value.
+func encodeDiskCacheEntry(key string, value []byte) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, len(diskCacheMagic)+4+len(key)+diskCacheHashLen+len(value)))
+	buf.WriteString(diskCacheMagic)
+	var kl [4]byte
+	binary.BigEndian.PutUint32(kl[:], uint32(len(key)))
+	buf.Write(kl[:])
+	buf.WriteString(key)
+	sum := sha256.Sum256(value)
+	buf.Write(sum[:])
+	buf.Write(value)
+	return buf.Bytes()
+}
+
+// decodeDiskCacheEntry verifies an entry against the key and checksum, and returns the value.
+func decodeDiskCacheEntry(key string, b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, []byte(diskCacheMagic)) {
+		return nil, errors.New("bad magic")
+	}
+	b = b[len(diskCacheMagic):]
+	if len(b) < 4 {
+		return nil, errors.New("truncated entry")
+	}
+	kl := int(binary.BigEndian.Uint32(b))
+	b = b[4:]
+	if len(b) < kl+diskCacheHashLen {
+		return nil, errors.New("truncated entry")
+	}
+	if string(b[:kl]) != key {
+		return nil, errors.New("key mismatch")
+	}
+	b = b[kl:]
+	sum, value := b[:diskCacheHashLen], b[diskCacheHashLen:]
+	if act := sha256.Sum256(value); !bytes.Equal(act[:], sum) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return value, nil
+}
+
+var (
+	_ ByteCache = (*MemoryCache)(nil)
+	_ ByteCache = (*LRUMemoryCache)(nil)
+	_ ByteCache = (*DiskCache)(nil)
+)
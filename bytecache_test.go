@@ -0,0 +1,155 @@
+package starlet_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1set/starlet"
+)
+
+func TestLRUMemoryCache(t *testing.T) {
+	c := starlet.NewLRUMemoryCache(2, 10)
+
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("expected miss on empty cache")
+	}
+	for _, k := range []string{"a", "b"} {
+		if err := c.Set(k, []byte(k+k)); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	// touch a, so b is the least recently used
+	if v, ok := c.Get("a"); !ok || string(v) != "aa" {
+		t.Errorf("expected hit for a, got %q, %v", v, ok)
+	}
+	if err := c.Set("c", []byte("cc")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("expected b to be evicted by count")
+	}
+	// a large value evicts by size
+	if err := c.Set("d", []byte("dddddddd")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("expected a to be evicted by size")
+	}
+	if err := c.Set("e", []byte("eleven bytes")); err == nil {
+		t.Errorf("expected error for an oversized value")
+	}
+
+	st := c.Stats()
+	exp := starlet.CacheStats{Hits: 1, Misses: 3, Evictions: 2, Entries: 2, Bytes: 10}
+	if st != exp {
+		t.Errorf("expected stats %+v, got %+v", exp, st)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	if _, err := starlet.NewDiskCache("", 0, 0); err == nil {
+		t.Errorf("expected error for empty directory")
+	}
+
+	dir := filepath.Join(t.TempDir(), "progs")
+	c, err := starlet.NewDiskCache(dir, 2, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := c.Get("k1"); ok {
+		t.Errorf("expected miss on empty cache")
+	}
+	for _, k := range []string{"k1", "k2"} {
+		if err := c.Set(k, []byte("value of "+k)); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond) // distinct modification times
+	}
+	if v, ok := c.Get("k1"); !ok || string(v) != "value of k1" {
+		t.Errorf("expected hit for k1, got %q, %v", v, ok)
+	}
+
+	// entries survive reopening, and the order of use is kept
+	_ = os.WriteFile(filepath.Join(dir, "tmp-leftover"), []byte("x"), 0o644)
+	stale := time.Now().Add(-2 * time.Hour)
+	_ = os.Chtimes(filepath.Join(dir, "tmp-leftover"), stale, stale)
+	_ = os.WriteFile(filepath.Join(dir, "tmp-writing"), []byte("x"), 0o644)
+	c2, err := starlet.NewDiskCache(dir, 2, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st := c2.Stats(); st.Entries != 2 {
+		t.Errorf("expected 2 adopted entries, got %+v", st)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tmp-leftover")); !os.IsNotExist(err) {
+		t.Errorf("expected leftover temporary file removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tmp-writing")); err != nil {
+		t.Errorf("expected temporary file being written kept, got %v", err)
+	}
+	_ = os.Remove(filepath.Join(dir, "tmp-writing"))
+	if err := c2.Set("k3", []byte("value of k3")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, ok := c2.Get("k2"); ok {
+		t.Errorf("expected k2 evicted as the least recently used")
+	}
+	if v, ok := c2.Get("k1"); !ok || string(v) != "value of k1" {
+		t.Errorf("expected hit for k1, got %q, %v", v, ok)
+	}
+
+	// a corrupted entry is dropped as a miss
+	des, _ := os.ReadDir(dir)
+	for _, de := range des {
+		p := filepath.Join(dir, de.Name())
+		b, _ := os.ReadFile(p)
+		if strings.HasSuffix(string(b), "k3") {
+			b[len(b)-1] = 'X'
+			_ = os.WriteFile(p, b, 0o644)
+		}
+	}
+	if _, ok := c2.Get("k3"); ok {
+		t.Errorf("expected miss for corrupted k3")
+	}
+	st := c2.Stats()
+	if st.Hits != 1 || st.Misses != 2 || st.Evictions != 1 || st.Entries != 1 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+
+	// size limit
+	c3, err := starlet.NewDiskCache(t.TempDir(), 0, 64)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c3.Set("big", make([]byte, 64)); err == nil {
+		t.Errorf("expected error for an oversized value")
+	}
+}
+
+func TestDiskCache_Machine(t *testing.T) {
+	dir := t.TempDir()
+	code := []byte(`x = 6 * 7`)
+	for i := 0; i < 2; i++ {
+		c, err := starlet.NewDiskCache(dir, 0, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		m := starlet.NewDefault()
+		m.SetScriptCache(c)
+		m.SetScript("answer.star", code, nil)
+		res, err := m.Run()
+		if err != nil || res["x"] != int64(42) {
+			t.Errorf("unexpected result: %v, %v", res, err)
+		}
+		st := c.Stats()
+		if i == 0 && (st.Misses != 1 || st.Hits != 0) {
+			t.Errorf("expected a miss on the first process, got %+v", st)
+		}
+		if i == 1 && (st.Misses != 0 || st.Hits != 1) {
+			t.Errorf("expected a hit on the restarted process, got %+v", st)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"go.starlark.net/starlark"
@@ -25,10 +26,15 @@ import (
 type cache struct {
 	cacheMu  sync.Mutex
 	cache    map[string]*entry
+	deps     map[string]map[string]struct{} // module -> modules loading it, see recordDep
 	globals  starlark.StringDict
 	execOpts *syntax.FileOptions
 	loadMod  func(s string) (starlark.StringDict, error) // load from built-in module first
 	readFile func(s string) ([]byte, error)              // and then from file system
+	// resolve, when set, maps a name given to load() by the module with the
+	// given filename to the name of the module to load, which is the key of
+	// the cache and the filename of a module executed from source.
+	resolve func(from, module string) (string, error)
 	// newThread builds the thread that executes a loaded module, carrying the
 	// Machine's execution context (print func, step budget, run context). When
 	// nil the load path falls back to a bare thread — a module loaded that way
@@ -39,6 +45,23 @@ type cache struct {
 	// module executed by load() honours the run timeout instead of running past
 	// it on its own thread. When nil the load thread is not cancelled by context.
 	watchCancel func(thread *starlark.Thread) (stop func())
+	// progCache, when set, caches the compiled programs of the source files
+	// executed by load(), keyed like the main script, so a shared library is
+	// compiled once per process instead of once per Machine.
+	progCache ByteCache
+	// onLoad, when set, observes every module resolution, including the ones
+	// served by this cache, with where the module came from.
+	onLoad func(module string, src LoadSource, start time.Time, err error)
+	// deny is the capability policy of the Machine: a module classified with
+	// any of these capabilities is refused whatever source it would come from.
+	deny ModuleCapability
+	// registry classifies the modules for the policy and tells a withheld
+	// builtin from an unknown name; nil means the default registry.
+	registry *ModuleRegistry
+	// missing, when set, builds the error for a module found nowhere, which
+	// suggests an available name for a misspelled one; when nil the error is
+	// a bare ModuleWithheldError or ModuleNotFoundError.
+	missing func(module string) error
 }
 
 type entry struct {
@@ -46,12 +69,59 @@ type entry struct {
 	globals starlark.StringDict
 	err     error
 	ready   chan struct{}
+	hash    []byte // content hash of the source file, nil if not executed from a file
+}
+
+// loadState carries what doLoad learns about a module back to get: the thread
+// it executes on, and where it came from.
+type loadState struct {
+	thread *starlark.Thread
+	source LoadSource
+	hash   []byte
 }
 
 func (c *cache) Load(module string) (starlark.StringDict, error) {
 	return c.get(new(cycleChecker), module)
 }
 
+// LoadFrom loads the module named by a load statement executing on the thread,
+// resolving the name against the loading module.
+func (c *cache) LoadFrom(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	return c.getFrom(new(cycleChecker), thread, module)
+}
+
+// getFrom resolves the module name against the module loading it on the
+// thread, and then gets it.
+func (c *cache) getFrom(cc *cycleChecker, thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	if c.resolve != nil {
+		name, err := c.resolve(loadingModule(thread), module)
+		if err != nil {
+			return nil, err
+		}
+		module = name
+	}
+	c.recordDep(loadingModule(thread), module)
+	return c.get(cc, module)
+}
+
+// recordDep records that the module with the given filename loads the other
+// one, so the hot reload evicts the dependents of a changed module as well.
+func (c *cache) recordDep(from, module string) {
+	if from == "" {
+		return
+	}
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	if c.deps == nil {
+		c.deps = make(map[string]map[string]struct{})
+	}
+	if c.deps[module] == nil {
+		c.deps[module] = make(map[string]struct{})
+	}
+	c.deps[module][from] = struct{}{}
+}
+
 func (c *cache) remove(module string) {
 	c.cacheMu.Lock()
 	delete(c.cache, module)
@@ -61,11 +131,13 @@ func (c *cache) remove(module string) {
 func (c *cache) reset() {
 	c.cacheMu.Lock()
 	c.cache = make(map[string]*entry)
+	c.deps = nil
 	c.cacheMu.Unlock()
 }
 
 // get loads and returns an entry (if not already loaded).
 func (c *cache) get(cc *cycleChecker, module string) (starlark.StringDict, error) {
+	start := time.Now()
 	c.cacheMu.Lock()
 	e := c.cache[module]
 	if e != nil {
@@ -75,12 +147,14 @@ func (c *cache) get(cc *cycleChecker, module string) (starlark.StringDict, error
 
 		// Detect load cycles to avoid deadlocks.
 		if err := cycleCheck(e, cc); err != nil {
+			c.notifyLoad(module, LoadSourceCache, start, err)
 			return nil, err
 		}
 
 		cc.setWaitsFor(e)
 		<-e.ready
 		cc.setWaitsFor(nil)
+		c.notifyLoad(module, LoadSourceCache, start, e.err)
 	} else {
 		// First request for this module.
 		e = &entry{ready: make(chan struct{})}
@@ -97,6 +171,7 @@ func (c *cache) get(cc *cycleChecker, module string) (starlark.StringDict, error
 		// decides whether doLoad panicked, because under the go 1.19 floor
 		// recover() returns nil for panic(nil), which would skip the cleanup.
 		loaded := false
+		var st loadState
 		defer func() {
 			if loaded {
 				return
@@ -112,15 +187,17 @@ func (c *cache) get(cc *cycleChecker, module string) (starlark.StringDict, error
 			e.setOwner(nil)
 			close(e.ready)
 			c.remove(module)
+			c.notifyLoad(module, st.source, start, e.err)
 			panic(r)
 		}()
-		var loadThread *starlark.Thread
-		e.globals, e.err = c.doLoad(cc, module, &loadThread)
+		e.globals, e.err = c.doLoad(cc, module, &st)
 		loaded = true
+		e.hash = st.hash
 		e.setOwner(nil)
 
 		// Broadcast that the entry is now ready.
 		close(e.ready)
+		c.notifyLoad(module, st.source, start, e.err)
 
 		// A load aborted because the run's context was cancelled is transient
 		// (run-scoped), not a property of the module: evict it so a later run
@@ -128,20 +205,28 @@ func (c *cache) get(cc *cycleChecker, module string) (starlark.StringDict, error
 		// the stale cancellation error. Mirrors the step-budget panic eviction.
 		// Waiters already blocked on e.ready still observe this run's error; only
 		// fresh loads after eviction re-execute.
-		if e.err != nil && loadContextCancelled(loadThread) {
+		if e.err != nil && loadContextCancelled(st.thread) {
 			c.remove(module)
 		}
 	}
 	return e.globals, e.err
 }
 
-// doLoad loads module. It publishes the thread the module executes on through
-// *loadThread so the caller can tell whether a failure was a transient
-// run-context cancellation (see get) without re-indenting the load body.
-func (c *cache) doLoad(cc *cycleChecker, module string, loadThread **starlark.Thread) (starlark.StringDict, error) {
+// notifyLoad reports a module resolution to the onLoad observer, if any.
+func (c *cache) notifyLoad(module string, src LoadSource, start time.Time, err error) {
+	if c.onLoad != nil {
+		c.onLoad(module, src, start, err)
+	}
+}
+
+// doLoad loads module. It publishes the thread the module executes on and
+// where the module came from through *st, so the caller can tell whether a
+// failure was a transient run-context cancellation (see get) without
+// re-indenting the load body.
+func (c *cache) doLoad(cc *cycleChecker, module string, st *loadState) (starlark.StringDict, error) {
 	// Tunnel the cycle-checker state for this "thread of loading".
-	loadFn := func(_ *starlark.Thread, module string) (starlark.StringDict, error) {
-		return c.get(cc, module)
+	loadFn := func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+		return c.getFrom(cc, thread, module)
 	}
 	var thread *starlark.Thread
 	if c.newThread != nil {
@@ -155,7 +240,7 @@ func (c *cache) doLoad(cc *cycleChecker, module string, loadThread **starlark.Th
 			Load:  loadFn,
 		}
 	}
-	*loadThread = thread
+	st.thread = thread
 
 	// Cancel this load thread when the run's context fires, so a long
 	// computation inside a loaded module honours the run timeout rather than
@@ -164,14 +249,22 @@ func (c *cache) doLoad(cc *cycleChecker, module string, loadThread **starlark.Th
 		defer c.watchCancel(thread)()
 	}
 
+	// 0: refuse a module denied by the capability policy by its name, before
+	// it's looked up anywhere
+	if err := c.registry.orDefault().checkPolicy(module, c.deny); err != nil {
+		return nil, err
+	}
+
 	// 1: load from built-in module, the first field returns nil if not found
 	m, err := c.loadMod(module)
 	if err != nil {
 		// fail to load module
+		st.source = LoadSourceLazyload
 		return nil, err
 	}
 	if m != nil {
 		// module found and loaded
+		st.source = LoadSourceLazyload
 		return m, nil
 	}
 
@@ -185,19 +278,31 @@ func (c *cache) doLoad(cc *cycleChecker, module string, loadThread **starlark.Th
 		// deliberately left out of this machine's module set — withheld —
 		// which is different from a misspelled or unknown name.
 		if errors.Is(err, errNoFS) || errors.Is(err, fs.ErrNotExist) {
-			if _, known := allBuiltinModules[module]; known {
+			if c.missing != nil {
+				return nil, c.missing(module)
+			}
+			if c.registry.orDefault().Has(module) {
 				return nil, ModuleWithheldError{Name: module}
 			}
 			return nil, ModuleNotFoundError{Name: module}
 		}
+		st.source = LoadSourceFile
 		return nil, err
 	}
 
 	// 3. execute the source file
-	if c.execOpts == nil {
-		return starlark.ExecFile(thread, module, b, c.globals)
+	st.source = LoadSourceFile
+	st.hash = contentHash(b)
+	var globals starlark.StringDict
+	switch {
+	case c.execOpts == nil:
+		globals, err = starlark.ExecFile(thread, module, b, c.globals)
+	case c.progCache != nil:
+		globals, err = execCachedFile(c.progCache, c.execOpts, thread, module, b, c.globals)
+	default:
+		globals, err = starlark.ExecFileOptions(c.execOpts, thread, module, b, c.globals)
 	}
-	return starlark.ExecFileOptions(c.execOpts, thread, module, b, c.globals)
+	return globals, hintUndefined(err, c.globals)
 }
 
 // loadContextCancelled reports whether the given load thread's run context
@@ -2,8 +2,10 @@ package starlet
 
 import (
 	"context"
+	"sort"
 	"time"
 
+	"github.com/1set/starlet/dataconv"
 	"github.com/1set/starlight/convert"
 	"go.starlark.net/starlark"
 )
@@ -12,7 +14,38 @@ import (
 // The function runs without a context: it cannot be cancelled or time-bounded;
 // use CallWithContext or CallWithTimeout for that.
 func (m *Machine) Call(name string, args ...interface{}) (out interface{}, err error) {
-	return m.callInternal(nil, name, args)
+	return m.callInternal(nil, name, args, nil)
+}
+
+// CallKw executes like Call, but with both positional and keyword arguments, the keyword arguments are passed in the ascending order of their names.
+func (m *Machine) CallKw(name string, args []interface{}, kwargs map[string]interface{}) (out interface{}, err error) {
+	return m.callInternal(nil, name, args, kwargs)
+}
+
+// CallKwWithContext executes like CallKw, but the function call is aborted when ctx is cancelled, matching CallWithContext semantics.
+func (m *Machine) CallKwWithContext(ctx context.Context, name string, args []interface{}, kwargs map[string]interface{}) (out interface{}, err error) {
+	return m.callInternal(ctx, name, args, kwargs)
+}
+
+// CallAs executes a Starlark function or builtin saved in the machine like Call, and decodes the result into a value of the Go type T with dataconv.DecodeStarlark.
+// Struct fields are matched by the custom tag of the machine, or the default "starlark" tag if unset, and a decoding failure reports the path of the value that failed, e.g. "items[2].name: got int, want string".
+func CallAs[T any](m *Machine, name string, args ...interface{}) (T, error) {
+	return CallKwAs[T](m, name, args, nil)
+}
+
+// CallKwAs executes like CallAs, but with both positional and keyword arguments.
+func CallKwAs[T any](m *Machine, name string, args []interface{}, kwargs map[string]interface{}) (out T, err error) {
+	err = m.callRaw(nil, name, args, kwargs, func(res starlark.Value) error {
+		tag := m.customTag
+		if tag == "" {
+			tag = convert.DefaultPropertyTag
+		}
+		if e := dataconv.DecodeStarlark(res, &out, tag); e != nil {
+			return errorDataconvDecode("result", e)
+		}
+		return nil
+	})
+	return out, err
 }
 
 // CallWithTimeout executes like Call, but the function call (and any
@@ -21,7 +54,7 @@ func (m *Machine) Call(name string, args ...interface{}) (out interface{}, err e
 func (m *Machine) CallWithTimeout(timeout time.Duration, name string, args ...interface{}) (out interface{}, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	return m.callInternal(ctx, name, args)
+	return m.callInternal(ctx, name, args, nil)
 }
 
 // CallWithContext executes like Call, but the function call (and any
@@ -29,54 +62,86 @@ func (m *Machine) CallWithTimeout(timeout time.Duration, name string, args ...in
 // cancelled, matching RunWithContext semantics. A nil context behaves like
 // plain Call; an already-cancelled context fails immediately.
 func (m *Machine) CallWithContext(ctx context.Context, name string, args ...interface{}) (out interface{}, err error) {
-	return m.callInternal(ctx, name, args)
+	return m.callInternal(ctx, name, args, nil)
 }
 
-func (m *Machine) callInternal(ctx context.Context, name string, args []interface{}) (out interface{}, err error) {
+func (m *Machine) callInternal(ctx context.Context, name string, args []interface{}, kwargs map[string]interface{}) (out interface{}, err error) {
+	err = m.callRaw(ctx, name, args, kwargs, func(res starlark.Value) error {
+		if m.enableOutConv { // convert to interface{} if enabled
+			out = convert.FromValue(res)
+		} else {
+			out = res
+		}
+		return nil
+	})
+	return out, err
+}
+
+// callRaw calls the function with the machine locked, and hands the result to handle while still holding the lock, even if the call fails.
+// The error of the call takes precedence over the error returned by handle, which is only consulted for a successful call.
+func (m *Machine) callRaw(ctx context.Context, name string, args []interface{}, kwargs map[string]interface{}, handle func(res starlark.Value) error) (err error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	defer func() {
 		if r := recover(); r != nil {
-			if me, ok := r.(MaxStepsExceededError); ok {
-				err = errorStarlarkError("call", me)
-			} else {
-				err = errorStarlarkPanic("call", r)
-			}
+			err = errorRecovered("call", r)
 		}
 	}()
 
 	// preconditions
 	if name == "" {
-		return nil, errorStarletErrorf("call", "no function name")
+		return errorStarletErrorf("call", "no function name")
 	}
 	if m.predeclared == nil || m.thread == nil {
-		return nil, errorStarletErrorf("call", "no function loaded")
+		return errorStarletErrorf("call", "no function loaded")
 	}
 	var callFunc starlark.Callable
 	if rf, ok := m.predeclared[name]; !ok {
-		return nil, errorStarletErrorf("call", "no such function: %s", name)
+		return errorStarletErrorf("call", "no such function: %s", name)
 	} else if sf, ok := rf.(*starlark.Function); ok {
 		callFunc = sf
 	} else if sb, ok := rf.(*starlark.Builtin); ok {
 		callFunc = sb
 	} else {
-		return nil, errorStarletErrorf("call", "mistyped function: %s", name)
+		return errorStarletErrorf("call", "mistyped function: %s", name)
 	}
+	return m.callLocked(ctx, callFunc, args, kwargs, handle)
+}
 
+// callLocked converts the arguments and calls the callable on the thread of the machine, which is locked by the caller, and hands the result to handle like callRaw.
+func (m *Machine) callLocked(ctx context.Context, callFunc starlark.Callable, args []interface{}, kwargs map[string]interface{}, handle func(res starlark.Value) error) error {
 	// convert arguments
 	sl := starlark.Tuple{}
 	for _, arg := range args {
 		sv, err := convert.ToValueWithTag(arg, m.customTag)
 		if err != nil {
-			return nil, errorStarlightConvert("args", err)
+			return errorStarlightConvert("args", err)
 		}
 		sl = append(sl, sv)
 	}
+	var kw []starlark.Tuple
+	if len(kwargs) > 0 {
+		keys := make([]string, 0, len(kwargs))
+		for k := range kwargs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		kw = make([]starlark.Tuple, 0, len(keys))
+		for _, k := range keys {
+			sv, err := convert.ToValueWithTag(kwargs[k], m.customTag)
+			if err != nil {
+				return errorStarlightConvert("kwargs", err)
+			}
+			kw = append(kw, starlark.Tuple{starlark.String(k), sv})
+		}
+	}
 
-	// reset the thread, arm the step budget, and wire the context
+	// reset the thread, arm the step budget and print limits, and wire the context
 	m.thread.Uncancel()
 	m.applyStepBudget()
+	m.resetPrintOutput()
+	m.applyResourceLimits(m.thread)
 	if ctx == nil {
 		// plain Call: no cancellation channel, as before
 		m.thread.SetLocal("context", context.TODO())
@@ -84,23 +149,18 @@ func (m *Machine) callInternal(ctx context.Context, name string, args []interfac
 		if err := ctx.Err(); err != nil {
 			// fail fast instead of silently calling with a context that
 			// can never fire again
-			return nil, errorStarletError("call", err)
+			return errorStarletError("call", err)
 		}
 		m.thread.SetLocal("context", ctx)
 		stop := m.watchContextCancel(ctx)
 		defer stop()
 	}
 
-	// call and convert result
-	res, err := starlark.Call(m.thread, callFunc, sl, nil)
-	if m.enableOutConv { // convert to interface{} if enabled
-		out = convert.FromValue(res)
-	} else {
-		out = res
-	}
-	// handle error
+	// call and handle result
+	res, err := starlark.Call(m.thread, callFunc, sl, kw)
+	herr := handle(res)
 	if err != nil {
-		return out, errorStarlarkError("call", err)
+		return m.annotateError(errorStarlarkError("call", err))
 	}
-	return out, nil
+	return herr
 }
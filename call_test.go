@@ -307,3 +307,122 @@ func TestMachine_CallWithContext(t *testing.T) {
 		}
 	}
 }
+
+func TestMachine_CallKw(t *testing.T) {
+	m := starlet.NewDefault()
+	if _, err := m.RunScript([]byte(`
+def greet(name, greeting="hello", punct="!"):
+	return greeting + ", " + name + punct
+`), nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []interface{}
+		kwargs  map[string]interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{"positional only", []interface{}{"Bob"}, nil, "hello, Bob!", ""},
+		{"keyword only", nil, map[string]interface{}{"name": "Ann", "punct": "?"}, "hello, Ann?", ""},
+		{"mixed", []interface{}{"Cat"}, map[string]interface{}{"greeting": "hi"}, "hi, Cat!", ""},
+		{"duplicate", []interface{}{"Dan"}, map[string]interface{}{"name": "Eve"}, nil, "starlark: call: function greet got multiple values for parameter \"name\""},
+		{"unexpected", nil, map[string]interface{}{"name": "Eve", "mood": 1}, nil, "starlark: call: function greet got an unexpected keyword argument \"mood\""},
+		{"unconvertible", nil, map[string]interface{}{"name": make(chan int)}, nil, "starlight: convert kwargs:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.CallKw("greet", tt.args, tt.kwargs)
+			if tt.wantErr != "" {
+				expectErr(t, err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			} else if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.CallKwWithContext(ctx, "greet", []interface{}{"x"}, nil); err == nil {
+		t.Errorf("expected error for cancelled context")
+	}
+}
+
+func TestCallAs(t *testing.T) {
+	type item struct {
+		Name  string   `starlark:"name"`
+		Count int      `starlark:"count"`
+		Tags  []string `starlark:"tags"`
+	}
+	type order struct {
+		ID    string `json:"id"`
+		Items []item `json:"items"`
+	}
+
+	m := starlet.NewDefault()
+	if _, err := m.RunScript([]byte(`
+def make_item(name, count=1):
+	return {"name": name, "count": count, "tags": [name.upper()]}
+
+def make_items(*names):
+	return [make_item(n) for n in names]
+
+def bad_items():
+	return [make_item("a"), {"name": 2}]
+
+def fail_hard():
+	fail("boom")
+`), nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	it, err := starlet.CallKwAs[item](m, "make_item", []interface{}{"apple"}, map[string]interface{}{"count": 3})
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	} else if !reflect.DeepEqual(it, item{"apple", 3, []string{"APPLE"}}) {
+		t.Errorf("unexpected item: %+v", it)
+	}
+
+	its, err := starlet.CallAs[[]item](m, "make_items", "x", "y")
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	} else if len(its) != 2 || its[1].Name != "y" || its[1].Count != 1 {
+		t.Errorf("unexpected items: %+v", its)
+	}
+
+	num, err := starlet.CallAs[int](m, "make_items")
+	expectErr(t, err, "dataconv: decode result: value: got list, want int")
+	if num != 0 {
+		t.Errorf("expected zero value, got %v", num)
+	}
+
+	_, err = starlet.CallAs[[]item](m, "bad_items")
+	expectErr(t, err, "dataconv: decode result: [1].name: got int, want string")
+
+	_, err = starlet.CallAs[item](m, "fail_hard")
+	expectErr(t, err, "starlark: call: fail: boom")
+
+	_, err = starlet.CallAs[item](m, "no_such")
+	expectErr(t, err, "starlet: call: no such function: no_such")
+
+	// custom tag is honoured
+	m.SetCustomTag("json")
+	m.SetGlobals(nil)
+	if _, err := m.RunScript([]byte(`
+def make_order():
+	return {"id": "o1", "items": [{"Name": "n", "Count": 2}]}
+`), nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	o, err := starlet.CallAs[*order](m, "make_order")
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	} else if o.ID != "o1" || len(o.Items) != 1 || o.Items[0].Count != 2 {
+		t.Errorf("unexpected order: %+v", o)
+	}
+}
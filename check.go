@@ -0,0 +1,221 @@
+package starlet
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	itn "github.com/1set/starlet/internal"
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// Diagnostic is a problem found in a script without executing it, located by its position.
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int32  `json:"line"`
+	Column  int32  `json:"column"`
+	Message string `json:"message"`
+}
+
+// String returns the diagnostic in the form of "file:line:column: message".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// newDiagnostic creates a Diagnostic at the given position.
+func newDiagnostic(pos syntax.Position, msg string) Diagnostic {
+	return Diagnostic{File: pos.Filename(), Line: pos.Line, Column: pos.Col, Message: msg}
+}
+
+// Check validates the script without executing it, and returns the problems found in it and the modules it loads.
+//
+// The script is parsed and resolved against the predeclared names of the machine: the globals, preload modules and extras, including the variables of previous runs if it has run.
+// The load() statements are followed statically: a lazyload module is loaded to learn its members unless a previous run has loaded it already, while a module of the script filesystem and search path is checked in turn and exports its global names, so a missing module or member is reported at the load statement.
+// The loaders of the preload modules before the first run, and of the lazyload modules not loaded yet, are invoked like a run does, so it takes the machine exclusively as well.
+// It returns an error only if the check cannot be done at all, e.g. there is no script or the preload modules fail to load; problems of the script are diagnostics, and nil means none.
+func (m *Machine) Check() ([]Diagnostic, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name, src, _, err := m.readScript("check")
+	if err != nil {
+		return nil, err
+	}
+
+	// the names visible to the script, without touching the state of the machine
+	predeclared := m.predeclared
+	if predeclared == nil {
+		if predeclared, err = m.convertInput(m.globals); err != nil {
+			return nil, errorStarlightConvert("globals", err)
+		}
+		if err = m.preloadMods.loadAll(predeclared, m.preloadNames, m.registry.orDefault(), m.capDeny, nil); err != nil {
+			return nil, errorStarletError("preload", err)
+		}
+	}
+
+	c := &checker{
+		m:           m,
+		opts:        m.getFileOptions(),
+		predeclared: predeclared,
+		lazy:        m.checkLazyLoader(),
+		files:       make(map[string]*checkedFile),
+	}
+	c.checkFile(name, src)
+	return c.diags, nil
+}
+
+// checkLazyLoader returns a lazy loader for Check, which takes the lazyload modules loaded by previous runs from the load cache instead of loading them again.
+func (m *Machine) checkLazyLoader() NamedModuleLoader {
+	reg := m.registry.orDefault()
+	lazy := m.lazyloadMods.lazyLoader(reg, m.capDeny)
+	return func(name string) (starlark.StringDict, error) {
+		if _, ok := m.lazyloadMods[name]; ok {
+			if d, ok := m.loadCache.loaded(name); ok {
+				return d, reg.checkBoundPolicy(d, m.capDeny)
+			}
+		}
+		return lazy(name)
+	}
+}
+
+// loaded returns the globals of the module loaded without errors already, without loading it.
+func (c *cache) loaded(module string) (starlark.StringDict, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.cacheMu.Lock()
+	e := c.cache[module]
+	c.cacheMu.Unlock()
+	if e == nil {
+		return nil, false
+	}
+	select {
+	case <-e.ready:
+		return e.globals, e.err == nil
+	default:
+		return nil, false // still loading
+	}
+}
+
+// checker follows the load() statements of a script statically.
+type checker struct {
+	m           *Machine
+	opts        *syntax.FileOptions
+	predeclared starlark.StringDict
+	lazy        NamedModuleLoader
+	files       map[string]*checkedFile
+	diags       []Diagnostic
+}
+
+// checkedFile is the outcome of checking a module file.
+type checkedFile struct {
+	done    bool            // false while the file is being checked
+	exports map[string]bool // global names of the file, nil if it fails to parse
+}
+
+// checkFile parses and resolves the file, and checks the modules it loads.
+func (c *checker) checkFile(filename string, src []byte) *checkedFile {
+	cf := &checkedFile{}
+	c.files[filename] = cf
+	defer func() { cf.done = true }()
+
+	f, err := c.opts.Parse(filename, src, 0)
+	if err != nil {
+		var se syntax.Error
+		if errors.As(err, &se) {
+			c.diags = append(c.diags, newDiagnostic(se.Pos, se.Msg))
+		} else {
+			c.diags = append(c.diags, Diagnostic{File: filename, Message: err.Error()})
+		}
+		return cf
+	}
+
+	// check the loaded modules first, in the order of the statements
+	for _, stmt := range f.Stmts {
+		if ld, ok := stmt.(*syntax.LoadStmt); ok {
+			c.checkLoad(filename, ld)
+		}
+	}
+
+	// resolve the names
+	if err := hintUndefined(resolve.File(f, c.predeclared.Has, starlark.Universe.Has), c.predeclared); err != nil {
+		var el resolve.ErrorList
+		if errors.As(err, &el) {
+			for _, e := range el {
+				c.diags = append(c.diags, newDiagnostic(e.Pos, e.Msg))
+			}
+		} else {
+			c.diags = append(c.diags, Diagnostic{File: filename, Message: err.Error()})
+		}
+	}
+	cf.exports = make(map[string]bool)
+	if mod, ok := f.Module.(*resolve.Module); ok {
+		for _, b := range mod.Globals {
+			cf.exports[b.First.Name] = true
+		}
+	}
+	return cf
+}
+
+// checkLoad checks the module of the load statement exists and has the loaded members.
+func (c *checker) checkLoad(from string, ld *syntax.LoadStmt) {
+	module := ld.ModuleName()
+	name, err := c.m.resolveLoadName(from, module)
+	if err != nil {
+		c.diags = append(c.diags, newDiagnostic(ld.Module.TokenPos, err.Error()))
+		return
+	}
+	if err := c.m.registry.orDefault().checkPolicy(name, c.m.capDeny); err != nil {
+		c.diags = append(c.diags, newDiagnostic(ld.Module.TokenPos, err.Error()))
+		return
+	}
+
+	// from lazyload modules
+	var members []string
+	if d, err := c.lazy(name); err != nil {
+		c.diags = append(c.diags, newDiagnostic(ld.Module.TokenPos, fmt.Sprintf("cannot load %s: %v", module, err)))
+		return
+	} else if d != nil {
+		members = d.Keys()
+	}
+
+	// from files
+	if members == nil {
+		cf, ok := c.files[name]
+		if !ok {
+			b, err := readScriptFile(name, c.m.getLoadFS())
+			if err != nil {
+				if errors.Is(err, errNoFS) || errors.Is(err, fs.ErrNotExist) {
+					err = c.m.missingModuleError(name)
+				}
+				c.diags = append(c.diags, newDiagnostic(ld.Module.TokenPos, fmt.Sprintf("cannot load %s: %v", module, err)))
+				return
+			}
+			cf = c.checkFile(name, b)
+		}
+		if !cf.done {
+			// still being checked up the load chain
+			c.diags = append(c.diags, newDiagnostic(ld.Module.TokenPos, fmt.Sprintf("cannot load %s: cycle in load graph", module)))
+			return
+		}
+		if cf.exports == nil {
+			// failed to parse, which is reported already
+			return
+		}
+		members = sortedKeys(cf.exports)
+	}
+
+	// the loaded members, with the nearest one as a hint
+	has := make(map[string]bool, len(members))
+	for _, n := range members {
+		has[n] = true
+	}
+	for _, id := range ld.From {
+		if !has[id.Name] {
+			msg := fmt.Sprintf("load: module %q has no member %q", module, id.Name) + didYouMean(itn.NearestName(id.Name, members))
+			c.diags = append(c.diags, newDiagnostic(id.NamePos, msg))
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package starlet_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/1set/starlet"
+	"go.starlark.net/starlark"
+)
+
+func TestMachine_Check(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ok.star":     &fstest.MapFile{Data: []byte("load(\"lib\", \"f\")\nload(\"json\", \"encode\")\nx = f(encode(greeting))\n")},
+		"lib.star":    &fstest.MapFile{Data: []byte("load(\"json\", \"decode\")\n_private = 1\ndef f(v):\n    return v\n")},
+		"bad.star":    &fstest.MapFile{Data: []byte("load(\"lib\", \"f\", \"g\", \"decode\")\nload(\"nope\", \"x\")\nload(\"http\", \"get\")\nload(\"json\", \"missing\", \"encod\")\ny = undefined_name + f(1) + greting\n")},
+		"syntax.star": &fstest.MapFile{Data: []byte("x = (1,\n")},
+		"broken.star": &fstest.MapFile{Data: []byte("load(\"syntax\", \"x\")\nload(\"cyc1\", \"a\")\n")},
+		"cyc1.star":   &fstest.MapFile{Data: []byte("load(\"cyc2\", \"b\")\na = 1\n")},
+		"cyc2.star":   &fstest.MapFile{Data: []byte("load(\"cyc1\", \"a\")\nb = 2\n")},
+	}
+	tests := []struct {
+		script string
+		want   []string
+	}{
+		{
+			script: "ok.star",
+		},
+		{
+			script: "bad.star",
+			want: []string{
+				`bad.star:1:19: load: module "lib" has no member "g"`,
+				`bad.star:1:24: load: module "lib" has no member "decode"`,
+				`bad.star:2:6: cannot load nope: module "nope" not found in builtin modules, custom loaders, or the script filesystem`,
+				`bad.star:3:6: cannot load http: module "http" is withheld and not available to this machine`,
+				`bad.star:4:15: load: module "json" has no member "missing"`,
+				`bad.star:4:26: load: module "json" has no member "encod" (did you mean encode?)`,
+				`bad.star:5:5: undefined: undefined_name`,
+				`bad.star:5:29: undefined: greting (did you mean greeting?)`,
+			},
+		},
+		{
+			script: "syntax.star",
+			want:   []string{`syntax.star:2:1: got end of file, want ')'`},
+		},
+		{
+			script: "broken.star",
+			want: []string{
+				`syntax:2:1: got end of file, want ')'`,
+				`cyc2:1:6: cannot load cyc1: cycle in load graph`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			m := starlet.NewWithNames(starlet.StringAnyMap{"greeting": "hi"}, nil, []string{"json"})
+			m.SetScript(tt.script, nil, fsys)
+			ds, err := m.Check()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, d := range ds {
+				got = append(got, d.String())
+			}
+			expectStrings(t, "diagnostics", got, tt.want)
+		})
+	}
+
+	// nothing is executed
+	m := starlet.NewDefault()
+	m.SetScript("main.star", []byte(`fail("executed")`), nil)
+	if ds, err := m.Check(); err != nil || len(ds) != 0 {
+		t.Errorf("expected no diagnostics, got: %v, %v", ds, err)
+	}
+	if m.GetStarlarkThread() != nil {
+		t.Errorf("expected the machine not to run")
+	}
+
+	// lazyload modules loaded by a run are not loaded again
+	loads := 0
+	m = starlet.NewWithNames(nil, nil, nil)
+	m.SetLazyloadModules(starlet.ModuleLoaderMap{
+		"counter": func() (starlark.StringDict, error) {
+			loads++
+			return starlark.StringDict{"total": starlark.MakeInt(loads)}, nil
+		},
+	})
+	m.SetScript("main.star", []byte(`load("counter", "total")`), nil)
+	if _, err := m.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m.SetScript("main.star", []byte(`load("counter", "total", "totl")`), nil)
+	ds, err := m.Check()
+	if err != nil || len(ds) != 1 || ds[0].Message != `load: module "counter" has no member "totl" (did you mean total?)` {
+		t.Errorf("unexpected diagnostics: %v, %v", ds, err)
+	}
+	if loads != 1 {
+		t.Errorf("expected the module loaded once, got: %d", loads)
+	}
+
+	// no script to check
+	_, err = starlet.NewDefault().Check()
+	expectErr(t, err, "starlet: check: no script to execute")
+}
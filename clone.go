@@ -0,0 +1,123 @@
+package starlet
+
+import (
+	"io/fs"
+
+	"github.com/1set/starlet/dataconv"
+	"go.starlark.net/starlark"
+)
+
+// Clone creates a new machine with the same configuration and a copy of the predeclared state of this one, so that each copy starts from the same state, e.g. after preloading modules and running an init script, and runs independently of the others.
+//
+// The clone binds its own globals and preload modules, and gets a fresh thread and an independent load cache, so the modules bound by load() in previous runs are loaded again by the clone.
+// The variables left by previous runs and extras are copied: the results of runs and restored values are frozen by the machine and shared as they are immutable, while the lists, dicts and sets in the other values, e.g. extras, are deep-copied by dataconv.DeepCloneStringDict, keeping the values referenced by multiple names or in cycles shared within the copy.
+// Functions and the host objects wrapped by the input conversion are shared as well, and the functions keep resolving the predeclared names of the machine they were defined in.
+//
+// The print function, hooks, audit sink, module registry and ByteCache are shared with the clone, the dry-run mode is enabled with no effects collected, and the record and replay of a trace is not cloned.
+// It blocks while the machine runs, and fails if the clone cannot bind its globals and preload modules, or load the modules again.
+func (m *Machine) Clone() (c *Machine, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			c, err = nil, errorStarlarkPanic("clone", r)
+		}
+	}()
+
+	c = &Machine{
+		globals:             copyMap(m.globals),
+		preloadMods:         append(ModuleLoaderList(nil), m.preloadMods...),
+		preloadNames:        append([]string(nil), m.preloadNames...),
+		lazyloadMods:        copyMap(m.lazyloadMods),
+		printFunc:           m.printFunc,
+		maxPrintBytes:       m.maxPrintBytes,
+		maxPrintLines:       m.maxPrintLines,
+		hooks:               m.hooks,
+		determ:              m.determ,
+		audit:               m.audit,
+		allowGlobalReassign: m.allowGlobalReassign,
+		allowRecursion:      m.allowRecursion,
+		enableInConv:        m.enableInConv,
+		enableOutConv:       m.enableOutConv,
+		customTag:           m.customTag,
+		maxSteps:            m.maxSteps,
+		limits:              m.limits,
+		capDeny:             m.capDeny,
+		registry:            m.registry,
+		scriptName:          m.scriptName,
+		scriptContent:       m.scriptContent,
+		scriptFS:            m.scriptFS,
+		searchPath:          append([]fs.FS(nil), m.searchPath...),
+		progCache:           m.progCache,
+		runTimes:            m.runTimes,
+	}
+	if r := m.reload; r != nil {
+		// polls on the first run of the clone, against the script seen by this machine
+		c.reload = &hotReload{interval: r.interval, onReload: r.onReload, scriptName: r.scriptName, scriptHash: r.scriptHash}
+	}
+	if m.dryRun != nil {
+		c.dryRun = &dryRun{}
+	}
+
+	// nothing more to copy if it has not run
+	if m.thread == nil {
+		return c, nil
+	}
+	if err = c.prepareThread(nil); err != nil {
+		return nil, err
+	}
+
+	// resolve everything like Restore does, and copy the rest
+	rest := make(starlark.StringDict)
+	for _, name := range m.predeclared.Keys() {
+		v := m.predeclared[name]
+		if hn, ok := m.findHostBound(name, v); ok {
+			if hv, ok := c.hostBound[hn]; ok {
+				c.predeclared[name] = hv
+				continue
+			}
+		}
+		if mod, mem, ok := m.loadCache.findMember(v); ok {
+			ld, e := c.loadCache.Load(mod)
+			if e != nil {
+				return nil, errorStarletErrorf("clone", "variable %q: load module %q: %v", name, mod, e)
+			}
+			if lv, ok := ld[mem]; ok {
+				c.predeclared[name] = lv
+				continue
+			}
+		}
+		// the values frozen by this machine are immutable, and shared
+		if fv, ok := m.frozenBound[name]; ok && sameValue(v, fv) {
+			if c.frozenBound == nil {
+				c.frozenBound = make(starlark.StringDict)
+			}
+			c.predeclared[name] = v
+			c.frozenBound[name] = v
+			continue
+		}
+		rest[name] = v
+	}
+	cd, err := dataconv.DeepCloneStringDict(rest)
+	if err != nil {
+		return nil, errorStarletError("clone", err)
+	}
+	for name, v := range cd {
+		c.predeclared[name] = v
+	}
+	c.loadCache.globals = c.predeclared
+	return c, nil
+}
+
+// copyMap returns a shallow copy of the map, or nil if it's nil.
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return nil
+	}
+	n := make(map[K]V, len(m))
+	for k, v := range m {
+		n[k] = v
+	}
+	return n
+}
@@ -0,0 +1,113 @@
+package starlet_test
+
+import (
+	"testing"
+
+	"github.com/1set/starlet"
+	"go.starlark.net/starlark"
+)
+
+func TestMachine_Clone(t *testing.T) {
+	var printed []string
+	m := starlet.NewWithNames(starlet.StringAnyMap{
+		"greet": func(s string) string { return "hi " + s },
+	}, []string{"json"}, []string{"base64"})
+	m.SetPrintFunc(func(_ *starlark.Thread, msg string) {
+		printed = append(printed, msg)
+	})
+	m.SetScript("init.star", []byte(`
+load("lib.star", "table")
+codes = table
+base = [1, 2]
+def add(n):
+    return base + [n]
+`), MemFS{"lib.star": "print('loading')\ntable = {'a': 1}\n"})
+
+	// warm up with an init script and a mutable extra
+	if _, err := m.RunWithContext(nil, starlet.StringAnyMap{"items": starlark.NewList([]starlark.Value{starlark.MakeInt(1)})}); err != nil {
+		t.Fatalf("unexpected init error: %v", err)
+	}
+	c1, err := m.Clone()
+	if err != nil {
+		t.Fatalf("unexpected clone error: %v", err)
+	}
+	c2, err := m.Clone()
+	if err != nil {
+		t.Fatalf("unexpected clone error: %v", err)
+	}
+	// each clone loads the module bound to a name again in its own cache
+	if len(printed) != 3 {
+		t.Errorf("expected the module loaded by each machine, got: %q", printed)
+	}
+
+	// the clones run from the same state independently
+	out, err := c1.RunScript([]byte(`
+load("lib.star", "table")
+items.append(2)
+sum = add(3)
+n = len(items)
+msg = greet(json.encode(codes))
+same = table == codes
+`), nil)
+	if err != nil {
+		t.Fatalf("unexpected run error on clone: %v", err)
+	}
+	if out["n"] != int64(2) || out["msg"] != `hi {"a":1}` || out["same"] != true {
+		t.Errorf("unexpected output of clone: %v", out)
+	}
+	if s, ok := out["sum"].([]interface{}); !ok || len(s) != 3 {
+		t.Errorf("unexpected sum of clone: %v", out["sum"])
+	}
+	if len(printed) != 3 {
+		t.Errorf("expected the module cached by the clone, got: %q", printed)
+	}
+	for name, mm := range map[string]*starlet.Machine{"original": m, "other clone": c2} {
+		out, err := mm.RunScript([]byte(`n = len(items)`), nil)
+		if err != nil {
+			t.Fatalf("unexpected run error on %s: %v", name, err)
+		}
+		if out["n"] != int64(1) {
+			t.Errorf("expected items of %s untouched, got: %v", name, out["n"])
+		}
+	}
+
+	// frozen values stay frozen
+	_, err = c2.RunScript([]byte(`base.append(3)`), nil)
+	expectErr(t, err, "starlark: exec: append: cannot append to frozen list")
+}
+
+func TestMachine_Clone_Config(t *testing.T) {
+	m := starlet.NewWithNames(starlet.StringAnyMap{"a": 1}, nil, nil)
+	m.SetScript("test.star", []byte(`b = a + 1`), nil)
+	m.SetMaxExecutionSteps(100)
+
+	// a machine never run is cloned with its configuration only
+	c, err := m.Clone()
+	if err != nil {
+		t.Fatalf("unexpected clone error: %v", err)
+	}
+	c.AddGlobals(starlet.StringAnyMap{"a": 10})
+	out, err := c.Run()
+	if err != nil {
+		t.Fatalf("unexpected run error on clone: %v", err)
+	}
+	if out["b"] != int64(11) {
+		t.Errorf("unexpected output of clone: %v", out)
+	}
+	out, err = m.Run()
+	if err != nil {
+		t.Fatalf("unexpected run error: %v", err)
+	}
+	if out["b"] != int64(2) {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	// the step budget is cloned
+	_, err = c.RunScript([]byte(`
+def loop():
+    for i in range(1000):
+        pass
+loop()
+`), nil)
+	expectErr(t, err, "starlark: exec: execution exceeded the step limit (100)")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/1set/starlet"
+)
+
+// checkCommand is the subcommand to check code files, it's taken as a code file to run if a file of the name exists.
+const checkCommand = "check"
+
+// isFile returns true if the given path exists and is not a directory.
+func isFile(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && !fi.IsDir()
+}
+
+// checkFiles validates the given code files without running them, and prints the diagnostics found.
+// It returns 1 if any file has problems or cannot be checked, 0 otherwise.
+func checkFiles(mac *starlet.Machine, incFS fs.FS, files []string) int {
+	if len(files) == 0 {
+		PrintError(fmt.Errorf("no code file to check"))
+		return 1
+	}
+	setMachineExtras(mac, files)
+
+	failed := false
+	for _, fileName := range files {
+		bs, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			PrintError(err)
+			failed = true
+			continue
+		}
+		mac.SetScript(filepath.Base(fileName), bs, incFS)
+		diags, err := mac.Check()
+		if err != nil {
+			PrintError(err)
+			failed = true
+			continue
+		}
+		for _, d := range diags {
+			fmt.Println(d)
+		}
+		if len(diags) > 0 {
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -24,6 +24,7 @@ var (
 	includePath         string
 	codeContent         string
 	webPort             uint16
+	profilePath         string
 )
 
 var (
@@ -38,6 +39,7 @@ func init() {
 	flag.StringVarP(&includePath, "include", "i", ".", "include path for Starlark code to load modules from")
 	flag.StringVarP(&codeContent, "code", "c", "", "Starlark code to execute")
 	flag.Uint16VarP(&webPort, "web", "w", 0, "run web server on specified port, it provides request&response structs for Starlark code to handle HTTP requests")
+	flag.StringVar(&profilePath, "profile", "", "write a pprof profile of the Starlark execution to the file, e.g. out.pprof")
 	flag.Parse()
 
 	// fix for Windows terminal output
@@ -96,8 +98,7 @@ func processArgs() int {
 		// run code string from argument
 		setMachineExtras(mac, append([]string{`-c`}, flag.Args()...))
 		mac.SetScript("direct.star", []byte(codeContent), incFS)
-		_, err := mac.Run()
-		if err != nil {
+		if err := runMachine(mac); err != nil {
 			PrintError(err)
 			return 1
 		}
@@ -113,6 +114,9 @@ func processArgs() int {
 		if stdinIsTerminal {
 			fmt.Println()
 		}
+	case nargs >= 1 && flag.Arg(0) == checkCommand && !isFile(checkCommand):
+		// check code files without running them, unless there is a code file named so
+		return checkFiles(mac, incFS, flag.Args()[1:])
 	case nargs >= 1:
 		// run code from file
 		fileName := flag.Arg(0)
@@ -123,7 +127,7 @@ func processArgs() int {
 		}
 		setMachineExtras(mac, flag.Args())
 		mac.SetScript(filepath.Base(fileName), bs, incFS)
-		if _, err := mac.Run(); err != nil {
+		if err := runMachine(mac); err != nil {
 			PrintError(err)
 			return 1
 		}
@@ -134,6 +138,23 @@ func processArgs() int {
 	return 0
 }
 
+// runMachine runs the script of the machine, and writes its profile to the file given by the profile flag, if any.
+func runMachine(mac *starlet.Machine) error {
+	if ystring.IsBlank(profilePath) {
+		_, err := mac.Run()
+		return err
+	}
+	f, err := os.Create(profilePath)
+	if err != nil {
+		return err
+	}
+	_, err = mac.RunWithProfile(f, nil)
+	if ce := f.Close(); err == nil {
+		err = ce
+	}
+	return err
+}
+
 // PrintError prints the error to stderr,
 // or its backtrace if it is a Starlark evaluation error.
 func PrintError(err error) {
@@ -1,7 +1,6 @@
 package starlet
 
 import (
-	"fmt"
 	"strings"
 
 	libatom "github.com/1set/starlet/lib/atom"
@@ -68,24 +67,50 @@ var allBuiltinModules = ModuleLoaderMap{
 	libstat.ModuleName:   libstat.LoadModule,
 }
 
+// builtinModuleDocs holds the one-line descriptions of the builtin modules
+// shipped with Starlet, see ModuleRegistry.Doc.
+var builtinModuleDocs = map[string]string{
+	"atom":         "atomic operations for integers, floats, and strings",
+	"base64":       "base64 encoding and decoding",
+	"csv":          "parse and write comma-separated values",
+	"file":         "read, write, append, inspect, and copy files on the local file system",
+	"go_idiomatic": "Go-flavored helpers, constants, and constructors",
+	"hashlib":      "MD5, SHA-1, SHA-256, and SHA-512 digests",
+	"http":         "HTTP client shaped after Python's requests",
+	"json":         "convert values to and from JSON text",
+	"log":          "write log messages at five severity levels",
+	"math":         "mathematical constants and functions",
+	"net":          "network diagnostics: DNS lookup, TCP and HTTP ping",
+	"path":         "manipulate directories and file paths",
+	"random":       "random values for various distributions",
+	"re":           "regular-expression functions, a subset of Python's re",
+	"regex":        "regular-expression functions backed by Go's regexp",
+	"runtime":      "Go and application runtime information",
+	"serial":       "serialize data values to and from a lossless JSON envelope",
+	"stats":        "statistics functions",
+	"string":       "constants and functions for manipulating strings",
+	"struct":       "constructor of immutable structs",
+	"time":         "time points, durations, and time zones",
+}
+
 // GetAllBuiltinModuleNames returns a list of all builtin module names.
 func GetAllBuiltinModuleNames() []string {
-	return allBuiltinModules.Keys()
+	return defaultRegistry.Names()
 }
 
 // GetAllBuiltinModules returns a list of all builtin modules.
 func GetAllBuiltinModules() ModuleLoaderList {
-	return allBuiltinModules.Values()
+	return defaultRegistry.LoaderMap().Values()
 }
 
 // GetBuiltinModuleMap returns a map of all builtin modules.
 func GetBuiltinModuleMap() ModuleLoaderMap {
-	return allBuiltinModules.Clone()
+	return defaultRegistry.LoaderMap()
 }
 
 // GetBuiltinModule returns the builtin module with the given name.
 func GetBuiltinModule(name string) ModuleLoader {
-	return allBuiltinModules[name]
+	return defaultRegistry.Get(name)
 }
 
 // EnableRecursionSupport enables recursion support in Starlark environments for loading modules.
@@ -177,7 +202,7 @@ var builtinModuleCapabilities = map[string]ModuleCapability{
 	"base64":       CapPure,
 	"csv":          CapPure,
 	"file":         CapFileSystem,
-	"go_idiomatic": CapLog | CapProcess, // eprint/pprint write the host's stderr; sleep/exit touch run control
+	"go_idiomatic": CapLog | CapProcess, // eprint/pprint print via the thread's print function (stderr if unset); sleep/exit touch run control
 	"hashlib":      CapPure,
 	"http":         CapNetwork,
 	"json":         CapPure,
@@ -199,8 +224,29 @@ var builtinModuleCapabilities = map[string]ModuleCapability{
 // GetBuiltinModuleCapability returns the capability set of a builtin
 // module; ok is false for names that are not builtin modules.
 func GetBuiltinModuleCapability(name string) (cap ModuleCapability, ok bool) {
-	cap, ok = builtinModuleCapabilities[name]
-	return
+	return defaultRegistry.Capability(name)
+}
+
+// RegisterModuleCapability declares the capability set of a custom module
+// in the default registry, so the capability policy of machines (see
+// Machine.SetCapabilityPolicy) covers a module loaded under that name just
+// like a builtin one. A custom module that is never registered is
+// unclassified, and no policy can tell what it touches. Modules registered
+// with RegisterBuiltinModule carry their capability sets already, and an
+// isolated registry declares its own with ModuleRegistry.RegisterCapability.
+//
+// Registering a builtin module name, or re-registering a name with a
+// different set, is an error: a policy must not be loosened by a later
+// registration.
+func RegisterModuleCapability(name string, cap ModuleCapability) error {
+	return defaultRegistry.RegisterCapability(name, cap)
+}
+
+// GetModuleCapability returns the capability set of a builtin module or a
+// custom module declared by RegisterModuleCapability; ok is false for
+// unclassified names.
+func GetModuleCapability(name string) (cap ModuleCapability, ok bool) {
+	return defaultRegistry.moduleCapability(name)
 }
 
 // GetBuiltinModuleNamesExcluding returns all builtin module names except
@@ -208,31 +254,12 @@ func GetBuiltinModuleCapability(name string) (cap ModuleCapability, ok bool) {
 // fail-closed, because a typo in a denylist must not silently include the
 // module it meant to block.
 func GetBuiltinModuleNamesExcluding(excludes ...string) ([]string, error) {
-	ex := make(map[string]bool, len(excludes))
-	for _, e := range excludes {
-		if _, found := allBuiltinModules[e]; !found {
-			return nil, fmt.Errorf("unknown builtin module to exclude: %q", e)
-		}
-		ex[e] = true
-	}
-	var names []string
-	for _, n := range GetAllBuiltinModuleNames() {
-		if !ex[n] {
-			names = append(names, n)
-		}
-	}
-	return names, nil
+	return defaultRegistry.NamesExcluding(excludes...)
 }
 
 // GetBuiltinModuleNamesWithoutCapabilities returns the builtin module
 // names whose capability sets share nothing with caps - e.g. passing
 // CapNetwork|CapFileSystem yields the modules that can touch neither.
 func GetBuiltinModuleNamesWithoutCapabilities(caps ModuleCapability) []string {
-	var names []string
-	for _, n := range GetAllBuiltinModuleNames() {
-		if !builtinModuleCapabilities[n].Intersects(caps) {
-			names = append(names, n)
-		}
-	}
-	return names
+	return defaultRegistry.NamesWithoutCapabilities(caps)
 }
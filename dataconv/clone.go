@@ -0,0 +1,129 @@
+package dataconv
+
+import (
+	"fmt"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// DeepClone returns a deep copy of the value, in which all the lists, dicts and sets are copied, so that modifications to the copy do not impact the original value and vice versa.
+// The containers are copied unconditionally, and the copies are not frozen even if the originals are; a container referenced more than once or in a cycle is copied once, keeping the references and the cycle in the copy.
+// Tuples and structs are rebuilt only if any value in them is copied, while the keys of dicts and the items of sets are hashable and kept as they are, and so are other values, e.g. functions and custom types.
+// The value must not be modified by others while it's being copied.
+func DeepClone(v starlark.Value) (starlark.Value, error) {
+	nv, _, err := newDeepCloner().clone(v)
+	return nv, err
+}
+
+// DeepCloneStringDict returns a new StringDict with a deep copy of the values of the given one like DeepClone, and the containers referenced by more than one value are copied once as well.
+// It's safe to call it with a nil StringDict, it will return a new empty one.
+func DeepCloneStringDict(d starlark.StringDict) (starlark.StringDict, error) {
+	c := newDeepCloner()
+	nd := make(starlark.StringDict, len(d))
+	for _, k := range d.Keys() {
+		v, _, err := c.clone(d[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		nd[k] = v
+	}
+	return nd, nil
+}
+
+// deepCloner copies values for DeepClone, the memo maps the containers met to their copies.
+type deepCloner struct {
+	memo map[starlark.Value]starlark.Value
+}
+
+func newDeepCloner() *deepCloner {
+	return &deepCloner{memo: make(map[starlark.Value]starlark.Value)}
+}
+
+// clone returns the deep copy of the value, and whether anything in it is copied.
+func (c *deepCloner) clone(v starlark.Value) (starlark.Value, bool, error) {
+	switch v.(type) {
+	case *starlark.List, *starlark.Dict, *starlark.Set:
+		if n, ok := c.memo[v]; ok {
+			return n, true, nil
+		}
+	}
+
+	switch t := v.(type) {
+	case *starlark.List:
+		l := starlark.NewList(make([]starlark.Value, 0, t.Len()))
+		c.memo[v] = l
+		for i := 0; i < t.Len(); i++ {
+			e, _, err := c.clone(t.Index(i))
+			if err != nil {
+				return nil, false, err
+			}
+			if err = l.Append(e); err != nil {
+				return nil, false, err
+			}
+		}
+		return l, true, nil
+	case *starlark.Dict:
+		d := starlark.NewDict(t.Len())
+		c.memo[v] = d
+		for _, r := range t.Items() {
+			e, _, err := c.clone(r[1])
+			if err != nil {
+				return nil, false, err
+			}
+			if err = d.SetKey(r[0], e); err != nil {
+				return nil, false, err
+			}
+		}
+		return d, true, nil
+	case *starlark.Set:
+		s := starlark.NewSet(t.Len())
+		c.memo[v] = s
+		iter := t.Iterate()
+		defer iter.Done()
+		var x starlark.Value
+		for iter.Next(&x) {
+			if err := s.Insert(x); err != nil {
+				return nil, false, err
+			}
+		}
+		return s, true, nil
+	case starlark.Tuple:
+		var items starlark.Tuple
+		for i, e := range t {
+			n, copied, err := c.clone(e)
+			if err != nil {
+				return nil, false, err
+			}
+			if copied && items == nil {
+				items = append(make(starlark.Tuple, 0, len(t)), t[:i]...)
+			}
+			if items != nil {
+				items = append(items, n)
+			}
+		}
+		if items == nil {
+			return v, false, nil
+		}
+		return items, true, nil
+	case *starlarkstruct.Struct:
+		fields := make(starlark.StringDict)
+		t.ToStringDict(fields)
+		changed := false
+		for _, k := range fields.Keys() {
+			n, copied, err := c.clone(fields[k])
+			if err != nil {
+				return nil, false, err
+			}
+			if copied {
+				fields[k] = n
+				changed = true
+			}
+		}
+		if !changed {
+			return v, false, nil
+		}
+		return starlarkstruct.FromStringDict(t.Constructor(), fields), true, nil
+	}
+	return v, false, nil
+}
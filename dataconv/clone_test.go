@@ -0,0 +1,72 @@
+package dataconv
+
+import (
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func TestDeepClone(t *testing.T) {
+	frozen := starlark.NewList([]starlark.Value{starlark.MakeInt(1)})
+	frozen.Freeze()
+	inner := starlark.NewDict(1)
+	_ = inner.SetKey(starlark.String("k"), frozen)
+	outer := starlark.NewList([]starlark.Value{inner, inner, frozen})
+	_ = outer.Append(outer)
+	tup := starlark.Tuple{outer, starlark.String("s")}
+
+	// containers are copied once even if referenced twice or in a cycle
+	v, err := DeepClone(tup)
+	if err != nil {
+		t.Fatalf("DeepClone: unexpected error: %v", err)
+	}
+	ct := v.(starlark.Tuple)
+	cl := ct[0].(*starlark.List)
+	if cl == outer || ct[1] != tup[1] {
+		t.Errorf("DeepClone: expected list copied and string kept")
+	}
+	if cl.Index(0) == inner || cl.Index(0) != cl.Index(1) {
+		t.Errorf("DeepClone: expected dict copied once")
+	}
+	if cl.Index(3) != cl {
+		t.Errorf("DeepClone: expected cycle kept")
+	}
+
+	// frozen containers are copied as well, and the copies are mutable
+	cf := cl.Index(2).(*starlark.List)
+	if cf == frozen || cf.Append(starlark.None) != nil {
+		t.Errorf("DeepClone: expected frozen list copied and mutable")
+	}
+	if d, _, _ := cl.Index(0).(*starlark.Dict).Get(starlark.String("k")); d != cl.Index(2) {
+		t.Errorf("DeepClone: expected frozen list in dict copied once")
+	}
+	if frozen.Len() != 1 {
+		t.Errorf("DeepClone: expected the original untouched")
+	}
+
+	// nothing mutable, nothing rebuilt
+	st := starlark.Tuple{starlark.String("a"), starlark.None}
+	if v, _ := DeepClone(st); &v.(starlark.Tuple)[0] != &st[0] {
+		t.Errorf("DeepClone: expected tuple of immutable values kept")
+	}
+	s := starlark.NewSet(1)
+	_ = s.Insert(starlark.MakeInt(1))
+	if v, _ := DeepClone(s); v == s || v.(*starlark.Set).Len() != 1 {
+		t.Errorf("DeepClone: expected set copied")
+	}
+}
+
+func TestDeepCloneStringDict(t *testing.T) {
+	shared := starlark.NewList(nil)
+	d := starlark.StringDict{"a": shared, "b": starlark.Tuple{shared}, "c": starlark.MakeInt(1)}
+	nd, err := DeepCloneStringDict(d)
+	if err != nil {
+		t.Fatalf("DeepCloneStringDict: unexpected error: %v", err)
+	}
+	if nd["a"] == shared || nd["b"].(starlark.Tuple)[0] != nd["a"] || nd["c"] != d["c"] {
+		t.Errorf("DeepCloneStringDict: expected the shared list copied once, got: %v", nd)
+	}
+	if nd, err := DeepCloneStringDict(nil); err != nil || nd == nil || len(nd) != 0 {
+		t.Errorf("DeepCloneStringDict: expected an empty dict, got: %v, %v", nd, err)
+	}
+}
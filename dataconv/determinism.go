@@ -0,0 +1,117 @@
+package dataconv
+
+import (
+	crand "crypto/rand"
+	"io"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	stdtime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+)
+
+// the keys of the thread-locals for deterministic runs
+const (
+	threadClockKey = "virtual_clock"
+	threadRandKey  = "random_source"
+)
+
+// VirtualClock is a clock for deterministic runs: it stands still unless it's advanced, and sleeping on it advances it at once instead of waiting.
+// It's safe for concurrent use.
+type VirtualClock struct {
+	mu    sync.Mutex
+	start time.Time
+	now   time.Time
+}
+
+// NewVirtualClock creates a VirtualClock starting at the given time.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{start: start, now: start}
+}
+
+// Now returns the current time of the clock.
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Elapsed returns the duration the clock advanced since it started.
+func (c *VirtualClock) Elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now.Sub(c.start)
+}
+
+// Advance moves the clock forward by the given duration, negative durations are ignored.
+func (c *VirtualClock) Advance(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// SetThreadClock sets the virtual clock of the thread, which is used by time.now() as well, or removes it if nil.
+func SetThreadClock(thread *starlark.Thread, c *VirtualClock) {
+	if c == nil {
+		thread.SetLocal(threadClockKey, nil)
+		stdtime.SetNow(thread, nil)
+		return
+	}
+	thread.SetLocal(threadClockKey, c)
+	stdtime.SetNow(thread, func() (time.Time, error) {
+		return c.Now(), nil
+	})
+}
+
+// GetThreadClock returns the virtual clock of the thread, or nil if the thread uses the wall clock.
+func GetThreadClock(thread *starlark.Thread) *VirtualClock {
+	if thread != nil {
+		if c, ok := thread.Local(threadClockKey).(*VirtualClock); ok {
+			return c
+		}
+	}
+	return nil
+}
+
+// NewSeededReader returns a source of pseudo-random bytes seeded with the given value, which yields the same bytes for the same seed.
+// It's safe for concurrent use, but it's not suitable for security-sensitive work.
+func NewSeededReader(seed int64) io.Reader {
+	return &seededReader{r: mrand.New(mrand.NewSource(seed))}
+}
+
+type seededReader struct {
+	mu sync.Mutex
+	r  *mrand.Rand
+}
+
+func (s *seededReader) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range p {
+		p[i] = byte(s.r.Int63())
+	}
+	return len(p), nil
+}
+
+// SetThreadRandReader sets the source of random bytes of the thread, or removes it if nil.
+func SetThreadRandReader(thread *starlark.Thread, r io.Reader) {
+	if r == nil {
+		thread.SetLocal(threadRandKey, nil)
+		return
+	}
+	thread.SetLocal(threadRandKey, r)
+}
+
+// GetThreadRandReader returns the source of random bytes of the thread, or the cryptographically secure one if not set.
+func GetThreadRandReader(thread *starlark.Thread) io.Reader {
+	if thread != nil {
+		if r, ok := thread.Local(threadRandKey).(io.Reader); ok {
+			return r
+		}
+	}
+	return crand.Reader
+}
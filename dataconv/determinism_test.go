@@ -0,0 +1,73 @@
+package dataconv
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	stdtime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+)
+
+func TestVirtualClock(t *testing.T) {
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	c := NewVirtualClock(start)
+	if !c.Now().Equal(start) || c.Elapsed() != 0 {
+		t.Errorf("unexpected initial clock: %v, %v", c.Now(), c.Elapsed())
+	}
+	c.Advance(time.Minute)
+	c.Advance(-time.Hour)
+	if !c.Now().Equal(start.Add(time.Minute)) || c.Elapsed() != time.Minute {
+		t.Errorf("unexpected advanced clock: %v, %v", c.Now(), c.Elapsed())
+	}
+
+	// thread-locals, shared with time.now()
+	thread := &starlark.Thread{}
+	if GetThreadClock(thread) != nil || GetThreadClock(nil) != nil {
+		t.Errorf("expected no clock")
+	}
+	SetThreadClock(thread, c)
+	if GetThreadClock(thread) != c {
+		t.Errorf("expected the clock of the thread")
+	}
+	if now, err := stdtime.Now(thread)(); err != nil || !now.Equal(c.Now()) {
+		t.Errorf("expected time.now() of the clock, got: %v, %v", now, err)
+	}
+	SetThreadClock(thread, nil)
+	if GetThreadClock(thread) != nil || stdtime.Now(thread) != nil {
+		t.Errorf("expected the clock removed")
+	}
+}
+
+func TestSeededReader(t *testing.T) {
+	read := func(r io.Reader) []byte {
+		b := make([]byte, 32)
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return b
+	}
+	if a, b := read(NewSeededReader(1)), read(NewSeededReader(1)); !bytes.Equal(a, b) {
+		t.Errorf("expected the same bytes with the same seed")
+	}
+	if a, b := read(NewSeededReader(1)), read(NewSeededReader(2)); bytes.Equal(a, b) {
+		t.Errorf("expected different bytes with different seeds")
+	}
+
+	// thread-locals
+	thread := &starlark.Thread{}
+	if GetThreadRandReader(thread) != rand.Reader || GetThreadRandReader(nil) != rand.Reader {
+		t.Errorf("expected the crypto reader by default")
+	}
+	r := NewSeededReader(1)
+	SetThreadRandReader(thread, r)
+	if GetThreadRandReader(thread) != r {
+		t.Errorf("expected the reader of the thread")
+	}
+	SetThreadRandReader(thread, nil)
+	if GetThreadRandReader(thread) != rand.Reader {
+		t.Errorf("expected the reader removed")
+	}
+}
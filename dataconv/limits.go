@@ -0,0 +1,245 @@
+package dataconv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"go.starlark.net/starlark"
+)
+
+// the key of the thread-local for resource limits
+const threadLimitsKey = "resource_limits"
+
+// ResourceLimits bounds the sizes of the values made by the builtins of Starlet modules and the output of a run, to guard the host against untrusted scripts.
+// A zero field means unlimited.
+type ResourceLimits struct {
+	MaxStringLen     int // bytes of a string or bytes value
+	MaxCollectionLen int // items of a list, tuple, dict or set
+	MaxOutputSize    int // approximate bytes of all the values converted as the output of a run, see ValueSize
+}
+
+// ResourceLimitError is the error when a value exceeds a limit of ResourceLimits.
+type ResourceLimitError struct {
+	Kind  string // "string", "bytes", "list", "tuple", "dict", "set", or "output"
+	Size  int
+	Limit int
+}
+
+// Error returns the error message.
+func (e ResourceLimitError) Error() string {
+	return fmt.Sprintf("%s of size %d exceeds the limit of %d", e.Kind, e.Size, e.Limit)
+}
+
+// SetThreadResourceLimits sets the resource limits of the thread, or removes them if nil.
+func SetThreadResourceLimits(thread *starlark.Thread, l *ResourceLimits) {
+	if l == nil {
+		thread.SetLocal(threadLimitsKey, nil)
+		return
+	}
+	thread.SetLocal(threadLimitsKey, l)
+}
+
+// GetThreadResourceLimits returns the resource limits of the thread, or nil if it has none.
+func GetThreadResourceLimits(thread *starlark.Thread) *ResourceLimits {
+	if thread != nil {
+		if l, ok := thread.Local(threadLimitsKey).(*ResourceLimits); ok {
+			return l
+		}
+	}
+	return nil
+}
+
+// CheckLen returns a ResourceLimitError if a value of the given kind and length exceeds the limits, i.e. MaxStringLen for "string" and "bytes", and MaxCollectionLen for the others.
+// It's meant for checking the size of a value before making it. A nil *ResourceLimits has no limits.
+func (l *ResourceLimits) CheckLen(kind string, n int) error {
+	if l == nil {
+		return nil
+	}
+	limit := l.MaxCollectionLen
+	if kind == "string" || kind == "bytes" {
+		limit = l.MaxStringLen
+	}
+	if limit > 0 && n > limit {
+		return ResourceLimitError{Kind: kind, Size: n, Limit: limit}
+	}
+	return nil
+}
+
+// CheckValue returns a ResourceLimitError if the value or any value in it exceeds the limits.
+// It walks into lists, tuples, dicts and sets, and visits each of them once even if it's referenced in cycles. A nil *ResourceLimits has no limits.
+func (l *ResourceLimits) CheckValue(v starlark.Value) error {
+	if l == nil || (l.MaxStringLen <= 0 && l.MaxCollectionLen <= 0) {
+		return nil
+	}
+	return l.checkValue(v, make(map[starlark.Value]bool))
+}
+
+func (l *ResourceLimits) checkValue(v starlark.Value, seen map[starlark.Value]bool) error {
+	var items []starlark.Value
+	switch t := v.(type) {
+	case starlark.String:
+		return l.CheckLen("string", len(t))
+	case starlark.Bytes:
+		return l.CheckLen("bytes", len(t))
+	case starlark.Tuple:
+		if err := l.CheckLen("tuple", len(t)); err != nil {
+			return err
+		}
+		items = t
+	case *starlark.List, *starlark.Dict, *starlark.Set:
+		if seen[v] {
+			return nil
+		}
+		seen[v] = true
+		if err := l.CheckLen(v.Type(), starlark.Len(v)); err != nil {
+			return err
+		}
+		items = containerItems(v)
+	default:
+		return nil
+	}
+	for _, it := range items {
+		if err := l.checkValue(it, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckJSON returns a ResourceLimitError if a value decoded from the JSON text would exceed the limits, i.e. a string longer than MaxStringLen, or an array or object with more items than MaxCollectionLen, as a list or dict.
+// It's meant for checking the text before decoding it: it scans the tokens without making any values, and reports an array or object with its full size once it ends. A malformed text is left for the decoder to report. A nil *ResourceLimits has no limits.
+func (l *ResourceLimits) CheckJSON(data []byte) error {
+	if l == nil || (l.MaxStringLen <= 0 && l.MaxCollectionLen <= 0) {
+		return nil
+	}
+	type container struct {
+		kind  string
+		count int
+		key   bool // the next token of an object is a key
+	}
+	var stack []*container
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		var top *container
+		if len(stack) > 0 {
+			top = stack[len(stack)-1]
+		}
+
+		// a key of an object, or the end of an array or object
+		if top != nil && top.kind == "dict" && top.key {
+			if d, ok := tok.(json.Delim); !ok || d != '}' {
+				top.count++
+				top.key = false
+				if s, ok := tok.(string); ok {
+					if err := l.CheckLen("string", len(s)); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+		}
+		if d, ok := tok.(json.Delim); ok && (d == ']' || d == '}') {
+			stack = stack[:len(stack)-1]
+			if err := l.CheckLen(top.kind, top.count); err != nil {
+				return err
+			}
+			if len(stack) > 0 && stack[len(stack)-1].kind == "dict" {
+				stack[len(stack)-1].key = true
+			}
+			continue
+		}
+
+		// a value, in an array or object
+		if top != nil && top.kind == "list" {
+			top.count++
+		}
+		switch t := tok.(type) {
+		case json.Delim:
+			if t == '[' {
+				stack = append(stack, &container{kind: "list"})
+			} else {
+				stack = append(stack, &container{kind: "dict", key: true})
+			}
+			continue
+		case string:
+			if err := l.CheckLen("string", len(t)); err != nil {
+				return err
+			}
+		}
+		if top != nil && top.kind == "dict" {
+			top.key = true
+		}
+	}
+}
+
+// ValueSize returns the approximate size of the value in bytes: the length of strings and bytes, and 8 for every other value, including each item and key in lists, tuples, dicts and sets.
+// It visits each list, dict and set once even if it's referenced in cycles.
+func ValueSize(v starlark.Value) int {
+	return valueSize(v, make(map[starlark.Value]bool))
+}
+
+func valueSize(v starlark.Value, seen map[starlark.Value]bool) int {
+	switch t := v.(type) {
+	case starlark.String:
+		return len(t)
+	case starlark.Bytes:
+		return len(t)
+	case starlark.Tuple, *starlark.List, *starlark.Dict, *starlark.Set:
+		if _, ok := t.(starlark.Tuple); !ok {
+			if seen[v] {
+				return 8
+			}
+			seen[v] = true
+		}
+		n := 8
+		for _, it := range containerItems(v) {
+			n += valueSize(it, seen)
+		}
+		return n
+	}
+	return 8
+}
+
+// containerItems returns the items of a tuple, list or set, or the keys and values of a dict.
+func containerItems(v starlark.Value) []starlark.Value {
+	switch t := v.(type) {
+	case starlark.Tuple:
+		return t
+	case *starlark.Dict:
+		items := make([]starlark.Value, 0, 2*t.Len())
+		for _, kv := range t.Items() {
+			items = append(items, kv[0], kv[1])
+		}
+		return items
+	case starlark.Iterable:
+		var items []starlark.Value
+		iter := t.Iterate()
+		defer iter.Done()
+		var x starlark.Value
+		for iter.Next(&x) {
+			items = append(items, x)
+		}
+		return items
+	}
+	return nil
+}
+
+// LimitResult wraps the builtin function to check its result against the resource limits of the thread, see CheckValue.
+func LimitResult(fn StarlarkFunc) StarlarkFunc {
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		res, err := fn(thread, b, args, kwargs)
+		if err != nil || res == nil {
+			return res, err
+		}
+		if err := GetThreadResourceLimits(thread).CheckValue(res); err != nil {
+			return nil, fmt.Errorf("%s: %w", b.Name(), err)
+		}
+		return res, nil
+	}
+}
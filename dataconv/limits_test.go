@@ -0,0 +1,150 @@
+package dataconv
+
+import (
+	"errors"
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func TestResourceLimits_CheckLen(t *testing.T) {
+	var nl *ResourceLimits
+	if err := nl.CheckLen("string", 1<<30); err != nil {
+		t.Errorf("expected no limits, got: %v", err)
+	}
+	l := &ResourceLimits{MaxStringLen: 4, MaxCollectionLen: 2}
+	tests := []struct {
+		kind string
+		n    int
+		want string
+	}{
+		{"string", 4, ""},
+		{"string", 5, "string of size 5 exceeds the limit of 4"},
+		{"bytes", 10, "bytes of size 10 exceeds the limit of 4"},
+		{"list", 2, ""},
+		{"dict", 3, "dict of size 3 exceeds the limit of 2"},
+	}
+	for _, tt := range tests {
+		err := l.CheckLen(tt.kind, tt.n)
+		if (err == nil && tt.want != "") || (err != nil && err.Error() != tt.want) {
+			t.Errorf("CheckLen(%q, %d) = %v, want %q", tt.kind, tt.n, err, tt.want)
+		}
+	}
+}
+
+func TestResourceLimits_CheckValue(t *testing.T) {
+	d := starlark.NewDict(1)
+	_ = d.SetKey(starlark.String("k"), starlark.NewList([]starlark.Value{starlark.Bytes("12345")}))
+	cyclic := starlark.NewList([]starlark.Value{starlark.String("ab")})
+	_ = cyclic.Append(cyclic)
+	tests := []struct {
+		name string
+		lim  ResourceLimits
+		v    starlark.Value
+		want *ResourceLimitError
+	}{
+		{"no limits", ResourceLimits{}, d, nil},
+		{"nested bytes", ResourceLimits{MaxStringLen: 4}, d, &ResourceLimitError{"bytes", 5, 4}},
+		{"dict key", ResourceLimits{MaxStringLen: 4}, starlark.Tuple{starlark.String("longer")}, &ResourceLimitError{"string", 6, 4}},
+		{"within", ResourceLimits{MaxStringLen: 5, MaxCollectionLen: 1}, d, nil},
+		{"tuple", ResourceLimits{MaxCollectionLen: 1}, starlark.Tuple{starlark.None, starlark.None}, &ResourceLimitError{"tuple", 2, 1}},
+		{"cycle", ResourceLimits{MaxStringLen: 2, MaxCollectionLen: 2}, cyclic, nil},
+		{"cycle exceeded", ResourceLimits{MaxStringLen: 1}, cyclic, &ResourceLimitError{"string", 2, 1}},
+		{"scalar", ResourceLimits{MaxStringLen: 1}, starlark.MakeInt(1000), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.lim.CheckValue(tt.v)
+			var le ResourceLimitError
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if !errors.As(err, &le) || le != *tt.want {
+				t.Errorf("expected %v, got: %v", *tt.want, err)
+			}
+		})
+	}
+}
+
+func TestResourceLimits_CheckJSON(t *testing.T) {
+	var nl *ResourceLimits
+	if err := nl.CheckJSON([]byte(`[1, 2, 3]`)); err != nil {
+		t.Errorf("expected no limits, got: %v", err)
+	}
+	tests := []struct {
+		name string
+		lim  ResourceLimits
+		text string
+		want *ResourceLimitError
+	}{
+		{"within", ResourceLimits{MaxStringLen: 3, MaxCollectionLen: 2}, `{"a": [1, "xyz"], "b": {}}`, nil},
+		{"list", ResourceLimits{MaxCollectionLen: 2}, `{"a": [1, [2, 3], 4, 5]}`, &ResourceLimitError{"list", 4, 2}},
+		{"inner first", ResourceLimits{MaxCollectionLen: 2}, `[[1, 2, 3], 4, 5, 6]`, &ResourceLimitError{"list", 3, 2}},
+		{"dict", ResourceLimits{MaxCollectionLen: 2}, `{"a": {}, "b": [], "c": null}`, &ResourceLimitError{"dict", 3, 2}},
+		{"key", ResourceLimits{MaxStringLen: 3}, `{"abcd": 1}`, &ResourceLimitError{"string", 4, 3}},
+		{"string", ResourceLimits{MaxStringLen: 3}, `[{"a": "abc"}, "a\u00e9bc"]`, &ResourceLimitError{"string", 5, 3}},
+		{"scalar", ResourceLimits{MaxStringLen: 1}, `12345`, nil},
+		{"malformed", ResourceLimits{MaxCollectionLen: 1}, `[1, 2`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.lim.CheckJSON([]byte(tt.text))
+			var le ResourceLimitError
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if !errors.As(err, &le) || le != *tt.want {
+				t.Errorf("expected %v, got: %v", *tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValueSize(t *testing.T) {
+	d := starlark.NewDict(1)
+	_ = d.SetKey(starlark.String("key"), starlark.Tuple{starlark.Bytes("ab"), starlark.True})
+	cyclic := starlark.NewList(nil)
+	_ = cyclic.Append(cyclic)
+	tests := []struct {
+		v    starlark.Value
+		want int
+	}{
+		{starlark.String("hello"), 5},
+		{starlark.MakeInt(1), 8},
+		{d, 8 + 3 + (8 + 2 + 8)},
+		{cyclic, 8 + 8},
+	}
+	for _, tt := range tests {
+		if got := ValueSize(tt.v); got != tt.want {
+			t.Errorf("ValueSize(%v) = %d, want %d", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestLimitResult(t *testing.T) {
+	fn := LimitResult(func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		return args[0], nil
+	})
+	b := starlark.NewBuiltin("echo", fn)
+	thread := &starlark.Thread{}
+	if GetThreadResourceLimits(thread) != nil || GetThreadResourceLimits(nil) != nil {
+		t.Errorf("expected no limits")
+	}
+	if _, err := starlark.Call(thread, b, starlark.Tuple{starlark.String("abc")}, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	SetThreadResourceLimits(thread, &ResourceLimits{MaxStringLen: 2})
+	_, err := starlark.Call(thread, b, starlark.Tuple{starlark.String("abc")}, nil)
+	var le ResourceLimitError
+	if !errors.As(err, &le) || err.Error() != "echo: string of size 3 exceeds the limit of 2" {
+		t.Errorf("expected ResourceLimitError, got: %v", err)
+	}
+
+	SetThreadResourceLimits(thread, nil)
+	if GetThreadResourceLimits(thread) != nil {
+		t.Errorf("expected the limits removed")
+	}
+}
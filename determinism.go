@@ -0,0 +1,43 @@
+package starlet
+
+import (
+	"time"
+
+	"github.com/1set/starlet/dataconv"
+)
+
+// deterministic is the setting of the deterministic mode of a Machine, see EnableDeterministic.
+type deterministic struct {
+	start time.Time
+	seed  int64
+}
+
+// EnableDeterministic makes the runs of the machine reproducible, by replacing the wall clock with a virtual clock starting at the given time, and the cryptographic randomness with a pseudo-random generator seeded with the given value.
+//
+// The virtual clock stands still unless a script sleeps: time.now() returns its time, go_idiomatic.sleep() advances it at once instead of blocking, and runtime.uptime() returns how far it advanced. All functions of the random module, including uuid(), draw from the seeded generator.
+// Both are carried by the thread-locals of the machine, so concurrent machines stay independent, and they are reset at the start of each run, so the same script with the same input yields the same output on every run. Calls made by Call after a run continue from where the run left off.
+func (m *Machine) EnableDeterministic(start time.Time, seed int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.determ = &deterministic{start: start, seed: seed}
+}
+
+// DisableDeterministic disables the deterministic mode enabled by EnableDeterministic from the next run.
+func (m *Machine) DisableDeterministic() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.determ = nil
+}
+
+// applyDeterminism sets up a fresh virtual clock and seeded generator on the main thread for a run, or removes them if the deterministic mode is off.
+func (m *Machine) applyDeterminism() {
+	if d := m.determ; d != nil {
+		dataconv.SetThreadClock(m.thread, dataconv.NewVirtualClock(d.start))
+		dataconv.SetThreadRandReader(m.thread, dataconv.NewSeededReader(d.seed))
+	} else {
+		dataconv.SetThreadClock(m.thread, nil)
+		dataconv.SetThreadRandReader(m.thread, nil)
+	}
+}
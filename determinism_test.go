@@ -0,0 +1,80 @@
+package starlet_test
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/1set/starlet"
+)
+
+func TestMachine_EnableDeterministic(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.star": &fstest.MapFile{Data: []byte(`
+load("random", "randint", "random", "uuid", "choice", "shuffle", "randstr")
+load("go_idiomatic", "sleep")
+load("runtime", "uptime")
+load("lib", "token")
+t0 = time.now()
+sleep(0.25)
+t1 = time.now()
+up = uptime()
+ns = [randint(0, 1000000), random(), uuid(), choice("abcdef"), randstr("xyz", 8), token]
+seq = [1, 2, 3, 4, 5, 6, 7, 8]
+shuffle(seq)
+out = {"t0": str(t0), "t1": str(t1), "up": str(up), "ns": ns, "seq": seq}
+`)},
+		"lib.star": &fstest.MapFile{Data: []byte(`
+load("random", "uuid")
+token = uuid()
+`)},
+	}
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	newMachine := func(seed int64) *starlet.Machine {
+		m := starlet.NewWithNames(nil, []string{"time"}, []string{"random", "go_idiomatic", "runtime"})
+		m.SetScript("main.star", nil, fsys)
+		m.EnableDeterministic(start, seed)
+		return m
+	}
+	run := func(m *starlet.Machine) map[interface{}]interface{} {
+		t.Helper()
+		res, err := m.Run()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return res["out"].(map[interface{}]interface{})
+	}
+
+	// the clock is virtual
+	m := newMachine(42)
+	began := time.Now()
+	out1 := run(m)
+	if time.Since(began) > time.Second {
+		t.Errorf("expected sleep not to block")
+	}
+	if out1["t0"] != `2020-01-02 03:04:05 +0000 UTC` || out1["t1"] != `2020-01-02 03:04:05.25 +0000 UTC` || out1["up"] != `250ms` {
+		t.Errorf("unexpected clock: %v, %v, %v", out1["t0"], out1["t1"], out1["up"])
+	}
+
+	// another run of the same machine, and another machine with the same seed, yield the same
+	m.Reset()
+	if out2 := run(m); !reflect.DeepEqual(out1, out2) {
+		t.Errorf("expected the same output in another run, got:\n%v\n%v", out1, out2)
+	}
+	if out3 := run(newMachine(42)); !reflect.DeepEqual(out1, out3) {
+		t.Errorf("expected the same output with the same seed, got:\n%v\n%v", out1, out3)
+	}
+
+	// another seed yields differently
+	if out4 := run(newMachine(7)); reflect.DeepEqual(out1["ns"], out4["ns"]) {
+		t.Errorf("expected different output with another seed, got: %v", out4["ns"])
+	}
+
+	// no longer deterministic after disabled
+	m = newMachine(42)
+	m.DisableDeterministic()
+	if out5 := run(m); out5["t0"] == out1["t0"] || reflect.DeepEqual(out1["ns"], out5["ns"]) {
+		t.Errorf("expected the wall clock and random output, got: %v", out5)
+	}
+}
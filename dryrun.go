@@ -0,0 +1,242 @@
+package starlet
+
+import (
+	"strings"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Effect is an effect a script intends to have on the host, collected in the dry-run mode instead of taking place, see EnableDryRun.
+type Effect struct {
+	Name     string // name the builtin is bound to, e.g. "file.write_string"
+	Args     string // arguments of the call, e.g. `"out.txt", "hello"`
+	Position string // where the script makes the call, e.g. "main.star:3:1", or empty if unknown
+}
+
+// String returns the effect in the form of "position: name(args)".
+func (e Effect) String() string {
+	call := traceCall(e.Name, e.Args)
+	if e.Position == "" {
+		return call
+	}
+	return e.Position + ": " + call
+}
+
+// dryRun collects the effects of a run in the dry-run mode.
+type dryRun struct {
+	mu      sync.Mutex
+	effects []Effect
+}
+
+// EnableDryRun enables the dry-run mode: the builtins mutating the host record the effects they intend to have and return plausible stand-in values instead of taking effect. The effects are collected for each run, see EffectPlan.
+//
+// The mutating builtins are the writes and appends of the file module and file.copyfile, path.mkdir and path.chdir, runtime.setenv, runtime.putenv and runtime.unsetenv, and the http requests other than GET. Other builtins, including the reading ones, are called as usual, so a script reading what it would have written sees the host as it is.
+// Unlike the record mode, it takes effect at once, even for the modules already loaded.
+func (m *Machine) EnableDryRun() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dryRun = &dryRun{}
+}
+
+// DisableDryRun disables the dry-run mode enabled by EnableDryRun, the mutating builtins take effect again from then on.
+func (m *Machine) DisableDryRun() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dryRun = nil
+}
+
+// EffectPlan returns the effects collected by the last run or the calls after it in the dry-run mode, in the order they are intended, or nil if the mode is off.
+func (m *Machine) EffectPlan() []Effect {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	d := m.dryRun
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Effect(nil), d.effects...)
+}
+
+// resetDryRun clears the effects collected by the previous run.
+func (m *Machine) resetDryRun() {
+	if d := m.dryRun; d != nil {
+		d.mu.Lock()
+		d.effects = nil
+		d.mu.Unlock()
+	}
+}
+
+// dryRunStub returns the stand-in value of a mutating builtin call, and false if the call is not mutating, e.g. a GET request by http.call.
+type dryRunStub func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, bool)
+
+// dryRunStubs maps the bound names of the mutating builtins to their stubs, and dryRunModules has the names of their modules.
+var (
+	dryRunStubs   = makeDryRunStubs()
+	dryRunModules = map[string]bool{"file": true, "path": true, "runtime": true, "http": true}
+)
+
+func makeDryRunStubs() map[string]dryRunStub {
+	none := func(starlark.Tuple, []starlark.Tuple) (starlark.Value, bool) {
+		return starlark.None, true
+	}
+	stubs := map[string]dryRunStub{
+		"file.copyfile": func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, bool) {
+			// the destination it would copy to
+			if dst := dryRunArg(args, kwargs, 1, "dst"); dst != nil {
+				return dst, true
+			}
+			return starlark.None, true
+		},
+		"path.mkdir":       none,
+		"path.chdir":       none,
+		"runtime.setenv":   none,
+		"runtime.putenv":   none,
+		"runtime.unsetenv": none,
+	}
+	for _, kind := range []string{"bytes", "string", "lines", "json", "jsonl"} {
+		stubs["file.write_"+kind] = none
+		stubs["file.append_"+kind] = none
+	}
+	for _, method := range []string{"put", "post", "postForm", "delete", "head", "patch", "options"} {
+		stubs["http."+method] = func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, bool) {
+			return dryRunResponse(dryRunArg(args, kwargs, 0, "url")), true
+		}
+		stubs["http.try_"+method] = func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, bool) {
+			return starlark.Tuple{dryRunResponse(dryRunArg(args, kwargs, 0, "url")), starlark.None}, true
+		}
+	}
+	isGet := func(args starlark.Tuple) bool {
+		if len(args) == 0 {
+			return true // fails as usual
+		}
+		method, ok := starlark.AsString(args[0])
+		return !ok || strings.EqualFold(method, "get")
+	}
+	stubs["http.call"] = func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, bool) {
+		if isGet(args) {
+			return nil, false
+		}
+		return dryRunResponse(dryRunArg(args[1:], kwargs, 0, "url")), true
+	}
+	stubs["http.try_call"] = func(args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, bool) {
+		if isGet(args) {
+			return nil, false
+		}
+		return starlark.Tuple{dryRunResponse(dryRunArg(args[1:], kwargs, 0, "url")), starlark.None}, true
+	}
+	return stubs
+}
+
+// dryRunArg returns the argument at the position or of the keyword, or nil if not given.
+func dryRunArg(args starlark.Tuple, kwargs []starlark.Tuple, pos int, name string) starlark.Value {
+	if pos < len(args) {
+		return args[pos]
+	}
+	for _, kv := range kwargs {
+		if k, ok := starlark.AsString(kv[0]); ok && k == name {
+			return kv[1]
+		}
+	}
+	return nil
+}
+
+// dryRunResponse returns a stand-in of a successful empty response of the http module.
+func dryRunResponse(url starlark.Value) *starlarkstruct.Struct {
+	if url == nil {
+		url = starlark.String("")
+	}
+	emptyBody := func(v starlark.Value) func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+		return func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+			return v, nil
+		}
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"url":         url,
+		"status_code": starlark.MakeInt(200),
+		"ok":          starlark.True,
+		"headers":     starlark.NewDict(0),
+		"encoding":    starlark.String(""),
+		"body":        starlark.NewBuiltin("body", emptyBody(starlark.String(""))),
+		"json":        starlark.NewBuiltin("json", emptyBody(starlark.None)),
+		"try_body":    starlark.NewBuiltin("try_body", emptyBody(starlark.Tuple{starlark.String(""), starlark.None})),
+		"try_json":    starlark.NewBuiltin("try_json", emptyBody(starlark.Tuple{starlark.None, starlark.None})),
+	})
+}
+
+// dryRunDict wraps the mutating builtins in the dict for the dry-run mode, each member is classified by the module it comes from in origin, or by its own name as a module.
+func (m *Machine) dryRunDict(d starlark.StringDict, origin map[string]string) {
+	for k, v := range d {
+		module := k
+		if o, ok := origin[k]; ok {
+			module = o
+		}
+		if dryRunModules[module] {
+			d[k] = mapBuiltins(k, v, m.dryRunBuiltin(k, module))
+		}
+	}
+}
+
+// dryRunLoader wraps the lazy loader so the mutating builtins of the loaded modules are wrapped for the dry-run mode.
+func (m *Machine) dryRunLoader(ld NamedModuleLoader) NamedModuleLoader {
+	return func(s string) (starlark.StringDict, error) {
+		d, err := ld(s)
+		if err != nil || d == nil || !dryRunModules[s] {
+			return d, err
+		}
+		// copy to keep the dicts owned by the module intact
+		nd := make(starlark.StringDict, len(d))
+		for k, v := range d {
+			nd[k] = mapBuiltins(s+"."+k, v, m.dryRunBuiltin(s, s))
+		}
+		return nd, nil
+	}
+}
+
+// dryRunBuiltin returns a wrapper of the builtins of the given module bound to the given name, which returns the stand-in value and records the effect in the dry-run mode, if it's a mutating one.
+// The stub is found by the name in the module, i.e. the name relative to the bound one, or the bound name itself for a builtin of the module bound directly, while the effect has the name the builtin is bound to.
+// The mode is checked on each call, so the builtins are wrapped whether it's enabled or not.
+func (m *Machine) dryRunBuiltin(bound, module string) func(name string, b *starlark.Builtin) *starlark.Builtin {
+	return func(name string, b *starlark.Builtin) *starlark.Builtin {
+		rel := strings.TrimPrefix(name, bound)
+		if rel == "" {
+			rel = "." + name
+		}
+		stub, ok := dryRunStubs[module+rel]
+		if !ok {
+			return b
+		}
+		return m.dryRunStubBuiltin(name, b, stub)
+	}
+}
+
+// dryRunStubBuiltin wraps the builtin bound to the given name with its stub.
+func (m *Machine) dryRunStubBuiltin(name string, b *starlark.Builtin, stub dryRunStub) *starlark.Builtin {
+	w := starlark.NewBuiltin(b.Name(), func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		d := m.dryRun
+		if d == nil {
+			return b.CallInternal(thread, args, kwargs)
+		}
+		res, ok := stub(args, kwargs)
+		if !ok {
+			return b.CallInternal(thread, args, kwargs)
+		}
+		e := Effect{Name: name, Args: traceArgs(args, kwargs)}
+		if thread.CallStackDepth() > 1 {
+			e.Position = thread.CallFrame(1).Pos.String()
+		}
+		d.mu.Lock()
+		d.effects = append(d.effects, e)
+		d.mu.Unlock()
+		return res, nil
+	})
+	if recv := b.Receiver(); recv != nil {
+		w = w.BindReceiver(recv)
+	}
+	return w
+}
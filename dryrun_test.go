@@ -0,0 +1,125 @@
+package starlet_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/1set/starlet"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+func TestMachine_EnableDryRun(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "out.txt")
+	script := `
+load("file", "write_string", "append_lines", "copyfile", "read_string")
+load("path", "mkdir", "exists")
+load("runtime", "setenv", "getenv")
+write_string(target, "hello")
+append_lines(target, ["a", "b"])
+dst = copyfile(target, target + ".bak")
+mkdir(sub)
+setenv("STARLET_DRY_RUN_TEST", "1")
+resp = http.post("http://127.0.0.1:1/api", json_body={"k": 1})
+_, err = http.try_call("DELETE", url="http://127.0.0.1:1/api")
+out = [dst, exists(sub), getenv("STARLET_DRY_RUN_TEST"), resp.status_code, resp.body(), err]
+`
+	m := starlet.NewWithNames(starlet.StringAnyMap{"target": target, "sub": filepath.Join(dir, "sub")}, []string{"http"}, []string{"file", "path", "runtime"})
+	m.SetScript("test.star", []byte(script), nil)
+	m.EnableDryRun()
+	res, err := m.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// stand-in values, and nothing changed on the host
+	want := []interface{}{target + ".bak", false, nil, int64(200), "", nil}
+	if !reflect.DeepEqual(res["out"], want) {
+		t.Errorf("expected %v, got: %v", want, res["out"])
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("expected no file written, got: %v", err)
+	}
+	if v, ok := os.LookupEnv("STARLET_DRY_RUN_TEST"); ok {
+		t.Errorf("expected no environment variable set, got: %q", v)
+	}
+
+	// the effect plan
+	var got []string
+	for _, e := range m.EffectPlan() {
+		got = append(got, e.String())
+	}
+	expectStrings(t, "effects", got, []string{
+		`test.star:5:13: file.write_string("` + target + `", "hello")`,
+		`test.star:6:13: file.append_lines("` + target + `", ["a", "b"])`,
+		`test.star:7:15: file.copyfile("` + target + `", "` + target + `.bak")`,
+		`test.star:8:6: path.mkdir("` + filepath.Join(dir, "sub") + `")`,
+		`test.star:9:7: runtime.setenv("STARLET_DRY_RUN_TEST", "1")`,
+		`test.star:10:17: http.post("http://127.0.0.1:1/api", json_body={"k": 1})`,
+		`test.star:11:23: http.try_call("DELETE", url="http://127.0.0.1:1/api")`,
+	})
+
+	// the plan is of the last run only
+	m.SetScript("test.star", []byte(`load("file", "write_string"); write_string(target, "again")`), nil)
+	if _, err := m.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plan := m.EffectPlan(); len(plan) != 1 || plan[0].Name != "file.write_string" {
+		t.Errorf("expected the effects of the last run, got: %v", plan)
+	}
+
+	// takes effect at once after disabled
+	m.DisableDryRun()
+	if _, err := m.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, err := os.ReadFile(target); err != nil || string(b) != "again" {
+		t.Errorf("expected file written, got: %q, %v", b, err)
+	}
+	if plan := m.EffectPlan(); plan != nil {
+		t.Errorf("expected no plan, got: %v", plan)
+	}
+}
+
+func TestMachine_EnableDryRun_Origin(t *testing.T) {
+	var calls []string
+	record := func(name string) *starlark.Builtin {
+		return starlark.NewBuiltin(name, func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+			calls = append(calls, name)
+			return starlark.True, nil
+		})
+	}
+	reg := starlet.NewModuleRegistry()
+	// a module binding a struct named like the file module, and the file module binding its builtins directly
+	if err := reg.Register("notes", func() (starlark.StringDict, error) {
+		return starlark.StringDict{"file": starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{"write_string": record("notes")})}, nil
+	}, starlet.CapPure, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := reg.Register("file", func() (starlark.StringDict, error) {
+		return starlark.StringDict{"write_string": record("file")}, nil
+	}, starlet.CapFileSystem, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m, err := reg.NewMachine(nil, []string{"notes", "file"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m.SetScript("test.star", []byte("a = file.write_string('x', 'y')\nb = write_string('x', 'y')\n"), nil)
+	m.EnableDryRun()
+	res, err := m.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// stubbed by the module the builtins come from, not the names they're bound to
+	if !reflect.DeepEqual(calls, []string{"notes"}) || res["a"] != true || res["b"] != nil {
+		t.Errorf("expected only the builtin of notes called, got: %v, %v", calls, res)
+	}
+	if plan := m.EffectPlan(); len(plan) != 1 || plan[0].String() != `test.star:2:17: write_string("x", "y")` {
+		t.Errorf("expected the effect of the file module, got: %v", plan)
+	}
+}
@@ -12,6 +12,10 @@ type ExecError struct {
 	act   string // error happens when doing this action
 	cause error  // the cause of the error
 	hint  string // additional hint for the error
+	// snippet is the source line the error happens at with a caret, see Diagnostics
+	snippet string
+	// suggestion is the name suggested for a misspelled one in the cause, see Suggestion
+	suggestion string
 }
 
 // Unwrap returns the cause of the error.
@@ -19,6 +23,26 @@ func (e ExecError) Unwrap() error {
 	return e.cause
 }
 
+// Package returns the name of the dependency package or component the error comes from, e.g. "starlark" or "starlet".
+func (e ExecError) Package() string {
+	return e.pkg
+}
+
+// Action returns the action during which the error happens, e.g. "exec" or "convert extras".
+func (e ExecError) Action() string {
+	return e.act
+}
+
+// Cause returns the cause of the error, same as Unwrap.
+func (e ExecError) Cause() error {
+	return e.cause
+}
+
+// Hint returns the additional hint for the error, e.g. the backtrace of a Starlark evaluation error, or empty if none.
+func (e ExecError) Hint() string {
+	return e.hint
+}
+
 // Error returns the error message.
 func (e ExecError) Error() string {
 	s := fmt.Sprintf("%s: %s: %v", e.pkg, e.act, e.cause)
@@ -30,6 +54,17 @@ func (e ExecError) Error() string {
 
 // helper functions
 
+// errorRecovered creates an ExecError from a value recovered from an execution, keeping the typed errors raised as panics by the limits of the machine.
+func errorRecovered(action string, v interface{}) ExecError {
+	switch e := v.(type) {
+	case MaxStepsExceededError:
+		return errorStarlarkError(action, e)
+	case MaxPrintExceededError:
+		return errorStarlarkError(action, e)
+	}
+	return errorStarlarkPanic(action, v)
+}
+
 // errorStarlarkPanic creates an ExecError from a recovered panic value.
 func errorStarlarkPanic(action string, v interface{}) ExecError {
 	return ExecError{
@@ -51,10 +86,11 @@ func errorStarlarkError(action string, err error) ExecError {
 		hint = se.Backtrace()
 	}
 	return ExecError{
-		pkg:   `starlark`,
-		act:   action,
-		cause: err,
-		hint:  hint,
+		pkg:        `starlark`,
+		act:        action,
+		cause:      err,
+		hint:       hint,
+		suggestion: suggestionOf(err),
 	}
 }
 
@@ -93,18 +129,29 @@ func errorStarlightConvert(target string, err error) ExecError {
 	}
 }
 
+// errorDataconvDecode creates an ExecError for dataconv decoding into Go values.
+func errorDataconvDecode(target string, err error) ExecError {
+	return ExecError{
+		pkg:   `dataconv`,
+		act:   fmt.Sprintf("decode %s", target),
+		cause: err,
+	}
+}
+
 // ModuleNotFoundError is returned by load() when the named module is not
 // present in any source available to the machine: it is neither a builtin
 // or custom loader configured for this machine, nor a script file on the
 // configured filesystem. Hosts can detect it with errors.As through the
-// Starlark error chain.
+// Starlark error chain. DidYouMean is the name of an available module close
+// to the misspelled one, or empty if none is.
 type ModuleNotFoundError struct {
-	Name string
+	Name       string
+	DidYouMean string
 }
 
 // Error returns the error message.
 func (e ModuleNotFoundError) Error() string {
-	return fmt.Sprintf("module %q not found in builtin modules, custom loaders, or the script filesystem", e.Name)
+	return fmt.Sprintf("module %q not found in builtin modules, custom loaders, or the script filesystem", e.Name) + didYouMean(e.DidYouMean)
 }
 
 // ModuleWithheldError marks a module that exists but is deliberately not
@@ -112,14 +159,40 @@ func (e ModuleNotFoundError) Error() string {
 // enabled, or a module blocked by a host-side policy layer (which can
 // return this type from its own loaders). It lets hosts and script authors
 // tell a misspelled module apart from a forbidden one; detect it with
-// errors.As through the Starlark error chain.
+// errors.As through the Starlark error chain. DidYouMean is the name of an
+// available module close to the withheld one, or empty if none is.
 type ModuleWithheldError struct {
-	Name string
+	Name       string
+	DidYouMean string
 }
 
 // Error returns the error message.
 func (e ModuleWithheldError) Error() string {
-	return fmt.Sprintf("module %q is withheld and not available to this machine", e.Name)
+	return fmt.Sprintf("module %q is withheld and not available to this machine", e.Name) + didYouMean(e.DidYouMean)
+}
+
+// didYouMean formats the suggestion of a name for an error message, in the same form as Starlark.
+func didYouMean(name string) string {
+	if name == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %s?)", name)
+}
+
+// ModuleDeniedError marks a module refused by the capability policy of the
+// machine (see Machine.SetCapabilityPolicy): the module is available, but it
+// can touch something on the host the policy denies. Capability holds the
+// denied part of the module's capability set. Unlike ModuleWithheldError it
+// is raised for preload modules as well; detect it with errors.As through
+// the execution error chain.
+type ModuleDeniedError struct {
+	Name       string
+	Capability ModuleCapability
+}
+
+// Error returns the error message.
+func (e ModuleDeniedError) Error() string {
+	return fmt.Sprintf("module %q is denied by the capability policy: requires %v", e.Name, e.Capability)
 }
 
 // MaxStepsExceededError marks an execution aborted because it exhausted the
@@ -133,3 +206,16 @@ type MaxStepsExceededError struct {
 func (e MaxStepsExceededError) Error() string {
 	return fmt.Sprintf("execution exceeded the step limit (%d)", e.Limit)
 }
+
+// MaxPrintExceededError marks an execution aborted because its printed
+// output exceeded a limit configured with Machine.SetPrintLimits. Detect it
+// with errors.As through the execution error chain.
+type MaxPrintExceededError struct {
+	Limit uint64
+	Unit  string // "bytes" or "lines"
+}
+
+// Error returns the error message.
+func (e MaxPrintExceededError) Error() string {
+	return fmt.Sprintf("execution exceeded the print limit (%d %s)", e.Limit, e.Unit)
+}
@@ -0,0 +1,157 @@
+package starlet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// ErrorFrame locates a frame of the call stack leading to an error.
+type ErrorFrame struct {
+	File     string `json:"file"`
+	Line     int32  `json:"line"`
+	Column   int32  `json:"column"`
+	Function string `json:"function,omitempty"`
+}
+
+// ErrorDiagnostics is the structured form of an ExecError for tools and user interfaces.
+type ErrorDiagnostics struct {
+	Package    string       `json:"package"`
+	Action     string       `json:"action"`
+	Message    string       `json:"message"`
+	Frames     []ErrorFrame `json:"frames"`
+	Snippet    string       `json:"snippet,omitempty"`
+	Suggestion string       `json:"suggestion,omitempty"`
+}
+
+// Diagnostics returns the structured form of the error.
+//
+// The frames are parsed from the Starlark evaluation error, syntax error or resolve errors in the cause chain, ordered from the innermost one, i.e. where the error happens, to the outermost one; they are empty if the error has no position, e.g. a conversion error.
+// The snippet is the failing line of the innermost frame in a source file, with a caret under the column, if the source is available to the machine reporting the error.
+// The suggestion is the name suggested for a misspelled one, see Suggestion.
+func (e ExecError) Diagnostics() ErrorDiagnostics {
+	d := ErrorDiagnostics{
+		Package:    e.pkg,
+		Action:     e.act,
+		Frames:     errorFrames(e.cause),
+		Snippet:    e.snippet,
+		Suggestion: e.Suggestion(),
+	}
+	if e.cause != nil {
+		d.Message = e.cause.Error()
+	}
+	if d.Frames == nil {
+		d.Frames = []ErrorFrame{}
+	}
+	return d
+}
+
+// MarshalJSON encodes the error as its Diagnostics, the layout is stable across releases.
+func (e ExecError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.Diagnostics())
+}
+
+// errorFrames extracts the frames from the cause chain of an error, innermost first.
+func errorFrames(err error) []ErrorFrame {
+	var (
+		ee *starlark.EvalError
+		se syntax.Error
+		sp *syntax.Error
+		rl resolve.ErrorList
+	)
+	switch {
+	case errors.As(err, &ee):
+		frames := make([]ErrorFrame, 0, len(ee.CallStack))
+		for i := range ee.CallStack {
+			fr := ee.CallStack.At(i)
+			frames = append(frames, ErrorFrame{
+				File:     fr.Pos.Filename(),
+				Line:     fr.Pos.Line,
+				Column:   fr.Pos.Col,
+				Function: fr.Name,
+			})
+		}
+		return frames
+	case errors.As(err, &se):
+		return []ErrorFrame{positionFrame(se.Pos)}
+	case errors.As(err, &sp):
+		return []ErrorFrame{positionFrame(sp.Pos)}
+	case errors.As(err, &rl) && len(rl) > 0:
+		return []ErrorFrame{positionFrame(rl[0].Pos)}
+	}
+	return nil
+}
+
+func positionFrame(pos syntax.Position) ErrorFrame {
+	return ErrorFrame{File: pos.Filename(), Line: pos.Line, Column: pos.Col}
+}
+
+// builtinFilename is the filename of the frames of builtins in Starlark call stacks.
+const builtinFilename = "<builtin>"
+
+// annotateError attaches the snippet of the failing source line to an ExecError with positions, reading the source from the script or the filesystems of the machine.
+// Other errors are returned as they are.
+func (m *Machine) annotateError(err error) error {
+	e, ok := err.(ExecError)
+	if !ok || e.snippet != "" {
+		return err
+	}
+	for _, fr := range errorFrames(e.cause) {
+		if fr.File == builtinFilename || fr.Line <= 0 {
+			continue
+		}
+		if src := m.sourceOf(fr.File); src != nil {
+			e.snippet = makeSnippet(src, fr.Line, fr.Column)
+		}
+		break
+	}
+	return e
+}
+
+// sourceOf returns the source of the script or a loaded module file by the filename of its frames, or nil if it's not available.
+func (m *Machine) sourceOf(filename string) []byte {
+	if name, src, _, err := m.readScript("source"); err == nil && name == filename {
+		return src
+	}
+	if b, err := readScriptFile(filename, m.getLoadFS()); err == nil {
+		return b
+	}
+	return nil
+}
+
+// makeSnippet renders the given line of the source with its number, and a caret under the 1-based column, e.g.:
+//
+//	3 | x = foo(1)
+//	  |     ^
+//
+// It returns empty if the line is out of range.
+func makeSnippet(src []byte, line, col int32) string {
+	lines := bytes.Split(src, []byte("\n"))
+	if line < 1 || int(line) > len(lines) {
+		return ""
+	}
+	text := strings.TrimRight(string(lines[line-1]), "\r")
+	num := fmt.Sprintf("%d", line)
+	pad := strings.Repeat(" ", len(num))
+
+	// keep tabs in the prefix so the caret lines up with the text
+	var caret strings.Builder
+	for i, r := range []rune(text) {
+		if int32(i) >= col-1 {
+			break
+		}
+		if r == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+	return fmt.Sprintf("%s | %s\n%s | %s", num, text, pad, caret.String())
+}
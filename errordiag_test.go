@@ -0,0 +1,130 @@
+package starlet_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/1set/starlet"
+)
+
+func TestExecError_Accessors(t *testing.T) {
+	m := starlet.NewDefault()
+	m.SetScript("test.star", []byte(`fail("oops")`), nil)
+	_, err := m.Run()
+	var e starlet.ExecError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected ExecError, got: %v", err)
+	}
+	if e.Package() != "starlark" || e.Action() != "exec" {
+		t.Errorf("unexpected package or action: %q, %q", e.Package(), e.Action())
+	}
+	if e.Cause() == nil || e.Cause() != e.Unwrap() || e.Cause().Error() != "fail: oops" {
+		t.Errorf("unexpected cause: %v", e.Cause())
+	}
+	if e.Hint() == "" {
+		t.Errorf("expected a backtrace as hint")
+	}
+}
+
+func TestExecError_Diagnostics(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib.star": &fstest.MapFile{Data: []byte("def div(a, b):\n\treturn a // b\n")},
+	}
+	tests := []struct {
+		name   string
+		script string
+		want   starlet.ErrorDiagnostics
+	}{
+		{
+			name:   "eval error in loaded module",
+			script: "load(\"lib\", \"div\")\ndef f():\n    return div(1, 0)\nx = f()\n",
+			want: starlet.ErrorDiagnostics{
+				Package: "starlark",
+				Action:  "exec",
+				Message: "floored division by zero",
+				Frames: []starlet.ErrorFrame{
+					{File: "lib", Line: 2, Column: 11, Function: "div"},
+					{File: "test.star", Line: 3, Column: 15, Function: "f"},
+					{File: "test.star", Line: 4, Column: 6, Function: "<toplevel>"},
+				},
+				Snippet: "2 | \treturn a // b\n  | \t         ^",
+			},
+		},
+		{
+			name:   "error in builtin",
+			script: "x = 1\ny = len(x)\n",
+			want: starlet.ErrorDiagnostics{
+				Package: "starlark",
+				Action:  "exec",
+				Message: "len: value of type int has no len",
+				Frames: []starlet.ErrorFrame{
+					{File: "<builtin>", Function: "len"},
+					{File: "test.star", Line: 2, Column: 8, Function: "<toplevel>"},
+				},
+				Snippet: "2 | y = len(x)\n  |        ^",
+			},
+		},
+		{
+			name:   "syntax error",
+			script: "x = 1\ny = (2,\n",
+			want: starlet.ErrorDiagnostics{
+				Package: "starlark",
+				Action:  "exec",
+				Message: "test.star:3:1: got end of file, want ')'",
+				Frames:  []starlet.ErrorFrame{{File: "test.star", Line: 3, Column: 1}},
+				Snippet: "3 | \n  | ^",
+			},
+		},
+		{
+			name:   "resolve error",
+			script: "x = 1\ny = z\n",
+			want: starlet.ErrorDiagnostics{
+				Package: "starlark",
+				Action:  "exec",
+				Message: "test.star:2:5: undefined: z",
+				Frames:  []starlet.ErrorFrame{{File: "test.star", Line: 2, Column: 5}},
+				Snippet: "2 | y = z\n  |     ^",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := starlet.NewDefault()
+			m.SetScript("test.star", []byte(tt.script), fsys)
+			_, err := m.Run()
+			var e starlet.ExecError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected ExecError, got: %v", err)
+			}
+			if got := e.Diagnostics(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unexpected diagnostics:\n got: %#v\nwant: %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecError_MarshalJSON(t *testing.T) {
+	m := starlet.NewDefault()
+	m.SetScript("test.star", []byte("x = 1 + \"a\"\n"), nil)
+	_, err := m.Run()
+	b, je := json.Marshal(err)
+	if je != nil {
+		t.Fatalf("unexpected error: %v", je)
+	}
+	want := `{"package":"starlark","action":"exec","message":"unknown binary op: int + string","frames":[{"file":"test.star","line":1,"column":7,"function":"\u003ctoplevel\u003e"}],"snippet":"1 | x = 1 + \"a\"\n  |       ^"}`
+	if string(b) != want {
+		t.Errorf("unexpected JSON:\n got: %s\nwant: %s", b, want)
+	}
+
+	// errors without positions have no frames
+	m = starlet.NewDefault()
+	_, err = m.Run()
+	b, _ = json.Marshal(err)
+	want = `{"package":"starlet","action":"run","message":"no script to execute","frames":[]}`
+	if string(b) != want {
+		t.Errorf("unexpected JSON:\n got: %s\nwant: %s", b, want)
+	}
+}
@@ -0,0 +1,142 @@
+package starlet
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/1set/starlight/convert"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+const (
+	// evalFilename is the filename of the expressions evaluated by Eval, in positions of errors.
+	evalFilename = "<expr>"
+	// evalResultName is the global holding the result of a compiled expression, it's not a valid identifier so it never clashes with names in the expression.
+	evalResultName = "<result>"
+)
+
+// Eval evaluates a Starlark expression, e.g. `order.total > 100 and user.tier == "gold"`, with the given local variables, and returns the result.
+// The expression runs without a context: it cannot be cancelled or time-bounded; use EvalWithContext for that.
+func (m *Machine) Eval(expr string, locals StringAnyMap) (interface{}, error) {
+	return m.EvalWithContext(nil, expr, locals)
+}
+
+// EvalWithContext evaluates a Starlark expression like Eval, but the evaluation is aborted when ctx is cancelled, matching CallWithContext semantics.
+//
+// The expression sees the predeclared variables of the machine, i.e. the globals, preload modules and the variables left by previous runs, and the locals converted like extras on top of them; it prepares the machine like the first run does if it has not run yet.
+// Like a run, it's bounded by the step budget, print and resource limits of the machine including MaxOutputSize for the result, its errors carry the suggestions and source snippets, and the result is converted to a Go value if the output conversion is enabled.
+// If the machine has a ByteCache, the compiled expressions are cached in it, keyed by the expression and the names it sees.
+func (m *Machine) EvalWithContext(ctx context.Context, expr string, locals StringAnyMap) (out interface{}, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = errorRecovered("eval", r)
+		}
+	}()
+
+	// prepare the thread for globals and preload modules, or reset it
+	if m.thread == nil {
+		if err = m.prepareThread(nil); err != nil {
+			return nil, err
+		}
+	} else {
+		m.thread.Uncancel()
+		m.applyStepBudget()
+		m.resetPrintOutput()
+		m.applyResourceLimits(m.thread)
+	}
+
+	// locals over predeclared
+	env := make(starlark.StringDict, len(m.predeclared)+len(locals))
+	for k, v := range m.predeclared {
+		env[k] = v
+	}
+	if len(locals) > 0 {
+		ld, err := m.convertInput(locals)
+		if err != nil {
+			return nil, errorStarlightConvert("locals", err)
+		}
+		m.bindDict(ld, nil)
+		for k, v := range ld {
+			env[k] = v
+		}
+	}
+
+	// wire the context
+	if ctx == nil {
+		m.thread.SetLocal("context", context.TODO())
+	} else {
+		if err := ctx.Err(); err != nil {
+			return nil, errorStarletError("eval", err)
+		}
+		m.thread.SetLocal("context", ctx)
+		stop := m.watchContextCancel(ctx)
+		defer stop()
+	}
+
+	// evaluate and convert, unless it's too large
+	res, err := m.evalExpr(expr, env)
+	if err != nil {
+		return nil, m.annotateError(errorStarlarkError("eval", hintUndefined(err, env)))
+	}
+	if le := m.checkOutputSize(starlark.StringDict{"": res}); le != nil {
+		return nil, errorStarletError("output", le)
+	}
+	if m.enableOutConv {
+		return convert.FromValue(res), nil
+	}
+	return res, nil
+}
+
+// evalExpr evaluates the expression with starlark.EvalOptions, or with its compiled program loaded from or saved to the cache if the machine has one.
+func (m *Machine) evalExpr(expr string, env starlark.StringDict) (starlark.Value, error) {
+	opts := m.getFileOptions()
+	if m.progCache == nil {
+		return starlark.EvalOptions(opts, m.thread, evalFilename, expr, env)
+	}
+
+	// a prefix keeps the expression apart from a file of the same content
+	key, _ := makeCacheKey(evalFilename, expr, env, opts)
+	key = "expr:" + key
+
+	var prog *starlark.Program
+	if cb, ok := m.progCache.Get(key); ok {
+		// if failed, compile it again
+		prog, _ = starlark.CompiledProgram(bytes.NewReader(cb))
+	}
+	if prog == nil {
+		e, err := opts.ParseExpr(evalFilename, expr, 0)
+		if err != nil {
+			return nil, err
+		}
+		// the expression is compiled as a file assigning it to the result
+		pos := syntax.Start(e)
+		f := &syntax.File{
+			Path:    evalFilename,
+			Options: opts,
+			Stmts: []syntax.Stmt{&syntax.AssignStmt{
+				OpPos: pos,
+				Op:    syntax.EQ,
+				LHS:   &syntax.Ident{NamePos: pos, Name: evalResultName},
+				RHS:   e,
+			}},
+		}
+		if prog, err = starlark.FileProgram(f, env.Has); err != nil {
+			return nil, err
+		}
+		buf := new(bytes.Buffer)
+		if err = prog.Write(buf); err != nil {
+			return nil, err
+		}
+		_ = m.progCache.Set(key, buf.Bytes())
+	}
+
+	g, err := prog.Init(m.thread, env)
+	if err != nil {
+		return nil, err
+	}
+	return g[evalResultName], nil
+}
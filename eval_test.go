@@ -0,0 +1,164 @@
+package starlet_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/1set/starlet"
+)
+
+func TestMachine_Eval(t *testing.T) {
+	type user struct {
+		Name string `starlark:"name"`
+		Tier string `starlark:"tier"`
+	}
+	m := starlet.NewWithNames(starlet.StringAnyMap{"threshold": 100}, []string{"json"}, nil)
+	m.SetMaxExecutionSteps(1000)
+
+	// before any run, with globals and preload modules
+	tests := []struct {
+		name    string
+		expr    string
+		locals  starlet.StringAnyMap
+		want    interface{}
+		wantErr string
+	}{
+		{
+			name: "arithmetic",
+			expr: "1 + 2 * 3",
+			want: int64(7),
+		},
+		{
+			name:   "rule",
+			expr:   `order["total"] > threshold and user.tier == "gold"`,
+			locals: starlet.StringAnyMap{"order": map[string]interface{}{"total": 120}, "user": &user{Name: "Ann", Tier: "gold"}},
+			want:   true,
+		},
+		{
+			name:   "local over global",
+			expr:   "threshold",
+			locals: starlet.StringAnyMap{"threshold": 5},
+			want:   int64(5),
+		},
+		{
+			name: "preload module",
+			expr: `json.encode([x * x for x in range(3)])`,
+			want: "[0,1,4]",
+		},
+		{
+			name:    "undefined",
+			expr:    "missing + 1",
+			wantErr: "starlark: eval: <expr>:1:1: undefined: missing",
+		},
+		{
+			name:    "misspelled",
+			expr:    "thresold + 1",
+			wantErr: "starlark: eval: <expr>:1:1: undefined: thresold (did you mean threshold?)",
+		},
+		{
+			name:    "statement",
+			expr:    "x = 1",
+			wantErr: "starlark: eval: <expr>:1:4: got '=' after expression, want EOF",
+		},
+		{
+			name:    "runtime error",
+			expr:    "1 // 0",
+			wantErr: "starlark: eval: floored division by zero",
+		},
+		{
+			name:    "step budget",
+			expr:    "[i for i in range(10000)]",
+			wantErr: "starlark: eval: execution exceeded the step limit (1000)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.Eval(tt.expr, tt.locals)
+			if tt.wantErr != "" {
+				expectErr(t, err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %v, got: %v", tt.want, got)
+			}
+		})
+	}
+
+	// after a run, with the variables left by it, and locals not kept
+	if _, err := m.RunScript([]byte("def double(n):\n    return n * 2\n"), nil); err != nil {
+		t.Fatalf("unexpected run error: %v", err)
+	}
+	if got, err := m.Eval("double(n)", starlet.StringAnyMap{"n": 21}); err != nil || got != int64(42) {
+		t.Errorf("expected 42, got: %v, %v", got, err)
+	}
+	_, err := m.Eval("n", nil)
+	expectErr(t, err, "starlark: eval: <expr>:1:1: undefined: n")
+
+	// the suggestion is kept like a run
+	_, err = m.Eval("doubel(1)", nil)
+	var e starlet.ExecError
+	if !errors.As(err, &e) || e.Suggestion() != "double" {
+		t.Errorf("expected suggestion double, got: %v", err)
+	}
+
+	// the result is bounded by the output size like a run
+	m.SetResourceLimits(starlet.ResourceLimits{MaxOutputSize: 100})
+	if _, err = m.Eval(`"a" * 50`, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	_, err = m.Eval(`["b" * 50, "c" * 50]`, nil)
+	var le starlet.ResourceLimitError
+	if !errors.As(err, &le) || le.Kind != "output" || le.Limit != 100 {
+		t.Errorf("expected ResourceLimitError of output, got: %v", err)
+	}
+	expectErr(t, err, "starlet: output: output of size")
+}
+
+func TestMachine_EvalWithContext(t *testing.T) {
+	m := starlet.NewDefault()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := m.EvalWithContext(ctx, "1", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled, got: %v", err)
+	}
+
+	// cancelled while evaluating
+	ctx, cancel = context.WithCancel(context.Background())
+	m = starlet.NewWithGlobals(starlet.StringAnyMap{"stop": func() { cancel() }})
+	defer cancel()
+	_, err = m.EvalWithContext(ctx, "[stop()] + [i for i in range(100000000)]", nil)
+	expectErr(t, err, "starlark: eval: Starlark computation cancelled: context cancelled")
+}
+
+func TestMachine_Eval_Cache(t *testing.T) {
+	cache := &countingCache{MemoryCache: starlet.NewMemoryCache()}
+	m := starlet.NewDefault()
+	m.SetScriptCache(cache)
+
+	for i, n := range []int{1, 2, 3} {
+		got, err := m.Eval("[x * n for x in range(3)]", starlet.StringAnyMap{"n": n})
+		if err != nil {
+			t.Fatalf("eval #%d expects no error, got: %v", i, err)
+		}
+		if s, ok := got.([]interface{}); !ok || len(s) != 3 || s[2] != int64(2*n) {
+			t.Errorf("eval #%d unexpected result: %v", i, got)
+		}
+	}
+	if cache.misses != 1 || cache.hits != 2 {
+		t.Errorf("expected 1 miss and 2 hits, got: %d, %d", cache.misses, cache.hits)
+	}
+
+	// other names compile again, and the errors are the same as without the cache
+	_, err := m.Eval("[x * n for x in range(3)]", nil)
+	expectErr(t, err, "starlark: eval: <expr>:1:6: undefined: n")
+	if cache.misses != 2 {
+		t.Errorf("expected 2 misses, got: %d", cache.misses)
+	}
+	_, err = m.Eval("1 // 0", nil)
+	expectErr(t, err, "starlark: eval: floored division by zero")
+}
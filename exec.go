@@ -10,6 +10,7 @@ import (
 
 	itn "github.com/1set/starlet/internal"
 	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
 )
 
 // execStarlarkFile executes a Starlark file with the given filename and source, and returns the global environment and any error encountered.
@@ -19,17 +20,21 @@ func (m *Machine) execStarlarkFile(filename string, src interface{}, allowCache
 	opts := m.getFileOptions()
 	thread := m.thread
 	predeclared := m.predeclared
-	hasCache := m.progCache != nil
 
 	// if cache is not enabled or not allowed, just execute the original source
-	if !hasCache || !allowCache {
+	if m.progCache == nil || !allowCache {
 		return starlark.ExecFileOptions(opts, thread, filename, src, predeclared)
 	}
+	return execCachedFile(m.progCache, opts, thread, filename, src, predeclared)
+}
 
+// execCachedFile executes a Starlark file like starlark.ExecFileOptions, but it loads the compiled program from the given cache first, and saves the compiled program to the cache after compilation.
+// It's shared by the main script and the modules executed by load(), so both use the same cache key scheme.
+func execCachedFile(progCache ByteCache, opts *syntax.FileOptions, thread *starlark.Thread, filename string, src interface{}, predeclared starlark.StringDict) (starlark.StringDict, error) {
 	// for compiled program and cache key; sources that cannot be
 	// content-keyed (e.g. an io.Reader) are executed without the cache
 	// rather than risking a stale hit on a filename-only key
-	key, ok := m.getCacheKey(src)
+	key, ok := makeCacheKey(filename, src, predeclared, opts)
 	if !ok {
 		return starlark.ExecFileOptions(opts, thread, filename, src, predeclared)
 	}
@@ -38,15 +43,12 @@ func (m *Machine) execStarlarkFile(filename string, src interface{}, allowCache
 		err  error
 	)
 
-	// try to load compiled program from cache first
-	if hasCache {
-		// if cache is enabled, try to load compiled bytes from cache first
-		if cb, ok := m.progCache.Get(key); ok {
-			// load program from compiled bytes
-			if prog, err = starlark.CompiledProgram(bytes.NewReader(cb)); err != nil {
-				// if failed, remove the result and continue
-				prog = nil
-			}
+	// try to load compiled bytes from cache first
+	if cb, ok := progCache.Get(key); ok {
+		// load program from compiled bytes
+		if prog, err = starlark.CompiledProgram(bytes.NewReader(cb)); err != nil {
+			// if failed, remove the result and continue
+			prog = nil
 		}
 	}
 
@@ -62,7 +64,7 @@ func (m *Machine) execStarlarkFile(filename string, src interface{}, allowCache
 			return nil, err
 		}
 		// save the compiled bytes to cache
-		_ = m.progCache.Set(key, buf.Bytes())
+		_ = progCache.Set(key, buf.Bytes())
 	}
 
 	// execute the compiled program
@@ -82,13 +84,21 @@ func (m *Machine) execStarlarkFile(filename string, src interface{}, allowCache
 //     source that must not compile;
 //   - the dialect bits (recursion / global-reassign FileOptions), which
 //     gate parsing and resolution;
+//   - the filename, which the compiled program records in the positions of
+//     its errors and backtraces, so two files of identical content must not
+//     share one program reporting the positions of the first;
 //   - the source content. An io.Reader source used to fall back to a
 //     filename-only key, so identical names with different content
 //     collided — such sources now report ok=false and skip the cache.
 //
 // The key layout is internal and may change between releases; persisted
 // caches then miss once and recompile.
-func (m *Machine) getCacheKey(src interface{}) (key string, ok bool) {
+func (m *Machine) getCacheKey(filename string, src interface{}) (key string, ok bool) {
+	return makeCacheKey(filename, src, m.predeclared, m.getFileOptions())
+}
+
+// makeCacheKey derives the cache key from the filename, the source, the predeclared names and the dialect bits of the file options, see getCacheKey for the layout.
+func makeCacheKey(filename string, src interface{}, predeclared starlark.StringDict, opts *syntax.FileOptions) (key string, ok bool) {
 	var k string
 	switch s := src.(type) {
 	case string:
@@ -100,8 +110,8 @@ func (m *Machine) getCacheKey(src interface{}) (key string, ok bool) {
 	}
 
 	// fold in the sorted predeclared names
-	names := make([]string, 0, len(m.predeclared))
-	for n := range m.predeclared {
+	names := make([]string, 0, len(predeclared))
+	for n := range predeclared {
 		names = append(names, n)
 	}
 	sort.Strings(names)
@@ -109,14 +119,14 @@ func (m *Machine) getCacheKey(src interface{}) (key string, ok bool) {
 
 	// fold in the dialect bits
 	var opt int
-	if m.allowRecursion {
+	if opts != nil && opts.Recursion {
 		opt |= 1
 	}
-	if m.allowGlobalReassign {
+	if opts != nil && opts.GlobalReassign {
 		opt |= 2
 	}
 
-	return fmt.Sprintf("%d:%d:%s:%s", starlark.CompilerVersion, opt, nd, k), true
+	return fmt.Sprintf("%d:%d:%s:%s:%s", starlark.CompilerVersion, opt, nd, itn.GetStringMD5(filename), k), true
 }
 
 // ByteCache is an interface for caching byte data, used for caching compiled Starlark programs.
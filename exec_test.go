@@ -205,3 +205,70 @@ func Test_ScriptCache_DialectMismatch(t *testing.T) {
 		t.Errorf("machine B expects a while-dialect error, got: %v", err)
 	}
 }
+
+// countingCache is a MemoryCache counting the hits and misses of Get.
+type countingCache struct {
+	*starlet.MemoryCache
+	hits, misses int
+}
+
+func (c *countingCache) Get(key string) ([]byte, bool) {
+	v, ok := c.MemoryCache.Get(key)
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return v, ok
+}
+
+func Test_ScriptCache_LoadedModules(t *testing.T) {
+	mfs := MemFS{
+		"main.star": "load('lib.star', 'double')\nx = double(21)\n",
+		"lib.star":  "def double(n):\n    return n * 2\n",
+	}
+	cache := &countingCache{MemoryCache: starlet.NewMemoryCache()}
+	for i := 0; i < 3; i++ {
+		m := starlet.NewDefault()
+		m.SetScriptCache(cache)
+		m.SetScript("main.star", nil, mfs)
+		res, err := m.Run()
+		if err != nil {
+			t.Fatalf("run #%d expects no error, got: %v", i, err)
+		}
+		if res["x"] != int64(42) {
+			t.Errorf("run #%d expects x = 42, got: %v", i, res["x"])
+		}
+	}
+	// the main script and the loaded module are compiled once each
+	if cache.misses != 2 || cache.hits != 4 {
+		t.Errorf("expected 2 misses and 4 hits, got %d misses and %d hits", cache.misses, cache.hits)
+	}
+
+	// a different predeclared name set must not reuse the compiled module
+	m := starlet.NewWithGlobals(map[string]interface{}{"n": 1})
+	m.SetScriptCache(cache)
+	m.SetScript("main.star", nil, mfs)
+	if _, err := m.Run(); err != nil {
+		t.Fatalf("expects no error, got: %v", err)
+	}
+	if cache.misses != 4 {
+		t.Errorf("expected 4 misses, got %d", cache.misses)
+	}
+
+	// modules of identical source keep their own positions
+	lib := "def boom():\n    return 1 // 0\n"
+	m = starlet.NewDefault()
+	m.SetScriptCache(cache)
+	m.SetScript("main.star", []byte("load('a.star', a='boom')\nload('b.star', b='boom')\nb()\n"), MemFS{"a.star": lib, "b.star": lib})
+	if _, err := m.Run(); err == nil || !strings.Contains(err.Error(), "b.star:2:") || strings.Contains(err.Error(), "a.star") {
+		t.Errorf("expects the error in b.star, got: %v", err)
+	}
+
+	// without a cache, the module is executed from source as before
+	m = starlet.NewDefault()
+	m.SetScript("main.star", nil, mfs)
+	if res, err := m.Run(); err != nil || res["x"] != int64(42) {
+		t.Errorf("expects x = 42 without error, got: %v, %v", res, err)
+	}
+}
@@ -0,0 +1,155 @@
+package starlet
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/1set/starlet/dataconv"
+	"github.com/1set/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+// GoFunc turns a Starlark callable of the machine, e.g. a function or lambda from the results of Export, Call or Run with or without the output conversion, into a Go function calling it like Call: the arguments are converted to Starlark values, and the result is converted back if the output conversion is enabled.
+//
+// Each call of the Go function takes the lock of the machine and runs with its step budget, print and resource limits, so calls are serialized with the runs and calls of the machine, and it must not be called while the same machine is running, e.g. from a builtin or a hook.
+// It fails if the value is not callable.
+func (m *Machine) GoFunc(v interface{}) (func(args ...interface{}) (interface{}, error), error) {
+	fn, err := toCallable(v)
+	if err != nil {
+		return nil, err
+	}
+	return func(args ...interface{}) (out interface{}, err error) {
+		err = m.callValue(nil, fn, args, func(res starlark.Value) error {
+			if m.enableOutConv {
+				out = convert.FromValue(res)
+			} else {
+				out = res
+			}
+			return nil
+		})
+		return out, err
+	}, nil
+}
+
+// GoFuncAs turns a Starlark callable of the machine into a Go function of the type F via reflection, like GoFunc, e.g. GoFuncAs[func(a, b int) (bool, error)](m, less).
+//
+// The arguments are converted to Starlark values, the elements of a variadic argument are passed as separate arguments, and if the first parameter of F is a context.Context, it's not passed but aborts the call when cancelled, like CallWithContext.
+// F returns at most a result and an error: the result is decoded from the return value like CallAs, and the error is of the call or the decoding. If F has no error result, a failed call panics with the error.
+// It fails if the value is not callable, or F is not a function type of such results.
+func GoFuncAs[F any](m *Machine, v interface{}) (f F, err error) {
+	ft := reflect.TypeOf(&f).Elem()
+	if ft.Kind() != reflect.Func {
+		return f, errorStarletErrorf("func", "not a function type: %s", ft)
+	}
+
+	// the result and error of F
+	var resType reflect.Type
+	errIdx := -1
+	switch ft.NumOut() {
+	case 0:
+	case 1:
+		if ft.Out(0) == errorType {
+			errIdx = 0
+		} else {
+			resType = ft.Out(0)
+		}
+	case 2:
+		if ft.Out(1) != errorType {
+			return f, errorStarletErrorf("func", "the second result of %s is not error", ft)
+		}
+		resType, errIdx = ft.Out(0), 1
+	default:
+		return f, errorStarletErrorf("func", "too many results of %s", ft)
+	}
+	hasCtx := ft.NumIn() > 0 && ft.In(0) == contextType
+
+	fn, err := toCallable(v)
+	if err != nil {
+		return f, err
+	}
+	fv := reflect.MakeFunc(ft, func(in []reflect.Value) []reflect.Value {
+		var ctx context.Context
+		if hasCtx {
+			ctx, _ = in[0].Interface().(context.Context)
+			in = in[1:]
+		}
+		args := make([]interface{}, 0, len(in))
+		for i, a := range in {
+			if ft.IsVariadic() && i == len(in)-1 {
+				for j := 0; j < a.Len(); j++ {
+					args = append(args, a.Index(j).Interface())
+				}
+				continue
+			}
+			args = append(args, a.Interface())
+		}
+
+		var res reflect.Value
+		err := m.callValue(ctx, fn, args, func(sv starlark.Value) error {
+			if resType == nil {
+				return nil
+			}
+			tag := m.customTag
+			if tag == "" {
+				tag = convert.DefaultPropertyTag
+			}
+			p := reflect.New(resType)
+			if e := dataconv.DecodeStarlark(sv, p.Interface(), tag); e != nil {
+				return errorDataconvDecode("result", e)
+			}
+			res = p.Elem()
+			return nil
+		})
+		if err != nil && errIdx < 0 {
+			panic(err)
+		}
+
+		out := make([]reflect.Value, 0, ft.NumOut())
+		if resType != nil {
+			if !res.IsValid() {
+				res = reflect.Zero(resType)
+			}
+			out = append(out, res)
+		}
+		if errIdx >= 0 {
+			ev := reflect.Zero(errorType)
+			if err != nil {
+				ev = reflect.ValueOf(err)
+			}
+			out = append(out, ev)
+		}
+		return out
+	})
+	return fv.Interface().(F), nil
+}
+
+// toCallable returns the Starlark callable in the value, or an error if it's not callable.
+func toCallable(v interface{}) (starlark.Callable, error) {
+	fn, ok := v.(starlark.Callable)
+	if !ok {
+		return nil, errorStarletErrorf("func", "not a callable: %T", v)
+	}
+	return fn, nil
+}
+
+// callValue calls the callable with the machine locked like callRaw.
+func (m *Machine) callValue(ctx context.Context, fn starlark.Callable, args []interface{}, handle func(res starlark.Value) error) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = errorRecovered("call", r)
+		}
+	}()
+
+	if m.thread == nil {
+		return errorStarletErrorf("call", "no function loaded")
+	}
+	return m.callLocked(ctx, fn, args, nil, handle)
+}
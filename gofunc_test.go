@@ -0,0 +1,167 @@
+package starlet_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/1set/starlet"
+)
+
+func TestMachine_GoFunc(t *testing.T) {
+	m := starlet.NewDefault()
+	m.SetMaxExecutionSteps(1000)
+	out, err := m.RunScript([]byte(`
+def make_adder(n):
+    return lambda x: x + n
+add2 = make_adder(2)
+def spin():
+    for i in range(10000):
+        pass
+`), nil)
+	if err != nil {
+		t.Fatalf("unexpected run error: %v", err)
+	}
+
+	add2, err := m.GoFunc(out["add2"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, err := add2(40); err != nil || v != int64(42) {
+		t.Errorf("expected 42, got: %v, %v", v, err)
+	}
+	_, err = add2("x")
+	expectErr(t, err, "starlark: call: unknown binary op: string + int")
+
+	// a callable returned by a call
+	mk, err := m.GoFunc(out["make_adder"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fn, err := mk(10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	add10, err := m.GoFunc(fn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, err := add10(1); err != nil || v != int64(11) {
+		t.Errorf("expected 11, got: %v, %v", v, err)
+	}
+
+	// the step budget of the machine applies
+	spin, _ := m.GoFunc(out["spin"])
+	_, err = spin()
+	var se starlet.MaxStepsExceededError
+	if !errors.As(err, &se) || se.Limit != 1000 {
+		t.Errorf("expected step budget exceeded, got: %v", err)
+	}
+
+	_, err = m.GoFunc(42)
+	expectErr(t, err, "starlet: func: not a callable: int")
+
+	// not usable after reset
+	m.Reset()
+	_, err = add2(1)
+	expectErr(t, err, "starlet: call: no function loaded")
+}
+
+func TestGoFuncAs(t *testing.T) {
+	type item struct {
+		Name  string `starlark:"name"`
+		Price int    `starlark:"price"`
+	}
+	m := starlet.NewDefault()
+	m.SetOutputConversionEnabled(false)
+	out, err := m.RunScript([]byte(`
+def less(a, b):
+    return a["price"] < b["price"]
+def total(*prices):
+    t = 0
+    for p in prices:
+        t += p
+    return t
+def cheapest(items):
+    if not items:
+        return None
+    c = sorted(items, key=lambda x: x.price)[0]
+    return {"name": c.name, "price": c.price}
+def boom():
+    fail("oops")
+def noop():
+    pass
+`), nil)
+	if err != nil {
+		t.Fatalf("unexpected run error: %v", err)
+	}
+
+	// a comparator for sort.Slice, panicking on errors
+	less, err := starlet.GoFuncAs[func(a, b map[string]interface{}) bool](m, out["less"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	items := []map[string]interface{}{{"price": 3}, {"price": 1}, {"price": 2}}
+	sort.Slice(items, func(i, j int) bool { return less(items[i], items[j]) })
+	if items[0]["price"] != 1 || items[2]["price"] != 3 {
+		t.Errorf("unexpected order: %v", items)
+	}
+
+	// variadic arguments
+	total, err := starlet.GoFuncAs[func(prices ...int) (int, error)](m, out["total"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, err := total(1, 2, 3); err != nil || v != 6 {
+		t.Errorf("expected 6, got: %v, %v", v, err)
+	}
+
+	// decoded result with a context
+	cheapest, err := starlet.GoFuncAs[func(context.Context, []*item) (*item, error)](m, out["cheapest"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	it, err := cheapest(context.Background(), []*item{{"a", 5}, {"b", 3}})
+	if err != nil || it == nil || it.Name != "b" {
+		t.Errorf("expected item b, got: %v, %v", it, err)
+	}
+	if it, err := cheapest(context.Background(), nil); err != nil || it != nil {
+		t.Errorf("expected nil item, got: %v, %v", it, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = cheapest(ctx, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled, got: %v", err)
+	}
+
+	// errors only, or nothing
+	failFn, err := starlet.GoFuncAs[func() error](m, out["boom"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectErr(t, failFn(), "starlark: call: fail: oops")
+	noop, err := starlet.GoFuncAs[func()](m, out["noop"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	noop()
+
+	// a decoding failure
+	badTotal, _ := starlet.GoFuncAs[func(prices ...int) (string, error)](m, out["total"])
+	_, err = badTotal(1)
+	if err == nil {
+		t.Errorf("expected decoding error")
+	}
+
+	// invalid types
+	_, err = starlet.GoFuncAs[int](m, out["noop"])
+	expectErr(t, err, "starlet: func: not a function type: int")
+	_, err = starlet.GoFuncAs[func() (int, int)](m, out["noop"])
+	expectErr(t, err, "starlet: func: the second result of func() (int, int) is not error")
+	_, err = starlet.GoFuncAs[func() (int, int, error)](m, out["noop"])
+	expectErr(t, err, "starlet: func: too many results of func() (int, int, error)")
+	_, err = starlet.GoFuncAs[func()](m, "noop")
+	expectErr(t, err, "starlet: func: not a callable: string")
+}
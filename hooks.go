@@ -0,0 +1,217 @@
+package starlet
+
+import (
+	"fmt"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// Hooks is a set of callbacks observing the execution of a Machine, any of them can be nil.
+// The callbacks are invoked synchronously on the goroutine running the script while the machine is locked, so they must not call methods of the same Machine that take the lock, and slow callbacks slow down the script.
+type Hooks struct {
+	// OnRunStart is invoked before the script of each run is executed.
+	OnRunStart func(e RunStartEvent)
+	// OnRunFinish is invoked after the script of each run is executed, successful or not.
+	OnRunFinish func(e RunFinishEvent)
+	// OnLoad is invoked for each module resolution of load(), including the ones served by the load cache.
+	OnLoad func(e LoadEvent)
+	// OnPrint is invoked for each message printed by the script or its loaded modules, after the message is handed to the print function.
+	OnPrint func(e PrintEvent)
+	// OnBuiltinCall is invoked after each invocation of a builtin provided by the globals, extras, preload and lazyload modules.
+	// Unlike the other hooks, it only takes effect before the first run or after a reset, since the builtins are instrumented when they are bound.
+	OnBuiltinCall func(e BuiltinCallEvent)
+}
+
+// RunStartEvent describes a run about to execute the script.
+type RunStartEvent struct {
+	Script string // name of the script
+	Run    uint   // sequence number of the run since the last reset, starting from 1
+}
+
+// RunFinishEvent describes a run that has executed the script.
+type RunFinishEvent struct {
+	Script   string        // name of the script
+	Run      uint          // sequence number of the run since the last reset, starting from 1
+	Steps    uint64        // Starlark steps executed by the main thread
+	Duration time.Duration // wall time of the execution
+	Err      error         // error of the execution, nil on success
+}
+
+// LoadSource tells where a module resolved by load() came from.
+type LoadSource uint8
+
+const (
+	// LoadSourceNone means the module was not found anywhere.
+	LoadSourceNone LoadSource = iota
+	// LoadSourceLazyload means the module came from the lazyload module map.
+	LoadSourceLazyload
+	// LoadSourceFile means the module was read and executed from the script filesystem.
+	LoadSourceFile
+	// LoadSourceCache means the module had already been loaded in the load cache of the machine.
+	LoadSourceCache
+)
+
+// String returns the name of the source.
+func (s LoadSource) String() string {
+	switch s {
+	case LoadSourceNone:
+		return "none"
+	case LoadSourceLazyload:
+		return "lazyload"
+	case LoadSourceFile:
+		return "file"
+	case LoadSourceCache:
+		return "cache"
+	default:
+		return fmt.Sprintf("LoadSource(%d)", uint8(s))
+	}
+}
+
+// LoadEvent describes a module resolution of load().
+type LoadEvent struct {
+	Module   string        // name of the module
+	Source   LoadSource    // where the module came from
+	Duration time.Duration // time spent on resolving the module, including executing it
+	Err      error         // error of the resolution, nil on success
+}
+
+// PrintEvent describes a message printed by the script.
+type PrintEvent struct {
+	Thread  string // name of the thread printing the message, e.g. "starlet" or "starlet:load"
+	Message string // the printed message
+}
+
+// BuiltinCallEvent describes an invocation of a builtin.
+type BuiltinCallEvent struct {
+	Name     string        // name the builtin is bound to, e.g. "json.encode"
+	Duration time.Duration // time spent in the builtin
+	Err      error         // error returned by the builtin, nil on success
+}
+
+// SetHooks sets the hooks observing the execution of the machine, nil removes all hooks.
+// The hooks are copied, so changing the given struct later has no effect.
+func (m *Machine) SetHooks(hooks *Hooks) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if hooks == nil {
+		m.hooks = nil
+		return
+	}
+	h := *hooks
+	m.hooks = &h
+}
+
+// hookRunStart invokes the OnRunStart hook if set.
+func (m *Machine) hookRunStart(script string) {
+	if m.hooks != nil && m.hooks.OnRunStart != nil {
+		m.hooks.OnRunStart(RunStartEvent{Script: script, Run: m.runTimes})
+	}
+}
+
+// hookRunFinish invokes the OnRunFinish hook if set.
+func (m *Machine) hookRunFinish(script string, start time.Time, err error) {
+	if m.hooks != nil && m.hooks.OnRunFinish != nil {
+		m.hooks.OnRunFinish(RunFinishEvent{
+			Script:   script,
+			Run:      m.runTimes,
+			Steps:    m.thread.Steps,
+			Duration: time.Since(start),
+			Err:      err,
+		})
+	}
+}
+
+// hookLoad invokes the OnLoad hook if set, it's wired into the load cache.
+func (m *Machine) hookLoad(module string, src LoadSource, start time.Time, err error) {
+	if m.hooks != nil && m.hooks.OnLoad != nil {
+		m.hooks.OnLoad(LoadEvent{Module: module, Source: src, Duration: time.Since(start), Err: err})
+	}
+}
+
+// instrumentDict replaces the builtins in the dict, including the ones in modules and structs, with the ones invoking the OnBuiltinCall hook.
+// It does nothing if the hook is not set.
+func (m *Machine) instrumentDict(d starlark.StringDict) {
+	if m.hooks == nil || m.hooks.OnBuiltinCall == nil {
+		return
+	}
+	m.instrumentDictAs("", d)
+}
+
+// instrumentDictAs is instrumentDict for the members of the named module, the builtins are reported as "module.member".
+func (m *Machine) instrumentDictAs(module string, d starlark.StringDict) {
+	for k, v := range d {
+		name := k
+		if module != "" {
+			name = module + "." + k
+		}
+		d[k] = instrumentValue(name, v, m.hooks.OnBuiltinCall)
+	}
+}
+
+// instrumentLoader wraps the lazy loader so the builtins of the loaded modules invoke the OnBuiltinCall hook, if set.
+func (m *Machine) instrumentLoader(ld NamedModuleLoader) NamedModuleLoader {
+	if m.hooks == nil || m.hooks.OnBuiltinCall == nil {
+		return ld
+	}
+	return func(s string) (starlark.StringDict, error) {
+		d, err := ld(s)
+		if err != nil || d == nil {
+			return d, err
+		}
+		// copy to keep the dicts owned by the module intact
+		nd := make(starlark.StringDict, len(d))
+		for k, v := range d {
+			nd[k] = v
+		}
+		m.instrumentDictAs(s, nd)
+		return nd, nil
+	}
+}
+
+// instrumentValue returns the value with its builtins wrapped to invoke the hook, values of other types are returned as is.
+// The builtins are reported by the name they are bound to, e.g. "json.encode" for a member of a module bound as "json", instead of their own names, which are often uninformative for converted Go functions.
+func instrumentValue(name string, v starlark.Value, hook func(e BuiltinCallEvent)) starlark.Value {
+	return mapBuiltins(name, v, func(name string, b *starlark.Builtin) *starlark.Builtin {
+		return instrumentBuiltin(name, b, hook)
+	})
+}
+
+// mapBuiltins returns the value with its builtins, including the ones in modules and structs, replaced by the results of wrap with the names they are bound to; values of other types are returned as is.
+func mapBuiltins(name string, v starlark.Value, wrap func(name string, b *starlark.Builtin) *starlark.Builtin) starlark.Value {
+	switch t := v.(type) {
+	case *starlark.Builtin:
+		return wrap(name, t)
+	case *starlarkstruct.Module:
+		members := make(starlark.StringDict, len(t.Members))
+		for k, mv := range t.Members {
+			members[k] = mapBuiltins(name+"."+k, mv, wrap)
+		}
+		return &starlarkstruct.Module{Name: t.Name, Members: members}
+	case *starlarkstruct.Struct:
+		sd := make(starlark.StringDict)
+		t.ToStringDict(sd)
+		for k, sv := range sd {
+			sd[k] = mapBuiltins(name+"."+k, sv, wrap)
+		}
+		return starlarkstruct.FromStringDict(t.Constructor(), sd)
+	default:
+		return v
+	}
+}
+
+// instrumentBuiltin wraps the builtin to invoke the hook after each invocation.
+func instrumentBuiltin(name string, b *starlark.Builtin, hook func(e BuiltinCallEvent)) *starlark.Builtin {
+	w := starlark.NewBuiltin(b.Name(), func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		start := time.Now()
+		res, err := b.CallInternal(thread, args, kwargs)
+		hook(BuiltinCallEvent{Name: name, Duration: time.Since(start), Err: err})
+		return res, err
+	})
+	if recv := b.Receiver(); recv != nil {
+		w = w.BindReceiver(recv)
+	}
+	return w
+}
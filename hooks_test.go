@@ -0,0 +1,116 @@
+package starlet_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/1set/starlet"
+)
+
+func TestMachine_Hooks(t *testing.T) {
+	var (
+		starts   []starlet.RunStartEvent
+		finishes []starlet.RunFinishEvent
+		loads    []string
+		prints   []string
+		calls    []string
+	)
+	hooks := &starlet.Hooks{
+		OnRunStart:  func(e starlet.RunStartEvent) { starts = append(starts, e) },
+		OnRunFinish: func(e starlet.RunFinishEvent) { finishes = append(finishes, e) },
+		OnLoad: func(e starlet.LoadEvent) {
+			s := e.Module + "@" + e.Source.String()
+			if e.Err != nil {
+				s += "!"
+			}
+			loads = append(loads, s)
+		},
+		OnPrint: func(e starlet.PrintEvent) { prints = append(prints, e.Thread+":"+e.Message) },
+		OnBuiltinCall: func(e starlet.BuiltinCallEvent) {
+			s := e.Name
+			if e.Err != nil {
+				s += "!"
+			}
+			calls = append(calls, s)
+		},
+	}
+
+	mfs := MemFS{
+		"lib.star": "print('lib')\ndef f(): return 1\n",
+		"main.star": strings.Join([]string{
+			`load("lib.star", "f")`,
+			`load("json", "encode")`,
+			`load("lib.star", g="f")`,
+			`print(encode([f(), g()]))`,
+			`print(base64.encode("a"))`,
+			`s = hello("w")`,
+		}, "\n"),
+	}
+	pf, cmp := getPrintCompareFunc(t)
+	m := starlet.NewWithNames(starlet.StringAnyMap{"hello": func(s string) string { return "hi " + s }}, []string{"base64"}, []string{"json"})
+	m.SetPrintFunc(pf)
+	m.SetHooks(hooks)
+	m.SetScript("main.star", nil, mfs)
+	if _, err := m.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cmp("lib\n[1,1]\nYQ==\n")
+
+	if len(starts) != 1 || starts[0].Script != "main.star" || starts[0].Run != 1 {
+		t.Errorf("unexpected run start events: %+v", starts)
+	}
+	if len(finishes) != 1 || finishes[0].Err != nil || finishes[0].Steps == 0 || finishes[0].Duration <= 0 {
+		t.Errorf("unexpected run finish events: %+v", finishes)
+	}
+	expectStrings(t, "loads", loads, []string{"lib.star@file", "json@lazyload", "lib.star@cache"})
+	expectStrings(t, "prints", prints, []string{"starlet:load:lib", "starlet:[1,1]", "starlet:YQ=="})
+	expectStrings(t, "calls", calls, []string{"json.encode", "base64.encode", "hello"})
+
+	// the finish hook gets the error, and unknown modules are reported
+	starts, finishes, loads = nil, nil, nil
+	if _, err := m.RunScript([]byte(`load("nope", "x")`), nil); err == nil {
+		t.Errorf("expected error")
+	}
+	if len(finishes) != 1 || finishes[0].Err == nil || finishes[0].Run != 2 {
+		t.Errorf("unexpected run finish events: %+v", finishes)
+	}
+	expectStrings(t, "loads", loads, []string{"nope@none!"})
+
+	// builtin errors are reported, and hooks can be removed
+	calls = nil
+	if _, err := m.RunScript([]byte(`json_str = base64.decode("!!")`), nil); err == nil {
+		t.Errorf("expected error")
+	}
+	expectStrings(t, "calls", calls, []string{"base64.decode!"})
+	m.SetHooks(nil)
+	calls, prints = nil, nil
+	if _, err := m.RunScript([]byte(`print(1)`), nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(calls)+len(prints) != 0 {
+		t.Errorf("expected no hooks invoked, got %v %v", calls, prints)
+	}
+}
+
+func TestMachine_Hooks_MaxSteps(t *testing.T) {
+	var finished error
+	m := starlet.NewDefault()
+	m.SetMaxExecutionSteps(100)
+	m.SetHooks(&starlet.Hooks{OnRunFinish: func(e starlet.RunFinishEvent) { finished = e.Err }})
+	_, err := m.RunScript([]byte("def f():\n    x = 0\n    for i in range(1000):\n        x += i\nf()\n"), nil)
+	var me starlet.MaxStepsExceededError
+	if !errors.As(err, &me) || !errors.As(finished, &me) {
+		t.Errorf("expected step limit error in both result and hook, got %v and %v", err, finished)
+	}
+	if s := starlet.LoadSourceCache.String(); s != "cache" {
+		t.Errorf("unexpected name: %s", s)
+	}
+}
+
+func expectStrings(t *testing.T, name string, act, exp []string) {
+	t.Helper()
+	if strings.Join(act, ",") != strings.Join(exp, ",") {
+		t.Errorf("expected %s: %q, got: %q", name, exp, act)
+	}
+}
@@ -0,0 +1,230 @@
+// Package pprof writes profiles in the gzip-compressed protocol buffer format read by pprof tools, e.g. "go tool pprof".
+// The message is encoded by hand after the starlark profiler, to avoid the dependencies on pprof and protobuf, see https://github.com/google/pprof/blob/main/proto/profile.proto for the format.
+package pprof
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// ValueType describes the semantics and measurement units of a value, e.g. "steps" in "count".
+type ValueType struct {
+	Type string
+	Unit string
+}
+
+// Function is a function in the profiled program.
+type Function struct {
+	Name      string
+	Filename  string
+	StartLine int64
+}
+
+// Location is a line in a function.
+type Location struct {
+	Function Function
+	Line     int64
+}
+
+// Sample is a call stack with its measured values.
+type Sample struct {
+	Stack  []Location        // from the leaf to the root
+	Values []int64           // one for each of the sample types of the profile
+	Labels map[string]string // additional context, e.g. the module of the leaf
+}
+
+// Profile is a collection of samples.
+type Profile struct {
+	SampleTypes   []ValueType
+	Samples       []Sample
+	PeriodType    ValueType
+	Period        int64
+	TimeNanos     int64 // when the profile starts, in nanoseconds since the epoch
+	DurationNanos int64
+}
+
+// Field numbers of the protocol.
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+	sampleLabel      = 3
+
+	labelKey = 1
+	labelStr = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+	functionStartLine  = 5
+)
+
+// Write writes the profile to w.
+func (p *Profile) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	gz := gzip.NewWriter(bw)
+	enc := encoder{w: gz}
+
+	strs := map[string]int64{}
+	str := func(s string) int64 {
+		i, ok := strs[s]
+		if !ok {
+			i = int64(len(strs))
+			strs[s] = i
+			enc.string(profileStringTable, s)
+		}
+		return i
+	}
+	str("") // index 0 is reserved for the empty string
+
+	funcs := map[Function]uint64{}
+	function := func(f Function) uint64 {
+		id, ok := funcs[f]
+		if !ok {
+			id = uint64(len(funcs) + 1)
+			funcs[f] = id
+			var sub encoder
+			sub.uint(functionID, id)
+			sub.int(functionName, str(f.Name))
+			sub.int(functionSystemName, str(f.Name))
+			sub.int(functionFilename, str(f.Filename))
+			sub.int(functionStartLine, f.StartLine)
+			enc.bytes(profileFunction, sub.buf.Bytes())
+		}
+		return id
+	}
+
+	locs := map[Location]uint64{}
+	location := func(l Location) uint64 {
+		id, ok := locs[l]
+		if !ok {
+			id = uint64(len(locs) + 1)
+			locs[l] = id
+			var line encoder
+			line.uint(lineFunctionID, function(l.Function))
+			line.int(lineLine, l.Line)
+			var sub encoder
+			sub.uint(locationID, id)
+			sub.bytes(locationLine, line.buf.Bytes())
+			enc.bytes(profileLocation, sub.buf.Bytes())
+		}
+		return id
+	}
+
+	valueType := func(field uint, vt ValueType) {
+		var sub encoder
+		sub.int(valueTypeType, str(vt.Type))
+		sub.int(valueTypeUnit, str(vt.Unit))
+		enc.bytes(field, sub.buf.Bytes())
+	}
+
+	for _, vt := range p.SampleTypes {
+		valueType(profileSampleType, vt)
+	}
+	for _, s := range p.Samples {
+		var sub encoder
+		for _, l := range s.Stack {
+			sub.uint(sampleLocationID, location(l))
+		}
+		for _, v := range s.Values {
+			sub.int(sampleValue, v)
+		}
+		keys := make([]string, 0, len(s.Labels))
+		for k := range s.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			var label encoder
+			label.int(labelKey, str(k))
+			label.int(labelStr, str(s.Labels[k]))
+			sub.bytes(sampleLabel, label.buf.Bytes())
+		}
+		enc.bytes(profileSample, sub.buf.Bytes())
+	}
+	if p.PeriodType != (ValueType{}) {
+		valueType(profilePeriodType, p.PeriodType)
+	}
+	enc.int(profilePeriod, p.Period)
+	enc.int(profileTimeNanos, p.TimeNanos)
+	enc.int(profileDurationNanos, p.DurationNanos)
+
+	if enc.err != nil {
+		return enc.err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// encoder encodes the fields of a protocol buffer message, to the writer if set, or the buffer otherwise.
+// It keeps the first error of writing, so the callers check it once.
+type encoder struct {
+	w   io.Writer
+	buf bytes.Buffer
+	tmp [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (e *encoder) write(b []byte) {
+	if e.w == nil {
+		e.buf.Write(b)
+		return
+	}
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) uvarint(x uint64) {
+	n := binary.PutUvarint(e.tmp[:], x)
+	e.write(e.tmp[:n])
+}
+
+func (e *encoder) tag(field, wire uint) {
+	e.uvarint(uint64(field<<3 | wire))
+}
+
+func (e *encoder) string(field uint, s string) {
+	e.bytes(field, []byte(s))
+}
+
+func (e *encoder) bytes(field uint, b []byte) {
+	e.tag(field, 2) // length-delimited
+	e.uvarint(uint64(len(b)))
+	e.write(b)
+}
+
+func (e *encoder) uint(field uint, x uint64) {
+	e.tag(field, 0) // varint
+	e.uvarint(x)
+}
+
+func (e *encoder) int(field uint, x int64) {
+	e.tag(field, 0) // varint
+	e.uvarint(uint64(x))
+}
@@ -0,0 +1,141 @@
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// field is a decoded field of a protocol buffer message, the value is either a varint or bytes.
+type field struct {
+	num uint64
+	v   uint64
+	b   []byte
+}
+
+func decode(t *testing.T, b []byte) []field {
+	t.Helper()
+	var fs []field
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		f := field{num: tag >> 3}
+		v, n := binary.Uvarint(b)
+		b = b[n:]
+		switch tag & 7 {
+		case 0:
+			f.v = v
+		case 2:
+			f.b, b = b[:v], b[v:]
+		default:
+			t.Fatalf("unexpected wire type: %d", tag&7)
+		}
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+func TestProfile_Write(t *testing.T) {
+	fib := Function{Name: "fib", Filename: "lib.star", StartLine: 1}
+	top := Function{Name: "main.star", Filename: "main.star"}
+	p := &Profile{
+		SampleTypes: []ValueType{{"steps", "count"}, {"wall", "nanoseconds"}},
+		Samples: []Sample{
+			{Stack: []Location{{fib, 3}, {top, 5}}, Values: []int64{10, 2000}, Labels: map[string]string{"module": "lib.star"}},
+			{Stack: []Location{{fib, 4}, {fib, 3}, {top, 5}}, Values: []int64{7, 1000}},
+			{Stack: []Location{{top, 6}}, Values: []int64{1, 50}, Labels: map[string]string{"module": "main.star"}},
+		},
+		PeriodType:    ValueType{"steps", "count"},
+		Period:        1,
+		TimeNanos:     1700000000000000000,
+		DurationNanos: 3050,
+	}
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var (
+		strs             []string
+		samples          [][]uint64
+		values           [][]int64
+		labels           []map[uint64]uint64
+		nLocs, nFuncs    int
+		period, duration uint64
+	)
+	for _, f := range decode(t, raw) {
+		switch f.num {
+		case profileStringTable:
+			strs = append(strs, string(f.b))
+		case profileSample:
+			var locs []uint64
+			var vals []int64
+			lbs := map[uint64]uint64{}
+			for _, sf := range decode(t, f.b) {
+				switch sf.num {
+				case sampleLocationID:
+					locs = append(locs, sf.v)
+				case sampleValue:
+					vals = append(vals, int64(sf.v))
+				case sampleLabel:
+					lf := decode(t, sf.b)
+					lbs[lf[0].v] = lf[1].v
+				}
+			}
+			samples, values, labels = append(samples, locs), append(values, vals), append(labels, lbs)
+		case profileLocation:
+			nLocs++
+		case profileFunction:
+			nFuncs++
+		case profilePeriod:
+			period = f.v
+		case profileDurationNanos:
+			duration = f.v
+		}
+	}
+
+	wantStrs := []string{"", "steps", "count", "wall", "nanoseconds", "fib", "lib.star", "main.star", "module"}
+	if !reflect.DeepEqual(strs, wantStrs) {
+		t.Errorf("unexpected string table: %q", strs)
+	}
+	if want := [][]uint64{{1, 2}, {3, 1, 2}, {4}}; !reflect.DeepEqual(samples, want) {
+		t.Errorf("unexpected location ids: %v", samples)
+	}
+	if want := [][]int64{{10, 2000}, {7, 1000}, {1, 50}}; !reflect.DeepEqual(values, want) {
+		t.Errorf("unexpected values: %v", values)
+	}
+	if want := []map[uint64]uint64{{8: 6}, {}, {8: 7}}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("unexpected labels: %v", labels)
+	}
+	if nLocs != 4 || nFuncs != 2 {
+		t.Errorf("expected 4 locations of 2 functions, got: %d, %d", nLocs, nFuncs)
+	}
+	if period != 1 || duration != 3050 {
+		t.Errorf("unexpected period or duration: %d, %d", period, duration)
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestProfile_WriteError(t *testing.T) {
+	p := &Profile{SampleTypes: []ValueType{{"steps", "count"}}}
+	if err := p.Write(failWriter{}); err == nil || err.Error() != "disk full" {
+		t.Errorf("expected write error, got: %v", err)
+	}
+}
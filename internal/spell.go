@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NearestName returns the candidate closest to the given misspelled name, or empty if none is close enough.
+// Case and underscores are ignored when comparing, and a candidate is close enough if its edit distance to the name is less than half the length of the name, rounded up.
+func NearestName(x string, candidates []string) string {
+	fx := foldName(x)
+	best, bestD := "", (len(fx)+1)/2
+	for _, c := range candidates {
+		if c == x {
+			continue
+		}
+		fc := foldName(c)
+		if fc == fx {
+			// differs only in case or underscores, can't be closer
+			return c
+		}
+		if d := editDistance(fx, fc, bestD); d < bestD {
+			best, bestD = c, d
+		}
+	}
+	return best
+}
+
+// foldName lowercases the name and drops the underscores in it.
+func foldName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+// editDistance returns the Levenshtein distance between x and y, or any value not less than max if it's at least max.
+func editDistance(x, y string, max int) int {
+	rx, ry := []rune(x), []rune(y)
+	if d := len(rx) - len(ry); d >= max || -d >= max {
+		return max
+	}
+	row := make([]int, len(ry)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(rx); i++ {
+		prev := row[0]
+		row[0] = i
+		low := row[0]
+		for j := 1; j <= len(ry); j++ {
+			cost := 1
+			if rx[i-1] == ry[j-1] {
+				cost = 0
+			}
+			cur := minInt(prev+cost, minInt(row[j]+1, row[j-1]+1))
+			prev, row[j] = row[j], cur
+			if cur < low {
+				low = cur
+			}
+		}
+		if low >= max {
+			return max
+		}
+	}
+	return row[len(ry)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,29 @@
+package internal
+
+import "testing"
+
+func TestNearestName(t *testing.T) {
+	tests := []struct {
+		name       string
+		x          string
+		candidates []string
+		want       string
+	}{
+		{name: "empty candidates", x: "lenn"},
+		{name: "one typo", x: "lenn", candidates: []string{"len", "list", "print"}, want: "len"},
+		{name: "wrong letter", x: "jsom", candidates: []string{"json", "base64"}, want: "json"},
+		{name: "single letter", x: "g", candidates: []string{"f"}},
+		{name: "missing letter", x: "dump", candidates: []string{"dumps", "loads"}, want: "dumps"},
+		{name: "case and underscores", x: "DecodeJSON", candidates: []string{"decode_json", "encode_json"}, want: "decode_json"},
+		{name: "closest wins", x: "strin", candidates: []string{"string", "str"}, want: "string"},
+		{name: "too far", x: "foo", candidates: []string{"bar", "json"}},
+		{name: "itself is not a suggestion", x: "json", candidates: []string{"json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NearestName(tt.x, tt.candidates); got != tt.want {
+				t.Errorf("NearestName(%q) = %q, want %q", tt.x, got, tt.want)
+			}
+		})
+	}
+}
@@ -126,37 +126,42 @@ func TestSetOutputConversionEnabled(t *testing.T) {
 
 func TestGetCacheKey(t *testing.T) {
 	m1 := NewDefault()
-	k1, ok := m1.getCacheKey("a = 1")
+	k1, ok := m1.getCacheKey("test.star", "a = 1")
 	if !ok || k1 == "" {
 		t.Errorf("expected a usable key for a string source, got %q ok=%v", k1, ok)
 	}
 
 	// bytes and string of the same content agree
-	if k, _ := m1.getCacheKey([]byte("a = 1")); k != k1 {
+	if k, _ := m1.getCacheKey("test.star", []byte("a = 1")); k != k1 {
 		t.Errorf("expected the byte and string keys to agree, got %q vs %q", k, k1)
 	}
 
 	// reader-like sources cannot be content-keyed and must skip the cache
-	if _, ok := m1.getCacheKey(strings.NewReader("a = 1")); ok {
+	if _, ok := m1.getCacheKey("test.star", strings.NewReader("a = 1")); ok {
 		t.Errorf("expected a reader source to be uncacheable")
 	}
 
+	// so does the filename, recorded in the positions of the program
+	if k, _ := m1.getCacheKey("other.star", "a = 1"); k == k1 {
+		t.Errorf("expected the filename to be part of the key")
+	}
+
 	// a different predeclared name set changes the key
 	m2 := NewDefault()
 	m2.predeclared = starlark.StringDict{"x": starlark.None}
-	if k, _ := m2.getCacheKey("a = 1"); k == k1 {
+	if k, _ := m2.getCacheKey("test.star", "a = 1"); k == k1 {
 		t.Errorf("expected the predeclared name set to be part of the key")
 	}
 
 	// dialect bits change the key
 	m3 := NewDefault()
 	m3.allowRecursion = true
-	if k, _ := m3.getCacheKey("a = 1"); k == k1 {
+	if k, _ := m3.getCacheKey("test.star", "a = 1"); k == k1 {
 		t.Errorf("expected the dialect bits to be part of the key")
 	}
 	m4 := NewDefault()
 	m4.allowGlobalReassign = true
-	if k, _ := m4.getCacheKey("a = 1"); k == k1 {
+	if k, _ := m4.getCacheKey("test.star", "a = 1"); k == k1 {
 		t.Errorf("expected the global-reassign bit to be part of the key")
 	}
 }
@@ -178,3 +183,26 @@ func TestExecStarlarkFileUncacheableSource(t *testing.T) {
 		t.Errorf("expected zz = 9 from the uncached reader source, got: %v", res)
 	}
 }
+
+// TestNewWithBuiltinsRegistered covers that NewWithBuiltins keeps to the
+// modules shipped with Starlet, while NewWithNames takes the registered ones
+// as well. The default registry is swapped for a clone, so the module
+// registered here doesn't leak into other tests.
+func TestNewWithBuiltinsRegistered(t *testing.T) {
+	saved := defaultRegistry
+	defaultRegistry = saved.Clone()
+	defer func() { defaultRegistry = saved }()
+
+	extra := func() (starlark.StringDict, error) { return starlark.StringDict{"extra": starlark.True}, nil }
+	if err := RegisterBuiltinModule("extra", extra, CapPure, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := NewWithBuiltins(nil, nil, nil)
+	if _, ok := m.lazyloadMods["extra"]; ok || len(m.preloadMods) != len(allBuiltinModules) {
+		t.Errorf("expected only the shipped modules, got %v", m.lazyloadMods.Keys())
+	}
+	m = NewWithNames(nil, nil, GetAllBuiltinModuleNames())
+	if _, ok := m.lazyloadMods["extra"]; !ok {
+		t.Errorf("expected the registered module, got %v", m.lazyloadMods.Keys())
+	}
+}
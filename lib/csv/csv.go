@@ -6,6 +6,7 @@ package csv
 import (
 	"bytes"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -72,10 +73,10 @@ func LoadModule() (starlark.StringDict, error) {
 			ModuleName: &starlarkstruct.Module{
 				Name: ModuleName,
 				Members: starlark.StringDict{
-					"read_all":       starlark.NewBuiltin(ModuleName+".read_all", readAll),
-					"try_read_all":   starlark.NewBuiltin(ModuleName+".try_read_all", wrapTry(readAll)),
-					"read_dict":      starlark.NewBuiltin(ModuleName+".read_dict", readDict),
-					"try_read_dict":  starlark.NewBuiltin(ModuleName+".try_read_dict", wrapTry(readDict)),
+					"read_all":       starlark.NewBuiltin(ModuleName+".read_all", dataconv.LimitResult(readAll)),
+					"try_read_all":   starlark.NewBuiltin(ModuleName+".try_read_all", wrapTry(dataconv.LimitResult(readAll))),
+					"read_dict":      starlark.NewBuiltin(ModuleName+".read_dict", dataconv.LimitResult(readDict)),
+					"try_read_dict":  starlark.NewBuiltin(ModuleName+".try_read_dict", wrapTry(dataconv.LimitResult(readDict))),
 					"write_all":      starlark.NewBuiltin(ModuleName+".write_all", writeAll),
 					"try_write_all":  starlark.NewBuiltin(ModuleName+".try_write_all", wrapTry(writeAll)),
 					"write_dict":     starlark.NewBuiltin(ModuleName+".write_dict", writeDict),
@@ -94,6 +95,11 @@ func LoadModule() (starlark.StringDict, error) {
 func wrapTry(fn dataconv.StarlarkFunc) dataconv.StarlarkFunc {
 	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		res, err := fn(thread, b, args, kwargs)
+		var le dataconv.ResourceLimitError
+		if errors.As(err, &le) {
+			// limits of the host are not for the script to recover from
+			return nil, err
+		}
 		if err != nil {
 			return starlark.Tuple{starlark.None, starlark.String(err.Error())}, nil
 		}
@@ -3,6 +3,7 @@ package file
 
 import (
 	"fmt"
+	"os"
 	"sync"
 
 	dc "github.com/1set/starlet/dataconv"
@@ -93,7 +94,7 @@ func countLinesInFile(thread *starlark.Thread, b *starlark.Builtin, args starlar
 
 // readTopOrBottomLines wraps the file reading functions for top or bottom lines to be used in Starlark.
 func readTopOrBottomLines(funcName string, workLoad func(name string, n int) ([]string, error)) starlark.Callable {
-	return starlark.NewBuiltin(ModuleName+"."+funcName, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return starlark.NewBuiltin(ModuleName+"."+funcName, dc.LimitResult(func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		// unpack arguments
 		var (
 			fp tps.StringOrBytes
@@ -131,18 +132,26 @@ func readTopOrBottomLines(funcName string, workLoad func(name string, n int) ([]
 			sl[i] = starlark.String(l)
 		}
 		return starlark.NewList(sl), nil
-	})
+	}))
 }
 
 // wrapReadFile wraps the file reading functions to be used in Starlark.
+// With the resource limits of the thread, a file larger than the limit of strings is not read at all, and the result is checked against the limits.
 func wrapReadFile(funcName string, workLoad func(name string) (starlark.Value, error)) starlark.Callable {
-	return starlark.NewBuiltin(ModuleName+"."+funcName, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return starlark.NewBuiltin(ModuleName+"."+funcName, dc.LimitResult(func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		var fp tps.StringOrBytes
 		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &fp); err != nil {
 			return starlark.None, err
 		}
+		if lim := dc.GetThreadResourceLimits(thread); lim != nil {
+			if fi, err := os.Stat(fp.GoString()); err == nil && fi.Mode().IsRegular() {
+				if err := lim.CheckLen("bytes", int(fi.Size())); err != nil {
+					return nil, fmt.Errorf("%s: %w", b.Name(), err)
+				}
+			}
+		}
 		return workLoad(fp.GoString())
-	})
+	}))
 }
 
 // readBytes reads the whole named file and returns the contents as bytes.
@@ -267,6 +267,14 @@ func sleep(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kw
 	dur := time.Duration(float64(sec) * float64(time.Second))
 	// get the context
 	ctx := dataconv.GetThreadContext(thread)
+	// a virtual clock advances at once instead of waiting
+	if c := dataconv.GetThreadClock(thread); c != nil {
+		if err := ctx.Err(); err != nil {
+			return none, err
+		}
+		c.Advance(dur)
+		return none, nil
+	}
 	// sleep
 	t := time.NewTimer(dur)
 	defer t.Stop()
@@ -336,7 +344,8 @@ func makeCustomSharedDict(thread *starlark.Thread, b *starlark.Builtin, args sta
 	}
 }
 
-// stderrPrint works like standard print() but prints the given arguments to stderr.
+// stderrPrint works like standard print() for diagnostics, it prints the given arguments through the print function of the thread like pprint, or to stderr if not set.
+// Routing through the print function keeps the output under the print limits and capture of the host.
 func stderrPrint(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	sep := " "
 	if err := starlark.UnpackArgs(b.Name(), nil, kwargs, "sep?", &sep); err != nil {
@@ -351,9 +360,13 @@ func stderrPrint(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tup
 		// convert to string
 		buf.WriteString(dataconv.StarString(v))
 	}
-	// write to stderr
+	// write like std print
 	s := buf.String()
-	fmt.Fprintln(os.Stderr, s)
+	if thread.Print != nil {
+		thread.Print(thread, s)
+	} else {
+		fmt.Fprintln(os.Stderr, s)
+	}
 	return starlark.None, nil
 }
 
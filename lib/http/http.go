@@ -6,6 +6,7 @@ package http
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -151,9 +152,9 @@ func (m *Module) LoadModule() (starlark.StringDict, error) {
 	}, nil
 }
 
-// Struct returns this module's supported methods as a starlark Struct
+// Struct returns this module's supported methods as a starlark Struct, constructed by the module name so it's classified as the module wherever it's bound
 func (m *Module) Struct() *starlarkstruct.Struct {
-	return starlarkstruct.FromStringDict(starlarkstruct.Default, m.StringDict())
+	return starlarkstruct.FromStringDict(starlark.String(ModuleName), m.StringDict())
 }
 
 var (
@@ -167,6 +168,11 @@ var (
 func wrapTry(fn func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error)) func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		res, err := fn(thread, b, args, kwargs)
+		var le dataconv.ResourceLimitError
+		if errors.As(err, &le) {
+			// limits of the host are not for the script to recover from
+			return nil, err
+		}
 		if err != nil {
 			return starlark.Tuple{starlark.None, starlark.String(err.Error())}, nil
 		}
@@ -657,8 +663,12 @@ func (r *Response) Struct() *starlarkstruct.Struct {
 // pair. Unlike json() - which folds read and parse failures into None for
 // backward compatibility - it lets scripts tell a parse failure apart from
 // a JSON null.
-func (r *Response) tryJSON(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-	body, err := r.readBody()
+func (r *Response) tryJSON(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	body, err := r.readBody(thread)
+	var le dataconv.ResourceLimitError
+	if errors.As(err, &le) {
+		return nil, err
+	}
 	if err != nil {
 		return starlark.Tuple{starlark.None, starlark.String(err.Error())}, nil
 	}
@@ -667,6 +677,11 @@ func (r *Response) tryJSON(thread *starlark.Thread, _ *starlark.Builtin, args st
 	_ = r.Body.Close()
 	r.Body = ioutil.NopCloser(bytes.NewReader(body))
 
+	// check the limits before decoding
+	if err := dataconv.GetThreadResourceLimits(thread).CheckJSON(body); err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+
 	sv, err := dataconv.UnmarshalStarlarkJSON(body)
 	if err != nil {
 		return starlark.Tuple{starlark.None, starlark.String(err.Error())}, nil
@@ -687,25 +702,44 @@ func (r *Response) HeadersDict() *starlark.Dict {
 
 // readBody reads the whole response body, enforcing the configured size
 // limit: without one, ioutil.ReadAll streamed an attacker-controlled body
-// of any size straight into host memory.
-func (r *Response) readBody() ([]byte, error) {
+// of any size straight into host memory. The string limit of the thread's
+// resource limits applies too, failing with a ResourceLimitError, which
+// reports the Content-Length as the size if it's known, and fails before
+// reading anything then.
+func (r *Response) readBody(thread *starlark.Thread) ([]byte, error) {
 	limit := r.maxBodyBytes
+	lim := dataconv.GetThreadResourceLimits(thread)
+	if lim != nil && lim.MaxStringLen > 0 && (limit <= 0 || int64(lim.MaxStringLen) < limit) {
+		limit = int64(lim.MaxStringLen)
+	}
 	if limit <= 0 {
 		return ioutil.ReadAll(r.Body)
 	}
+	if r.ContentLength > limit {
+		return nil, bodyLimitError(lim, limit, r.ContentLength)
+	}
 	data, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
 	if err != nil {
 		return nil, err
 	}
 	if int64(len(data)) > limit {
-		return nil, fmt.Errorf("response body exceeds the %d-byte limit", limit)
+		return nil, bodyLimitError(lim, limit, int64(len(data)))
 	}
 	return data, nil
 }
 
+// bodyLimitError returns the error for a response body of the given size
+// over the limit, a ResourceLimitError if it's the limit of the thread.
+func bodyLimitError(lim *dataconv.ResourceLimits, limit, size int64) error {
+	if err := lim.CheckLen("bytes", int(size)); err != nil {
+		return fmt.Errorf("response body: %w", err)
+	}
+	return fmt.Errorf("response body exceeds the %d-byte limit", limit)
+}
+
 // Text returns the raw data as a string
 func (r *Response) Text(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-	data, err := r.readBody()
+	data, err := r.readBody(thread)
 	if err != nil {
 		return nil, err
 	}
@@ -719,8 +753,8 @@ func (r *Response) Text(thread *starlark.Thread, _ *starlark.Builtin, args starl
 }
 
 // JSON attempts to parse the response body as JSON
-func (r *Response) JSON(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-	body, err := r.readBody()
+func (r *Response) JSON(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	body, err := r.readBody(thread)
 	if err != nil {
 		return nil, err
 	}
@@ -729,6 +763,11 @@ func (r *Response) JSON(thread *starlark.Thread, _ *starlark.Builtin, args starl
 	_ = r.Body.Close()
 	r.Body = ioutil.NopCloser(bytes.NewReader(body))
 
+	// check the limits before decoding
+	if err := dataconv.GetThreadResourceLimits(thread).CheckJSON(body); err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+
 	// use internal marshaler to support starlark types, returns None on error
 	sv, err := dataconv.UnmarshalStarlarkJSON(body)
 	if err != nil {
@@ -49,6 +49,14 @@ func LoadModule() (starlark.StringDict, error) {
 		for k, v := range stdjson.Module.Members {
 			mod.Members[k] = v
 		}
+		// check the results against the resource limits of the thread
+		for k, v := range mod.Members {
+			if b, ok := v.(*starlark.Builtin); ok {
+				mod.Members[k] = starlark.NewBuiltin(b.Name(), itn.LimitResult(func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+					return b.CallInternal(thread, args, kwargs)
+				}))
+			}
+		}
 		jsonModule = starlark.StringDict{
 			ModuleName: &mod,
 		}
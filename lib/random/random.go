@@ -5,11 +5,13 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/big"
 	"sort"
 	"sync"
 
+	"github.com/1set/starlet/dataconv"
 	tps "github.com/1set/starlet/dataconv/types"
 	guuid "github.com/google/uuid"
 	"go.starlark.net/starlark"
@@ -95,9 +97,12 @@ func randbytes(thread *starlark.Thread, bn *starlark.Builtin, args starlark.Tupl
 	if err != nil {
 		return nil, err
 	}
+	if err := dataconv.GetThreadResourceLimits(thread).CheckLen("bytes", int(ln)); err != nil {
+		return nil, fmt.Errorf("%s: %w", bn.Name(), err)
+	}
 	// get random bytes
 	buf := make([]byte, ln)
-	if _, err := rand.Read(buf); err != nil {
+	if _, err := io.ReadFull(dataconv.GetThreadRandReader(thread), buf); err != nil {
 		return nil, err
 	}
 	return starlark.Bytes(buf), nil
@@ -122,8 +127,11 @@ func randstr(thread *starlark.Thread, bn *starlark.Builtin, args starlark.Tuple,
 	if err != nil {
 		return nil, err
 	}
+	if err := dataconv.GetThreadResourceLimits(thread).CheckLen("string", int(ln)); err != nil {
+		return nil, fmt.Errorf("%s: %w", bn.Name(), err)
+	}
 	// get random strings
-	s, err := getRandStr(ab.GoString(), ln)
+	s, err := getRandStr(dataconv.GetThreadRandReader(thread), ab.GoString(), ln)
 	if err != nil {
 		return nil, err
 	}
@@ -153,7 +161,7 @@ func randb32(thread *starlark.Thread, bn *starlark.Builtin, args starlark.Tuple,
 	}
 	// get random strings
 	const ab = `ABCDEFGHIJKLMNOPQRSTUVWXYZ234567` // standard base32 encoding chars, as defined in RFC 4648.
-	s, err := getRandStr(ab, ln)
+	s, err := getRandStr(dataconv.GetThreadRandReader(thread), ab, ln)
 	if err != nil {
 		return nil, err
 	}
@@ -195,7 +203,7 @@ func randint(thread *starlark.Thread, bn *starlark.Builtin, args starlark.Tuple,
 	)
 	diff := new(big.Int).Sub(bInt, aInt)
 	diff.Add(diff, big.NewInt(1)) // make it inclusive
-	n, err := rand.Int(rand.Reader, diff)
+	n, err := rand.Int(dataconv.GetThreadRandReader(thread), diff)
 	if err != nil {
 		return nil, err
 	}
@@ -216,7 +224,7 @@ func choice(thread *starlark.Thread, bn *starlark.Builtin, args starlark.Tuple,
 		return nil, errors.New(`cannot choose from an empty sequence`)
 	}
 	// get random index
-	i, err := getRandomInt(l)
+	i, err := getRandomInt(dataconv.GetThreadRandReader(thread), l)
 	if err != nil {
 		return nil, err
 	}
@@ -301,11 +309,12 @@ func choices(thread *starlark.Thread, bn *starlark.Builtin, args starlark.Tuple,
 	}
 
 	// create the result list
+	reader := dataconv.GetThreadRandReader(thread)
 	result := make([]starlark.Value, numOfResult)
 	if cumulativeWeights == nil {
 		// Equal probability selection
 		for i := 0; i < numOfResult; i++ {
-			index, err := getRandomInt(n)
+			index, err := getRandomInt(reader, n)
 			if err != nil {
 				return nil, err
 			}
@@ -322,7 +331,7 @@ func choices(thread *starlark.Thread, bn *starlark.Builtin, args starlark.Tuple,
 		}
 
 		for i := 0; i < numOfResult; i++ {
-			r, err := getRandomFloat(1 << 53)
+			r, err := getRandomFloat(reader, 1<<53)
 			if err != nil {
 				return nil, err
 			}
@@ -350,6 +359,7 @@ func shuffle(thread *starlark.Thread, bn *starlark.Builtin, args starlark.Tuple,
 	}
 	// The shuffle algorithm is the Fisher-Yates Shuffle and its complexity is O(n).
 	var (
+		reader    = dataconv.GetThreadRandReader(thread)
 		randBig   = new(big.Int)
 		randBytes = make([]byte, 8)
 		swap      = func(i, j int) error {
@@ -368,7 +378,7 @@ func shuffle(thread *starlark.Thread, bn *starlark.Builtin, args starlark.Tuple,
 		}
 	)
 	for i := uint64(l - 1); i > 0; {
-		if _, err := rand.Read(randBytes); err != nil {
+		if _, err := io.ReadFull(reader, randBytes); err != nil {
 			return nil, err
 		}
 		randBig.SetBytes(randBytes)
@@ -392,7 +402,7 @@ func random(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, k
 		return nil, err
 	}
 	// get random float
-	f, err := getRandomFloat(1 << 53)
+	f, err := getRandomFloat(dataconv.GetThreadRandReader(thread), 1<<53)
 	if err != nil {
 		return nil, err
 	}
@@ -406,7 +416,10 @@ func uuid(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwa
 		return nil, err
 	}
 	// get random UUID
-	u := guuid.New()
+	u, err := guuid.NewRandomFromReader(dataconv.GetThreadRandReader(thread))
+	if err != nil {
+		return nil, err
+	}
 	return starlark.String(u.String()), nil
 }
 
@@ -418,7 +431,7 @@ func uniform(thread *starlark.Thread, bn *starlark.Builtin, args starlark.Tuple,
 		return nil, err
 	}
 	// get random float
-	f, err := getRandomFloat(1 << 53)
+	f, err := getRandomFloat(dataconv.GetThreadRandReader(thread), 1<<53)
 	if err != nil {
 		return nil, err
 	}
@@ -429,34 +442,34 @@ func uniform(thread *starlark.Thread, bn *starlark.Builtin, args starlark.Tuple,
 
 // the following functions are not exposed to Starlark directly, but can be used in other Starlark builtins.
 
-// getRandomInt returns a random integer in the range [0, max).
-func getRandomInt(max int) (int, error) {
+// getRandomInt returns a random integer in the range [0, max) from the given source.
+func getRandomInt(reader io.Reader, max int) (int, error) {
 	if max <= 0 {
 		return 0, errors.New(`max must be > 0`)
 	}
 	maxBig := new(big.Int).SetUint64(uint64(max))
-	n, err := rand.Int(rand.Reader, maxBig)
+	n, err := rand.Int(reader, maxBig)
 	if err != nil {
 		return 0, err
 	}
 	return int(n.Int64()), nil
 }
 
-// getRandomFloat returns a random floating point number in the range [0.0, 1.0).
-func getRandomFloat(prec int64) (n float64, err error) {
+// getRandomFloat returns a random floating point number in the range [0.0, 1.0) from the given source.
+func getRandomFloat(reader io.Reader, prec int64) (n float64, err error) {
 	if prec <= 0 {
 		return 0, errors.New(`prec must be > 0`)
 	}
 	maxBig := new(big.Int).SetUint64(uint64(prec))
-	nBig, err := rand.Int(rand.Reader, maxBig)
+	nBig, err := rand.Int(reader, maxBig)
 	if err != nil {
 		return 0, err
 	}
 	return float64(nBig.Int64()) / float64(prec), nil
 }
 
-// getRandStr returns a random string of given length from given characters.
-func getRandStr(chars string, length int64) (string, error) {
+// getRandStr returns a random string of given length from given characters and the given source.
+func getRandStr(reader io.Reader, chars string, length int64) (string, error) {
 	// basic checks
 	if length <= 0 {
 		return emptyStr, errors.New(`length must be > 0`)
@@ -472,7 +485,7 @@ func getRandStr(chars string, length int64) (string, error) {
 	// get random runes
 	buf := make([]rune, length)
 	for i := range buf {
-		idx, err := getRandomInt(rc)
+		idx, err := getRandomInt(reader, rc)
 		if err != nil {
 			return emptyStr, err
 		}
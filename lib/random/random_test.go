@@ -3,6 +3,7 @@ package random_test
 import (
 	"testing"
 
+	"github.com/1set/starlet/dataconv"
 	itn "github.com/1set/starlet/internal"
 	"github.com/1set/starlet/lib/random"
 	"go.starlark.net/starlark"
@@ -741,3 +742,27 @@ func TestLoadModule_Random(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadModule_Random_Seeded(t *testing.T) {
+	script := itn.HereDoc(`
+		load('random', 'randbytes', 'randstr', 'randb32', 'randint', 'choice', 'choices', 'shuffle', 'random', 'uniform', 'uuid')
+		seq = list(range(10))
+		shuffle(seq)
+		val = [randbytes(4), randstr('abc', 6), randb32(8, 4), randint(1, 1000), choice('xyz'), choices([1, 2, 3], k=4), seq, random(), uniform(1, 2), uuid()]
+	`)
+	run := func(seed int64) string {
+		thread := &starlark.Thread{Load: itn.NewAssertLoader(random.ModuleName, random.LoadModule)}
+		dataconv.SetThreadRandReader(thread, dataconv.NewSeededReader(seed))
+		res, err := starlark.ExecFile(thread, "test.star", script, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return res["val"].String()
+	}
+	if a, b := run(1), run(1); a != b {
+		t.Errorf("expected the same values with the same seed, got:\n%s\n%s", a, b)
+	}
+	if a, b := run(1), run(2); a == b {
+		t.Errorf("expected different values with different seeds, got: %s", a)
+	}
+}
@@ -66,11 +66,14 @@ var (
 	appStart = time.Now()
 )
 
-// getUpTime returns time elapsed since the app started.
+// getUpTime returns time elapsed since the app started, or since the virtual clock of the thread started if any.
 func getUpTime(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
 		return nil, err
 	}
+	if c := dataconv.GetThreadClock(thread); c != nil {
+		return stdtime.Duration(c.Elapsed()), nil
+	}
 	return stdtime.Duration(time.Since(appStart)), nil
 }
 
@@ -83,11 +83,7 @@ func generateDumps(try bool) func(*starlark.Thread, *starlark.Builtin, starlark.
 		if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "value", &v); err != nil {
 			return failResult(try, err, fn, false)
 		}
-		enc, err := encode(v, map[uintptr]bool{})
-		if err != nil {
-			return failResult(try, err, fn, true)
-		}
-		b, err := json.Marshal(enc)
+		b, err := Dumps(v)
 		if err != nil {
 			return failResult(try, err, fn, true)
 		}
@@ -98,6 +94,39 @@ func generateDumps(try bool) func(*starlark.Thread, *starlark.Builtin, starlark.
 	}
 }
 
+// Dumps serializes a Starlark value into the JSON envelope text, the Go-side
+// counterpart of serial.dumps for hosts persisting script values.
+func Dumps(v starlark.Value) (string, error) {
+	enc, err := encode(v, map[uintptr]bool{})
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(enc)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Loads deserializes the JSON envelope text produced by Dumps (or
+// serial.dumps) into a fresh, unfrozen Starlark value.
+func Loads(s string) (starlark.Value, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	// loads round-trips a single value; reject a second JSON value or
+	// trailing garbage rather than silently dropping it. dec.More() is
+	// true only for a further non-whitespace token, so trailing
+	// whitespace/newlines still pass.
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected trailing data after JSON value")
+	}
+	return decode(raw)
+}
+
 // failResult shapes a builtin's failure: a (None, message) tuple for the
 // try_ variants, or a raw/wrapped error otherwise.
 func failResult(try bool, err error, fn *starlark.Builtin, wrap bool) (starlark.Value, error) {
@@ -118,20 +147,7 @@ func generateLoads(try bool) func(*starlark.Thread, *starlark.Builtin, starlark.
 		if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "s", &s); err != nil {
 			return failResult(try, err, fn, false)
 		}
-		dec := json.NewDecoder(strings.NewReader(s))
-		dec.UseNumber()
-		var raw interface{}
-		if err := dec.Decode(&raw); err != nil {
-			return failResult(try, err, fn, true)
-		}
-		// loads round-trips a single value; reject a second JSON value or
-		// trailing garbage rather than silently dropping it. dec.More() is
-		// true only for a further non-whitespace token, so trailing
-		// whitespace/newlines still pass.
-		if dec.More() {
-			return failResult(try, fmt.Errorf("unexpected trailing data after JSON value"), fn, true)
-		}
-		val, err := decode(raw)
+		val, err := Loads(s)
 		if err != nil {
 			return failResult(try, err, fn, true)
 		}
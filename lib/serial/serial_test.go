@@ -427,3 +427,31 @@ func TestLoadModule_Serial(t *testing.T) {
 		})
 	}
 }
+
+func TestDumpsLoads(t *testing.T) {
+	d := starlark.NewDict(2)
+	_ = d.SetKey(starlark.MakeInt(1), starlark.Tuple{starlark.Bytes("a"), starlark.None})
+	_ = d.SetKey(starlark.String("k"), starlark.NewList([]starlark.Value{starlark.Float(1.5)}))
+
+	s, err := serial.Dumps(d)
+	if err != nil {
+		t.Fatalf("Dumps() unexpected error: %v", err)
+	}
+	v, err := serial.Loads(s)
+	if err != nil {
+		t.Fatalf("Loads() unexpected error: %v", err)
+	}
+	if eq, err := starlark.Equal(d, v); err != nil || !eq {
+		t.Errorf("round-trip mismatch: got %v, want %v", v, d)
+	}
+
+	if _, err := serial.Dumps(starlark.NewBuiltin("f", nil)); err == nil {
+		t.Errorf("Dumps(builtin) expects error")
+	}
+	if _, err := serial.Loads(`1 2`); err == nil {
+		t.Errorf("Loads(trailing) expects error")
+	}
+	if _, err := serial.Loads(`{`); err == nil {
+		t.Errorf("Loads(malformed) expects error")
+	}
+}
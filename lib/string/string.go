@@ -10,6 +10,7 @@ import (
 	"sync"
 	"unicode/utf8"
 
+	"github.com/1set/starlet/dataconv"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
 )
@@ -132,6 +133,7 @@ func reverse(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple,
 }
 
 // genStarStrBuiltin generates the string operation builtin for Starlark.
+// The result is checked against the resource limits of the thread, since escaping and quoting grow the string.
 func genStarStrBuiltin(fn string, opFn func(string) string) *starlark.Builtin {
 	sf := func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		if l := len(args); l != 1 {
@@ -147,7 +149,7 @@ func genStarStrBuiltin(fn string, opFn func(string) string) *starlark.Builtin {
 			return none, fmt.Errorf(`%s() function isn't supported for '%s' type object`, fn, v.Type())
 		}
 	}
-	return starlark.NewBuiltin(ModuleName+"."+fn, sf)
+	return starlark.NewBuiltin(ModuleName+"."+fn, dataconv.LimitResult(sf))
 }
 
 // robustUnquote unquotes a string, even if it's not quoted.
@@ -0,0 +1,52 @@
+package starlet
+
+import (
+	"github.com/1set/starlet/dataconv"
+	"go.starlark.net/starlark"
+)
+
+type (
+	// ResourceLimits bounds the sizes of the values made by the builtins of Starlet modules and the output of a run, see Machine.SetResourceLimits.
+	ResourceLimits = dataconv.ResourceLimits
+	// ResourceLimitError is the error when a value exceeds a limit of ResourceLimits. Detect it with errors.As through the execution error chain.
+	ResourceLimitError = dataconv.ResourceLimitError
+)
+
+// SetResourceLimits sets the limits on the sizes of values for the runs and calls of the machine; the zero value, the default, means unlimited.
+//
+// The step budget bounds the computation of a script, but not the memory it takes. The limits guard the host in two places:
+// the builtins of Starlet modules making values from outside of the script — e.g. file.read_*, the bodies of http responses, random.randbytes, csv.read_*, json.decode and the escaping of the string module — fail with a ResourceLimitError for a string, bytes or collection over the limits, before reading or generating the data where possible;
+// and a run or an evaluation fails with a ResourceLimitError if its output to convert is larger than MaxOutputSize.
+// The operators of Starlark itself, e.g. "x" * 10**9, are not covered, they are bounded by the step budget and the allocation limit of Starlark.
+func (m *Machine) SetResourceLimits(limits ResourceLimits) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.limits = limits
+}
+
+// applyResourceLimits sets the resource limits on the thread, or removes them if unlimited.
+func (m *Machine) applyResourceLimits(t *starlark.Thread) {
+	if m.limits == (ResourceLimits{}) {
+		dataconv.SetThreadResourceLimits(t, nil)
+		return
+	}
+	lim := m.limits
+	dataconv.SetThreadResourceLimits(t, &lim)
+}
+
+// checkOutputSize returns a ResourceLimitError if the output of a run is larger than the limit; the result of an evaluation is checked as a value with an empty name.
+func (m *Machine) checkOutputSize(d starlark.StringDict) error {
+	limit := m.limits.MaxOutputSize
+	if limit <= 0 {
+		return nil
+	}
+	size := 0
+	for k, v := range d {
+		size += len(k) + dataconv.ValueSize(v)
+	}
+	if size > limit {
+		return ResourceLimitError{Kind: "output", Size: size, Limit: limit}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package starlet_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/1set/starlet"
+)
+
+func TestMachine_SetResourceLimits(t *testing.T) {
+	dir := t.TempDir()
+	big := filepath.Join(dir, "big.txt")
+	if err := os.WriteFile(big, []byte(strings.Repeat("x\n", 50)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[` + strings.Repeat(`1,`, 40) + `1]`))
+	}))
+	defer srv.Close()
+
+	limits := starlet.ResourceLimits{MaxStringLen: 64, MaxCollectionLen: 32}
+	tests := []struct {
+		name   string
+		script string
+		lim    *starlet.ResourceLimits
+		want   *starlet.ResourceLimitError
+	}{
+		{
+			name:   "within limits",
+			script: `load("json", "decode"); x = decode("[1, 2, 3]")`,
+		},
+		{
+			name:   "read file",
+			script: `load("file", "read_string"); x = read_string(path)`,
+			want:   &starlet.ResourceLimitError{Kind: "bytes", Size: 100, Limit: 64},
+		},
+		{
+			name:   "file lines",
+			script: `load("file", "head_lines"); x = head_lines(path, 40)`,
+			want:   &starlet.ResourceLimitError{Kind: "list", Size: 40, Limit: 32},
+		},
+		{
+			name:   "random bytes",
+			script: `load("random", "randbytes"); x = randbytes(65)`,
+			want:   &starlet.ResourceLimitError{Kind: "bytes", Size: 65, Limit: 64},
+		},
+		{
+			name:   "json decode",
+			script: `load("json", "decode"); x = decode("[" + "0," * 40 + "0]")`,
+			want:   &starlet.ResourceLimitError{Kind: "list", Size: 41, Limit: 32},
+		},
+		{
+			name:   "try variant of json",
+			script: `load("json", "try_decode"); x = try_decode("[" + "0," * 40 + "0]")`,
+			want:   &starlet.ResourceLimitError{Kind: "list", Size: 41, Limit: 32},
+		},
+		{
+			name:   "csv",
+			script: `load("csv", "try_read_all"); x = try_read_all("a\n" * 40)`,
+			want:   &starlet.ResourceLimitError{Kind: "list", Size: 40, Limit: 32},
+		},
+		{
+			name:   "string escape",
+			script: `load("string", "escape"); x = escape("<>" * 10)`,
+			want:   &starlet.ResourceLimitError{Kind: "string", Size: 80, Limit: 64},
+		},
+		{
+			name:   "http body",
+			script: `load("http", "get"); x = get(url).body()`,
+			want:   &starlet.ResourceLimitError{Kind: "bytes", Size: 83, Limit: 64},
+		},
+		{
+			name:   "http try_json",
+			script: `load("http", "get"); x = get(url).try_json()`,
+			want:   &starlet.ResourceLimitError{Kind: "bytes", Size: 83, Limit: 64},
+		},
+		{
+			name:   "http json",
+			script: `load("http", "get"); x = get(url).json()`,
+			lim:    &starlet.ResourceLimits{MaxCollectionLen: 32},
+			want:   &starlet.ResourceLimitError{Kind: "list", Size: 41, Limit: 32},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := starlet.NewWithNames(starlet.StringAnyMap{"path": big, "url": srv.URL}, nil, []string{"file", "random", "json", "csv", "string", "http"})
+			if tt.lim != nil {
+				m.SetResourceLimits(*tt.lim)
+			} else {
+				m.SetResourceLimits(limits)
+			}
+			m.SetScript("test.star", []byte(tt.script), nil)
+			_, err := m.Run()
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var le starlet.ResourceLimitError
+			if !errors.As(err, &le) || le != *tt.want {
+				t.Errorf("expected %v, got: %v", *tt.want, err)
+			}
+		})
+	}
+}
+
+func TestMachine_SetResourceLimits_Output(t *testing.T) {
+	m := starlet.NewDefault()
+	m.SetResourceLimits(starlet.ResourceLimits{MaxOutputSize: 100})
+	m.SetScript("test.star", []byte(`x = "a" * 50`), nil)
+	if _, err := m.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m.SetScript("test.star", []byte(`y = ["b" * 50, {"k": "c" * 50}]`), nil)
+	out, err := m.Run()
+	var le starlet.ResourceLimitError
+	if !errors.As(err, &le) || le.Kind != "output" || le.Limit != 100 {
+		t.Errorf("expected ResourceLimitError of output, got: %v", err)
+	}
+	expectErr(t, err, "starlet: output: output of size")
+	if out != nil {
+		t.Errorf("expected no output, got: %v", out)
+	}
+
+	// unlimited again
+	m.SetResourceLimits(starlet.ResourceLimits{})
+	if _, err := m.Run(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
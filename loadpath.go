@@ -0,0 +1,175 @@
+package starlet
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// OverlayFS is an ordered search path of filesystems with overlay semantics: a file in an earlier root shadows the files of the same name in the later ones.
+// It's useful for layering tenant overrides and vendored libraries over embedded defaults, e.g. NewOverlayFS(overrides, vendored, embedded).
+type OverlayFS []fs.FS
+
+// NewOverlayFS creates an OverlayFS of the given roots in the order of precedence, nil roots are skipped.
+func NewOverlayFS(roots ...fs.FS) OverlayFS {
+	o := make(OverlayFS, 0, len(roots))
+	for _, r := range roots {
+		if r != nil {
+			o = append(o, r)
+		}
+	}
+	return o
+}
+
+// Open opens the named file from the first root holding it.
+// A root failing with an error other than not-found stops the search, so a broken or forbidden override is not silently replaced by a lower layer.
+func (o OverlayFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	for _, r := range o {
+		f, err := r.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir reads the named directory merged across all roots, sorted by filename; an entry of an earlier root shadows the ones of the same name in the later ones.
+func (o OverlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	var (
+		found   bool
+		entries []fs.DirEntry
+		seen    = make(map[string]bool)
+	)
+	for _, r := range o {
+		des, err := fs.ReadDir(r, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, de := range des {
+			if !seen[de.Name()] {
+				seen[de.Name()] = true
+				entries = append(entries, de)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+var (
+	_ fs.FS        = OverlayFS(nil)
+	_ fs.ReadDirFS = OverlayFS(nil)
+)
+
+// SetModuleSearchPath sets the filesystems searched in order by load() after the script filesystem, with overlay semantics, see OverlayFS.
+// It takes effect for the modules not loaded yet, and the script itself is still read from the script filesystem only.
+func (m *Machine) SetModuleSearchPath(roots ...fs.FS) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.searchPath = roots
+}
+
+// getLoadFS returns the filesystem load() reads modules from: the script filesystem followed by the search path, or nil if there is none.
+func (m *Machine) getLoadFS() fs.FS {
+	if len(m.searchPath) == 0 {
+		return m.scriptFS
+	}
+	o := NewOverlayFS(append([]fs.FS{m.scriptFS}, m.searchPath...)...)
+	if len(o) == 0 {
+		return nil
+	}
+	return o
+}
+
+// parseLoadPath resolves the path-like module names of load() against the directory of the loading module:
+//
+//   - "//pkg/dir:file.star" is a package-style label for "pkg/dir/file.star" from the root, and "//dir/file.star" a path from the root;
+//   - ":file.star" is a label for the file in the package (i.e. the directory) of the loading module;
+//   - "./file.star" and "../dir/file.star" are paths relative to the directory of the loading module.
+//
+// It reports false for other names, which are module names or paths from the root. A path escaping the root is an error.
+func parseLoadPath(from, module string) (string, bool, error) {
+	var p string
+	switch {
+	case strings.HasPrefix(module, "//"):
+		label := module[2:]
+		if pkg, file, ok := strings.Cut(label, ":"); ok {
+			if file == "" {
+				return "", true, fmt.Errorf("invalid module label: %q", module)
+			}
+			p = path.Join(pkg, file)
+		} else {
+			p = path.Clean(label)
+		}
+	case strings.HasPrefix(module, ":"):
+		if module == ":" {
+			return "", true, fmt.Errorf("invalid module label: %q", module)
+		}
+		p = path.Join(path.Dir(from), module[1:])
+	case strings.HasPrefix(module, "./"), strings.HasPrefix(module, "../"):
+		p = path.Join(path.Dir(from), module)
+	default:
+		return module, false, nil
+	}
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") || !fs.ValidPath(p) {
+		return "", true, fmt.Errorf("invalid module path: %q escapes the root", module)
+	}
+	return p, true, nil
+}
+
+// resolveLoadName returns the name of the module to load from the loading module: path-like names are resolved by parseLoadPath, and a plain name in a module of a subdirectory refers to the file next to the loading module if there is one and it's not a lazyload module, or otherwise is looked up as it is.
+// The returned name is the key of the load cache and the filename of the loaded module, which makes the relative names of nested loads resolve against it in turn.
+func (m *Machine) resolveLoadName(from, module string) (string, error) {
+	p, isPath, err := parseLoadPath(from, module)
+	if err != nil || isPath {
+		return p, err
+	}
+	dir := path.Dir(from)
+	if dir == "." || from == "" {
+		return module, nil
+	}
+	if _, ok := m.lazyloadMods[module]; ok {
+		return module, nil
+	}
+	rel := path.Join(dir, module)
+	if lfs := m.getLoadFS(); lfs != nil && fs.ValidPath(rel) {
+		name := rel
+		if !strings.HasSuffix(name, ".star") {
+			name += ".star"
+		}
+		if _, err := fs.Stat(lfs, name); err == nil {
+			return rel, nil
+		}
+	}
+	return module, nil
+}
+
+// loadingModule returns the filename of the module executing the load statement on the thread, or empty if unknown.
+func loadingModule(thread *starlark.Thread) string {
+	if thread == nil || thread.CallStackDepth() == 0 {
+		return ""
+	}
+	return thread.CallFrame(0).Pos.Filename()
+}
@@ -0,0 +1,131 @@
+package starlet_test
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/1set/starlet"
+)
+
+func TestOverlayFS(t *testing.T) {
+	upper := fstest.MapFS{
+		"lib/a.star": &fstest.MapFile{Data: []byte("upper a")},
+	}
+	lower := fstest.MapFS{
+		"lib/a.star": &fstest.MapFile{Data: []byte("lower a")},
+		"lib/b.star": &fstest.MapFile{Data: []byte("lower b")},
+	}
+	o := starlet.NewOverlayFS(upper, nil, lower)
+	if len(o) != 2 {
+		t.Fatalf("expected nil roots skipped, got %d roots", len(o))
+	}
+
+	for name, want := range map[string]string{
+		"lib/a.star": "upper a",
+		"lib/b.star": "lower b",
+	} {
+		b, err := fs.ReadFile(o, name)
+		if err != nil {
+			t.Errorf("read %s: unexpected error: %v", name, err)
+		} else if string(b) != want {
+			t.Errorf("read %s: expected %q, got %q", name, want, b)
+		}
+	}
+	if _, err := o.Open("lib/c.star"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist error, got: %v", err)
+	}
+	if _, err := o.Open("../a.star"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("expected invalid path error, got: %v", err)
+	}
+
+	des, err := fs.ReadDir(o, "lib")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, de := range des {
+		names = append(names, de.Name())
+	}
+	expectStrings(t, "entries", names, []string{"a.star", "b.star"})
+	if _, err := fs.ReadDir(o, "none"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist error, got: %v", err)
+	}
+
+	// an error other than not-found in an upper root is not masked
+	if _, err := starlet.NewOverlayFS(permErrFS{}, lower).Open("lib/b.star"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("expected permission error, got: %v", err)
+	}
+}
+
+func TestMachine_SetModuleSearchPath(t *testing.T) {
+	scripts := fstest.MapFS{
+		"main.star":      &fstest.MapFile{Data: []byte(`load("shared", "v"); load("//vendor/net:util.star", "u"); x = v; y = u`)},
+		"shared.star":    &fstest.MapFile{Data: []byte(`v = "override"`)},
+		"tenant/ok.star": &fstest.MapFile{Data: []byte(`t = 1`)},
+	}
+	vendored := fstest.MapFS{
+		"vendor/net/util.star":   &fstest.MapFile{Data: []byte(`load(":helper.star", "h"); u = "util+" + h`)},
+		"vendor/net/helper.star": &fstest.MapFile{Data: []byte(`h = "helper"`)},
+	}
+	defaults := fstest.MapFS{
+		"shared.star": &fstest.MapFile{Data: []byte(`v = "default"`)},
+	}
+
+	m := starlet.NewDefault()
+	m.SetScript("main.star", nil, scripts)
+	m.SetModuleSearchPath(vendored, defaults)
+	out, err := m.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out["x"] != "override" || out["y"] != "util+helper" {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	// without the search path, the vendored module is not found
+	m = starlet.NewDefault()
+	m.SetScript("main.star", nil, scripts)
+	_, err = m.Run()
+	var nf starlet.ModuleNotFoundError
+	if !errors.As(err, &nf) || nf.Name != "vendor/net/util.star" {
+		t.Errorf("expected ModuleNotFoundError, got: %v", err)
+	}
+}
+
+func TestMachine_LoadRelativePath(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/main.star":        &fstest.MapFile{Data: []byte(`load("util", "a"); load("./sub/deep.star", "b"); load("//lib:common.star", "c"); load("json", "encode"); x = [a, b, c, encode(1)]`)},
+		"app/util.star":        &fstest.MapFile{Data: []byte(`a = "app util"`)},
+		"app/sub/deep.star":    &fstest.MapFile{Data: []byte(`load("../util.star", "a"); load("other", "o"); b = a + "/" + o`)},
+		"other.star":           &fstest.MapFile{Data: []byte(`o = "root other"`)},
+		"util.star":            &fstest.MapFile{Data: []byte(`a = "root util"`)},
+		"lib/common.star":      &fstest.MapFile{Data: []byte(`c = "common"`)},
+		"app/escape.star":      &fstest.MapFile{Data: []byte(`load("../../secret.star", "s")`)},
+		"app/bad_label.star":   &fstest.MapFile{Data: []byte(`load("//lib:", "s")`)},
+		"app/rel_missing.star": &fstest.MapFile{Data: []byte(`load(":nope.star", "s")`)},
+	}
+
+	m := starlet.NewWithNames(nil, nil, []string{"json"})
+	m.SetScript("app/main.star", nil, fsys)
+	out, err := m.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, ok := out["x"].([]interface{}); !ok || len(got) != 4 ||
+		got[0] != "app util" || got[1] != "app util/root other" || got[2] != "common" || got[3] != "1" {
+		t.Errorf("unexpected output: %v", out["x"])
+	}
+
+	for script, errMsg := range map[string]string{
+		"app/escape.star":      `starlark: exec: cannot load ../../secret.star: invalid module path: "../../secret.star" escapes the root`,
+		"app/bad_label.star":   `starlark: exec: cannot load //lib:: invalid module label: "//lib:"`,
+		"app/rel_missing.star": `starlark: exec: cannot load :nope.star: module "app/nope.star" not found`,
+	} {
+		m := starlet.NewDefault()
+		m.SetScript(script, nil, fsys)
+		_, err := m.Run()
+		expectErr(t, err, errMsg)
+	}
+}
@@ -37,24 +37,43 @@ type Machine struct {
 	// set variables
 	globals             StringAnyMap
 	preloadMods         ModuleLoaderList
+	preloadNames        []string // registered names of preloadMods by index if made by names, see loadAll
 	lazyloadMods        ModuleLoaderMap
 	printFunc           PrintFunc
+	maxPrintBytes       uint64
+	maxPrintLines       uint64
+	hooks               *Hooks
+	reload              *hotReload
+	determ              *deterministic
+	trace               *tracer
+	dryRun              *dryRun
+	audit               AuditSink
+	profile             *profiler
 	allowGlobalReassign bool
 	allowRecursion      bool
 	enableInConv        bool
 	enableOutConv       bool
 	customTag           string
 	maxSteps            uint64
+	limits              ResourceLimits
+	capDeny             ModuleCapability
+	registry            *ModuleRegistry
 	// source code
 	scriptName    string
 	scriptContent []byte
 	scriptFS      fs.FS
+	searchPath    []fs.FS
 	// runtime core
 	progCache   ByteCache
 	runTimes    uint
 	loadCache   *cache
 	thread      *starlark.Thread
 	predeclared starlark.StringDict
+	printed     *printOutput        // output of the current execution, see SetPrintLimits
+	capture     bool                // whether the output is captured, see RunCaptured
+	emit        EmitFunc            // receiver of the values emitted by the script, see RunStream
+	hostBound   starlark.StringDict // values bound by globals and preload modules, see Snapshot
+	frozenBound starlark.StringDict // values frozen by the machine itself, i.e. the results of runs and restored values, see Clone
 }
 
 // String renders a snapshot of the machine's state. Every field it reads is
@@ -117,15 +136,18 @@ func NewWithLoaders(globals StringAnyMap, preload ModuleLoaderList, lazyload Mod
 }
 
 // NewWithBuiltins creates a new Starlark runtime environment with given global variables and all preload & lazyload built-in modules.
+// The built-in modules are the ones shipped with Starlet; the modules added by RegisterBuiltinModule are not included, pass GetAllBuiltinModuleNames to NewWithNames to have them as well.
 func NewWithBuiltins(globals StringAnyMap, additionalPreload ModuleLoaderList, additionalLazyload ModuleLoaderMap) *Machine {
-	pre := append(GetAllBuiltinModules(), additionalPreload...)
-	lazy := GetBuiltinModuleMap()
+	all := allBuiltinModules.Clone()
+	pre := append(all.Values(), additionalPreload...)
+	lazy := all.Clone()
 	lazy.Merge(additionalLazyload)
 	return &Machine{
 		enableInConv:  true,
 		enableOutConv: true,
 		globals:       globals,
 		preloadMods:   pre,
+		preloadNames:  all.Keys(),
 		lazyloadMods:  lazy,
 	}
 }
@@ -146,6 +168,7 @@ func NewWithNames(globals StringAnyMap, preloads []string, lazyloads []string) *
 		enableOutConv: true,
 		globals:       globals,
 		preloadMods:   pre,
+		preloadNames:  append([]string(nil), preloads...),
 		lazyloadMods:  lazy,
 	}
 }
@@ -188,6 +211,7 @@ func (m *Machine) SetPreloadModules(mods ModuleLoaderList) {
 	defer m.mu.Unlock()
 
 	m.preloadMods = mods
+	m.preloadNames = nil
 }
 
 // GetPreloadModules gets the preload modules of the Starlark runtime environment.
@@ -363,6 +387,26 @@ func (m *Machine) SetMaxExecutionSteps(steps uint64) {
 	m.maxSteps = steps
 }
 
+// SetCapabilityPolicy sets the capabilities denied to the modules of the machine; CapPure (the default) denies nothing.
+// A module with any denied capability fails to load with a ModuleDeniedError, whether it's a preload module, a lazyload module, or a name resolved by load() from any source.
+// Modules are classified by their registered names, or the names of the modules or structs they bind, so custom modules should declare their capabilities with RegisterModuleCapability to be covered.
+// The policy applies to lazyload modules from the next run, and to preload modules before the first run or after a reset; modules already loaded are not revoked.
+func (m *Machine) SetCapabilityPolicy(deny ModuleCapability) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.capDeny = deny
+}
+
+// SetModuleRegistry sets the registry classifying the modules of the machine for the capability policy, and telling a builtin module withheld from the machine apart from an unknown one; nil means the default registry.
+// It doesn't change the preload and lazyload modules themselves, use ModuleRegistry.NewMachine to create a machine with modules of a registry.
+func (m *Machine) SetModuleRegistry(r *ModuleRegistry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.registry = r
+}
+
 // EnableRecursionSupport enables recursion support in all Starlark environments.
 func (m *Machine) EnableRecursionSupport() {
 	m.mu.Lock()
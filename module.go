@@ -30,20 +30,49 @@ func (l ModuleLoaderList) Clone() []ModuleLoader {
 // LoadAll loads all modules in the list into the given StringDict.
 // It returns an error as second return value if any module fails to load.
 func (l ModuleLoaderList) LoadAll(d starlark.StringDict) error {
+	return l.LoadAllWithPolicy(d, CapPure)
+}
+
+// LoadAllWithPolicy is like LoadAll, but it fails with a ModuleDeniedError if any module has a capability in deny.
+// A module is classified by the names of the modules or structs it binds, see RegisterModuleCapability.
+func (l ModuleLoaderList) LoadAllWithPolicy(d starlark.StringDict, deny ModuleCapability) error {
+	return l.loadAll(d, nil, defaultRegistry, deny, nil)
+}
+
+// loadAll loads all modules in the list, classifying them with the given registry for the policy.
+// The names are the registered names of the loaders by index, if known, e.g. of the lists made by names; an empty or missing name leaves the module classified only by what it binds.
+// If origin is not nil, it's filled with the registered name of the module each loaded member comes from, if known.
+func (l ModuleLoaderList) loadAll(d starlark.StringDict, names []string, reg *ModuleRegistry, deny ModuleCapability, origin map[string]string) error {
 	if d == nil {
 		return errorStarletErrorf(`load`, "cannot load modules into nil dict")
 	}
-	for _, ld := range l {
+	for i, ld := range l {
 		if ld == nil {
 			return errorStarletErrorf(`load`, "nil module loader")
 		}
+		var bn string
+		if i < len(names) {
+			bn = names[i]
+		}
+		found := bn != ""
+		if found {
+			if err := reg.checkPolicy(bn, deny); err != nil {
+				return errorStarletError(`load`, err)
+			}
+		}
 		m, err := ld()
 		if err != nil {
 			return errorStarletError(`load`, err)
 		}
+		if err := reg.checkBoundPolicy(m, deny); err != nil {
+			return errorStarletError(`load`, err)
+		}
 		if m != nil {
 			for k, v := range m {
 				d[k] = v
+				if found && origin != nil {
+					origin[k] = bn
+				}
 			}
 		}
 	}
@@ -53,14 +82,7 @@ func (l ModuleLoaderList) LoadAll(d starlark.StringDict) error {
 // MakeBuiltinModuleLoaderList creates a list of module loaders from a list of module names.
 // It returns an error as second return value if any module is not found.
 func MakeBuiltinModuleLoaderList(names ...string) (ModuleLoaderList, error) {
-	ld := make(ModuleLoaderList, len(names))
-	for i, name := range names {
-		ld[i] = allBuiltinModules[name]
-		if ld[i] == nil {
-			return ld, errorStarletErrorf(`make`, "module not found: %s", name)
-		}
-	}
-	return ld, nil
+	return defaultRegistry.MakeLoaderList(names...)
 }
 
 // ModuleLoaderMap is a map of Starlark module loaders, usually used to load a map of modules by name.
@@ -110,6 +132,17 @@ func (m ModuleLoaderMap) Merge(other ModuleLoaderMap) {
 // Otherwise, the first return value is nil if the module is not found.
 // Note that the loader is usually used by the Starlark thread, so that the errors should not be wrapped.
 func (m ModuleLoaderMap) GetLazyLoader() NamedModuleLoader {
+	return m.GetLazyLoaderWithPolicy(CapPure)
+}
+
+// GetLazyLoaderWithPolicy is like GetLazyLoader, but the loader returns a ModuleDeniedError instead of loading a module with any capability in deny.
+// A module is classified by its name, or by the names of the modules or structs it binds, see RegisterModuleCapability.
+func (m ModuleLoaderMap) GetLazyLoaderWithPolicy(deny ModuleCapability) NamedModuleLoader {
+	return m.lazyLoader(defaultRegistry, deny)
+}
+
+// lazyLoader returns a lazy loader classifying the modules with the given registry for the policy.
+func (m ModuleLoaderMap) lazyLoader(reg *ModuleRegistry, deny ModuleCapability) NamedModuleLoader {
 	return func(s string) (starlark.StringDict, error) {
 		// if the map or the name is empty, just return nil to indicate not found
 		if m == nil || s == "" {
@@ -124,12 +157,20 @@ func (m ModuleLoaderMap) GetLazyLoader() NamedModuleLoader {
 			// found but nil
 			return nil, errors.New("nil module loader")
 		}
+		// check against the policy before loading
+		if err := reg.checkPolicy(s, deny); err != nil {
+			return nil, err
+		}
 		// try to load it
 		d, err := ld()
 		if err != nil {
 			// failed to load
 			return nil, err
 		}
+		// a loader of another module must not pass it off under this name
+		if err := reg.checkBoundPolicy(d, deny); err != nil {
+			return nil, err
+		}
 		// extract all members of module from dict like `{name: module}` or `{name: struct}`
 		if len(d) == 1 {
 			m, found := d[s]
@@ -148,17 +189,39 @@ func (m ModuleLoaderMap) GetLazyLoader() NamedModuleLoader {
 	}
 }
 
+// checkBoundPolicy checks the modules and structs bound by a loaded dict against the policy by their names, i.e. the keys they're bound to, and the names of the modules and the constructors of the structs, so a custom loader cannot pass a classified module off under its own or any other name.
+func (r *ModuleRegistry) checkBoundPolicy(d starlark.StringDict, deny ModuleCapability) error {
+	if deny == CapPure {
+		return nil
+	}
+	for _, k := range d.Keys() {
+		var name string
+		switch t := d[k].(type) {
+		case *starlarkstruct.Module:
+			name = t.Name
+		case *starlarkstruct.Struct:
+			if ctor, ok := t.Constructor().(starlark.String); ok {
+				name = string(ctor)
+			}
+		default:
+			continue
+		}
+		if err := r.checkPolicy(k, deny); err != nil {
+			return err
+		}
+		if name != "" && name != k {
+			if err := r.checkPolicy(name, deny); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // MakeBuiltinModuleLoaderMap creates a map of module loaders from a list of module names.
 // It returns an error as second return value if any module is not found.
 func MakeBuiltinModuleLoaderMap(names ...string) (ModuleLoaderMap, error) {
-	ld := make(ModuleLoaderMap, len(names))
-	for _, name := range names {
-		ld[name] = allBuiltinModules[name]
-		if ld[name] == nil {
-			return ld, errorStarletErrorf(`make`, "module not found: %s", name)
-		}
-	}
-	return ld, nil
+	return defaultRegistry.MakeLoaderMap(names...)
 }
 
 // MakeModuleLoaderFromStringDict creates a module loader from the given string dict.
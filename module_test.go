@@ -1,6 +1,7 @@
 package starlet_test
 
 import (
+	"errors"
 	"io"
 	"io/fs"
 	"os"
@@ -1363,6 +1364,163 @@ func TestGetBuiltinModuleNamesWithoutCapabilities(t *testing.T) {
 	}
 }
 
+func TestRegisterModuleCapability(t *testing.T) {
+	if err := starlet.RegisterModuleCapability("cap_reg_mod", starlet.CapNetwork); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// re-registering the same set is idempotent, a different one is refused
+	if err := starlet.RegisterModuleCapability("cap_reg_mod", starlet.CapNetwork); err != nil {
+		t.Errorf("expected no error for the same set, got: %v", err)
+	}
+	if err := starlet.RegisterModuleCapability("cap_reg_mod", starlet.CapPure); err == nil {
+		t.Errorf("expected an error for loosening a registered set")
+	}
+	// builtin modules keep their own classification
+	if err := starlet.RegisterModuleCapability("http", starlet.CapPure); err == nil {
+		t.Errorf("expected an error for a builtin module name")
+	}
+	if err := starlet.RegisterModuleCapability("", starlet.CapPure); err == nil {
+		t.Errorf("expected an error for an empty name")
+	}
+
+	if c, ok := starlet.GetModuleCapability("cap_reg_mod"); !ok || c != starlet.CapNetwork {
+		t.Errorf("GetModuleCapability(cap_reg_mod) = %v, %v", c, ok)
+	}
+	if c, ok := starlet.GetModuleCapability("file"); !ok || c != starlet.CapFileSystem {
+		t.Errorf("GetModuleCapability(file) = %v, %v", c, ok)
+	}
+	if _, ok := starlet.GetModuleCapability("no_such_module"); ok {
+		t.Errorf("expected ok=false for an unclassified module name")
+	}
+}
+
+// mustLoadMember loads the builtin module and returns its member.
+func mustLoadMember(t *testing.T, module, member string) starlark.Value {
+	t.Helper()
+	d, err := starlet.GetBuiltinModule(module)()
+	if err != nil || d[member] == nil {
+		t.Fatalf("load %s.%s: %v", module, member, err)
+	}
+	return d[member]
+}
+
+func TestMachine_SetCapabilityPolicy(t *testing.T) {
+	if err := starlet.RegisterModuleCapability("cap_policy_mod", starlet.CapFileSystem); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	pureMod := func() (starlark.StringDict, error) {
+		return starlark.StringDict{"answer": starlark.MakeInt(42)}, nil
+	}
+	deny := starlet.CapNetwork | starlet.CapFileSystem
+
+	tests := []struct {
+		name     string
+		preload  starlet.ModuleLoaderList
+		lazyload starlet.ModuleLoaderMap
+		script   string
+		denied   string
+		cap      starlet.ModuleCapability
+	}{
+		{
+			name:     "allowed lazyload",
+			lazyload: starlet.ModuleLoaderMap{"json": starlet.GetBuiltinModule("json")},
+			script:   `load("json", "encode"); x = encode(1)`,
+		},
+		{
+			name:     "denied lazyload",
+			lazyload: starlet.ModuleLoaderMap{"http": starlet.GetBuiltinModule("http")},
+			script:   `load("http", "get")`,
+			denied:   "http",
+			cap:      starlet.CapNetwork,
+		},
+		{
+			name:     "denied builtin loader under another name",
+			lazyload: starlet.ModuleLoaderMap{"web": starlet.GetBuiltinModule("http")},
+			script:   `load("web", "get")`,
+			denied:   "http",
+			cap:      starlet.CapNetwork,
+		},
+		{
+			name:     "denied registered custom module",
+			lazyload: starlet.ModuleLoaderMap{"cap_policy_mod": pureMod},
+			script:   `load("cap_policy_mod", "answer")`,
+			denied:   "cap_policy_mod",
+			cap:      starlet.CapFileSystem,
+		},
+		{
+			name:   "denied withheld builtin",
+			script: `load("file", "read_string")`,
+			denied: "file",
+			cap:    starlet.CapFileSystem,
+		},
+		{
+			name:    "denied preload",
+			preload: starlet.ModuleLoaderList{starlet.GetBuiltinModule("path")},
+			script:  `x = 1`,
+			denied:  "path",
+			cap:     starlet.CapFileSystem,
+		},
+		{
+			name:    "denied preload by bound module name",
+			preload: starlet.ModuleLoaderList{func() (starlark.StringDict, error) { return starlet.GetBuiltinModule("net")() }},
+			script:  `x = 1`,
+			denied:  "net",
+			cap:     starlet.CapNetwork,
+		},
+		{
+			name: "denied builtin module under an unregistered key",
+			preload: starlet.ModuleLoaderList{func() (starlark.StringDict, error) {
+				return starlark.StringDict{"f": mustLoadMember(t, "file", "file")}, nil
+			}},
+			script: `x = 1`,
+			denied: "file",
+			cap:    starlet.CapFileSystem,
+		},
+		{
+			name: "denied lazyload builtin module under an unregistered key",
+			lazyload: starlet.ModuleLoaderMap{"mine": func() (starlark.StringDict, error) {
+				return starlark.StringDict{"x": mustLoadMember(t, "http", "http")}, nil
+			}},
+			script: `load("mine", "x")`,
+			denied: "http",
+			cap:    starlet.CapNetwork,
+		},
+		{
+			name:     "allowed unclassified custom module",
+			lazyload: starlet.ModuleLoaderMap{"mine": pureMod},
+			script:   `load("mine", "answer")`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := starlet.NewWithLoaders(nil, tt.preload, tt.lazyload)
+			m.SetCapabilityPolicy(deny)
+			m.SetScript("test.star", []byte(tt.script), nil)
+			_, err := m.Run()
+			if tt.denied == "" {
+				if err != nil {
+					t.Errorf("expected no error, got: %v", err)
+				}
+				return
+			}
+			var de starlet.ModuleDeniedError
+			if !errors.As(err, &de) {
+				t.Fatalf("expected ModuleDeniedError via errors.As, got: %v", err)
+			}
+			if de.Name != tt.denied || de.Capability != tt.cap {
+				t.Errorf("expected denied %q for %v, got: %q for %v", tt.denied, tt.cap, de.Name, de.Capability)
+			}
+		})
+	}
+
+	// without a policy, everything loads as before
+	m := starlet.NewWithLoaders(nil, nil, starlet.ModuleLoaderMap{"http": starlet.GetBuiltinModule("http")})
+	m.SetScript("test.star", []byte(`load("http", "get")`), nil)
+	if _, err := m.Run(); err != nil {
+		t.Errorf("expected no error, got: %v", err)
+	}
+}
+
 // --- documentation coverage (folded in from the former doc_coverage_test.go) ---
 
 // libReadmeDir maps a builtin module name to its lib/<dir> documentation
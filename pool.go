@@ -0,0 +1,298 @@
+package starlet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+
+	itn "github.com/1set/starlet/internal"
+)
+
+// PoolResetPolicy controls whether a Machine is reset when it is returned to a MachinePool.
+type PoolResetPolicy uint8
+
+const (
+	// PoolResetAlways resets every released Machine, so each borrower starts from the freshly pre-warmed state and no globals leak between borrowers.
+	PoolResetAlways PoolResetPolicy = iota
+	// PoolResetOnError resets a released Machine only if the borrower reports a failure with ReleaseWithError, keeping the state of successful runs for the next borrower.
+	PoolResetOnError
+	// PoolResetNever never resets released Machines, the results of each run are carried to the next borrower.
+	PoolResetNever
+)
+
+// String returns the name of the policy.
+func (p PoolResetPolicy) String() string {
+	switch p {
+	case PoolResetAlways:
+		return "always"
+	case PoolResetOnError:
+		return "on_error"
+	case PoolResetNever:
+		return "never"
+	default:
+		return fmt.Sprintf("PoolResetPolicy(%d)", uint8(p))
+	}
+}
+
+var (
+	// ErrPoolClosed is returned by MachinePool.Acquire after the pool is closed.
+	ErrPoolClosed = errors.New("machine pool is closed")
+	// ErrPoolForeignMachine is returned by MachinePool.Release for a Machine that is not borrowed from the pool.
+	ErrPoolForeignMachine = errors.New("machine is not borrowed from this pool")
+)
+
+// PoolStats is a snapshot of the counters of a MachinePool.
+type PoolStats struct {
+	Size     int    // number of machines held by the pool
+	Idle     int    // number of machines ready to be acquired
+	InUse    int    // number of machines currently borrowed
+	Waiters  int    // number of callers blocked in Acquire
+	Acquires uint64 // total number of successful acquisitions
+	Resets   uint64 // total number of machines reset on release
+}
+
+// MachinePool holds a fixed number of pre-warmed Machines for concurrent execution of the same script.
+//
+// A Machine serializes every Run and Call on its own lock, so a host serving concurrent requests either builds a Machine per request (paying the preload and compilation every time) or bottlenecks on a single one.
+// All machines in a pool share the same globals, preload and lazyload modules, script and compiled program cache, and they are pre-warmed, i.e. the preload modules are loaded before the first borrower arrives.
+//
+// Borrow a Machine with Acquire and return it with Release or ReleaseWithError; depending on the reset policy, the returned Machine is reset and pre-warmed again before the next borrower gets it.
+type MachinePool struct {
+	_        itn.DoNotCompare
+	mu       sync.Mutex
+	cfgMu    sync.Mutex // serializes the setters, see eachMachine
+	all      []*Machine // every machine of the pool, fixed after creation
+	idle     chan *Machine
+	borrowed map[*Machine]struct{}
+	closed   chan struct{}
+	policy   PoolResetPolicy
+	size     int
+	waiters  int
+	acquires uint64
+	resets   uint64
+}
+
+// NewMachinePool creates a pool of the given size with machines configured with the given globals, preload and lazyload module loaders.
+// All machines share an in-memory cache for compiled programs. It returns an error if the size is not positive or the preload modules fail to load.
+func NewMachinePool(size int, globals StringAnyMap, preload ModuleLoaderList, lazyload ModuleLoaderMap) (*MachinePool, error) {
+	cache := NewMemoryCache()
+	return NewMachinePoolWithFactory(size, func() *Machine {
+		m := NewWithLoaders(globals, preload, lazyload)
+		m.SetScriptCache(cache)
+		return m
+	})
+}
+
+// NewMachinePoolWithFactory creates a pool of the given size with machines built by the given factory, which is called once for each machine.
+// Machines built by the factory should share the same configuration, and usually the same ByteCache, so that a script is compiled only once for the whole pool.
+// If any machine fails to be built or warmed up, the machines built so far are reset to drop what they have loaded.
+func NewMachinePoolWithFactory(size int, factory func() *Machine) (*MachinePool, error) {
+	if size <= 0 {
+		return nil, errorStarletErrorf("pool", "invalid pool size: %d", size)
+	}
+	if factory == nil {
+		return nil, errorStarletErrorf("pool", "nil machine factory")
+	}
+	p := &MachinePool{
+		idle:     make(chan *Machine, size),
+		all:      make([]*Machine, 0, size),
+		borrowed: make(map[*Machine]struct{}, size),
+		closed:   make(chan struct{}),
+		size:     size,
+	}
+	for i := 0; i < size; i++ {
+		m := factory()
+		if m == nil {
+			p.resetAll()
+			return nil, errorStarletErrorf("pool", "machine factory returned nil")
+		}
+		p.all = append(p.all, m)
+		if err := m.warmUp(); err != nil {
+			p.resetAll()
+			return nil, err
+		}
+		p.idle <- m
+	}
+	return p, nil
+}
+
+// resetAll resets every machine of the pool, for a pool failed to be created.
+func (p *MachinePool) resetAll() {
+	for _, m := range p.all {
+		m.Reset()
+	}
+}
+
+// SetResetPolicy sets the policy of resetting machines on release, the default is PoolResetAlways.
+func (p *MachinePool) SetResetPolicy(policy PoolResetPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.policy = policy
+}
+
+// SetScript sets the script for all machines in the pool, including the borrowed ones, waiting for their current executions to finish.
+func (p *MachinePool) SetScript(name string, content []byte, fileSys fs.FS) {
+	p.eachMachine(func(m *Machine) {
+		m.SetScript(name, content, fileSys)
+	})
+}
+
+// SetPrintFunc sets the print function for all machines in the pool.
+func (p *MachinePool) SetPrintFunc(printFunc PrintFunc) {
+	p.eachMachine(func(m *Machine) {
+		m.SetPrintFunc(printFunc)
+	})
+}
+
+// SetMaxExecutionSteps sets the per-execution step budget for all machines in the pool.
+func (p *MachinePool) SetMaxExecutionSteps(steps uint64) {
+	p.eachMachine(func(m *Machine) {
+		m.SetMaxExecutionSteps(steps)
+	})
+}
+
+// SetPrintLimits sets the per-execution print limits for all machines in the pool.
+func (p *MachinePool) SetPrintLimits(maxBytes, maxLines uint64) {
+	p.eachMachine(func(m *Machine) {
+		m.SetPrintLimits(maxBytes, maxLines)
+	})
+}
+
+// eachMachine applies fn to every machine of the pool, idle or borrowed.
+// The setters it serves lock each machine on their own, so it waits for the current execution of a borrowed machine to finish; the pool lock is not held meanwhile, so acquiring, releasing and the stats are not blocked.
+func (p *MachinePool) eachMachine(fn func(m *Machine)) {
+	p.cfgMu.Lock()
+	defer p.cfgMu.Unlock()
+
+	for _, m := range p.all {
+		fn(m)
+	}
+}
+
+// Acquire borrows a Machine from the pool, blocking until one is available, the context is done, or the pool is closed.
+// The Machine must be returned with Release or ReleaseWithError after use.
+func (p *MachinePool) Acquire(ctx context.Context) (*Machine, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	select {
+	case <-p.closed:
+		return nil, errorStarletError("pool", ErrPoolClosed)
+	default:
+	}
+
+	// fast path: an idle machine is ready
+	select {
+	case m := <-p.idle:
+		return p.checkout(m)
+	default:
+	}
+
+	// slow path: wait for a released machine
+	p.mu.Lock()
+	p.waiters++
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.waiters--
+		p.mu.Unlock()
+	}()
+
+	select {
+	case m := <-p.idle:
+		return p.checkout(m)
+	case <-ctx.Done():
+		return nil, errorStarletError("pool", ctx.Err())
+	case <-p.closed:
+		return nil, errorStarletError("pool", ErrPoolClosed)
+	}
+}
+
+// checkout marks the machine as borrowed, warming it up first if it failed to warm up on release; if it fails again, the machine is put back and the error returned.
+func (p *MachinePool) checkout(m *Machine) (*Machine, error) {
+	if err := m.warmUp(); err != nil {
+		p.idle <- m
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.borrowed[m] = struct{}{}
+	p.acquires++
+	return m, nil
+}
+
+// Release returns a borrowed Machine to the pool as a successful borrow.
+func (p *MachinePool) Release(m *Machine) error {
+	return p.ReleaseWithError(m, nil)
+}
+
+// ReleaseWithError returns a borrowed Machine to the pool along with the error of its last execution, if any.
+// The error is only consulted by the PoolResetOnError policy. It returns an error if the Machine is not borrowed from this pool, or warming it up after the reset fails; such a Machine is returned unprepared, and warmed up again when it's acquired.
+func (p *MachinePool) ReleaseWithError(m *Machine, runErr error) error {
+	p.mu.Lock()
+	if _, ok := p.borrowed[m]; !ok {
+		p.mu.Unlock()
+		return errorStarletError("pool", ErrPoolForeignMachine)
+	}
+	delete(p.borrowed, m)
+	needReset := p.policy == PoolResetAlways || (p.policy == PoolResetOnError && runErr != nil)
+	if needReset {
+		p.resets++
+	}
+	p.mu.Unlock()
+
+	// reset and warm up again outside the pool lock, so other borrowers are not blocked
+	var err error
+	if needReset {
+		m.Reset()
+		err = m.warmUp()
+	}
+
+	// the idle channel has room for every machine of the pool, so it never blocks
+	p.idle <- m
+	return err
+}
+
+// Stats returns a snapshot of the counters of the pool.
+func (p *MachinePool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return PoolStats{
+		Size:     p.size,
+		Idle:     len(p.idle),
+		InUse:    len(p.borrowed),
+		Waiters:  p.waiters,
+		Acquires: p.acquires,
+		Resets:   p.resets,
+	}
+}
+
+// Close closes the pool, pending and later calls to Acquire fail with ErrPoolClosed. Borrowed machines can still be released. It's safe to call Close more than once.
+func (p *MachinePool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-p.closed:
+	default:
+		close(p.closed)
+	}
+}
+
+// warmUp prepares the thread of the machine ahead of its first run, i.e. converts the globals and loads the preload modules, so that the cost is not paid by the first execution.
+// It does nothing if the machine has already been prepared.
+func (m *Machine) warmUp() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.thread != nil {
+		return nil
+	}
+	return m.prepareThread(nil)
+}
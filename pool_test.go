@@ -0,0 +1,303 @@
+package starlet_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1set/starlet"
+	"go.starlark.net/starlark"
+)
+
+func TestNewMachinePool_Invalid(t *testing.T) {
+	if _, err := starlet.NewMachinePool(0, nil, nil, nil); err == nil {
+		t.Errorf("expected error for zero size")
+	}
+	if _, err := starlet.NewMachinePoolWithFactory(1, nil); err == nil {
+		t.Errorf("expected error for nil factory")
+	}
+	if _, err := starlet.NewMachinePoolWithFactory(1, func() *starlet.Machine { return nil }); err == nil {
+		t.Errorf("expected error for nil machine")
+	}
+	_, bad := getErrorModuleLoader()
+	_, err := starlet.NewMachinePool(2, nil, starlet.ModuleLoaderList{bad}, nil)
+	expectErr(t, err, "starlet: load: invalid module loader")
+}
+
+func TestMachinePool_Concurrent(t *testing.T) {
+	loads := 0
+	var lmu sync.Mutex
+	preload := starlet.ModuleLoaderList{func() (starlark.StringDict, error) {
+		lmu.Lock()
+		loads++
+		lmu.Unlock()
+		return starlark.StringDict{"base": starlark.MakeInt(100)}, nil
+	}}
+	p, err := starlet.NewMachinePool(3, starlet.StringAnyMap{"offset": 1}, preload, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loads != 3 {
+		t.Errorf("expected 3 pre-warmed machines, got %d preload calls", loads)
+	}
+	p.SetScript("pool.star", []byte(`x = base + offset + n`), nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			m, err := p.Acquire(context.Background())
+			if err != nil {
+				t.Errorf("acquire: %v", err)
+				return
+			}
+			res, err := m.RunWithContext(context.Background(), starlet.StringAnyMap{"n": n})
+			if err != nil {
+				t.Errorf("run: %v", err)
+			} else if res["x"] != int64(101+n) {
+				t.Errorf("expected %d, got %v", 101+n, res["x"])
+			}
+			if err := p.ReleaseWithError(m, err); err != nil {
+				t.Errorf("release: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	st := p.Stats()
+	if st.Size != 3 || st.Idle != 3 || st.InUse != 0 || st.Waiters != 0 {
+		t.Errorf("unexpected stats: %+v", st)
+	}
+	if st.Acquires != 20 || st.Resets != 20 {
+		t.Errorf("expected 20 acquires and resets, got %+v", st)
+	}
+}
+
+func TestMachinePool_SetWhileAcquiring(t *testing.T) {
+	p, err := starlet.NewMachinePool(2, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p.SetScript("pool.star", []byte(`x = 0`), nil)
+
+	// setters race with acquirers, and reach every machine whether idle or borrowed
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				m, err := p.Acquire(context.Background())
+				if err != nil {
+					t.Errorf("acquire: %v", err)
+					return
+				}
+				_ = p.Release(m)
+			}
+		}()
+	}
+	finished := make(chan struct{})
+	go func() {
+		for start := time.Now(); time.Since(start) < 100*time.Millisecond; {
+			p.SetScript("pool.star", []byte(`x = 1`), nil)
+		}
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("setters deadlocked with acquirers")
+	}
+	close(stop)
+	wg.Wait()
+
+	var ms []*starlet.Machine
+	for i := 0; i < 2; i++ {
+		m, err := p.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		ms = append(ms, m)
+		if res, err := m.Run(); err != nil || res["x"] != int64(1) {
+			t.Errorf("expected the new script, got: %v, %v", res, err)
+		}
+	}
+	for _, m := range ms {
+		_ = p.Release(m)
+	}
+}
+
+func TestMachinePool_ResetPolicy(t *testing.T) {
+	p, err := starlet.NewMachinePool(1, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := starlet.PoolResetOnError.String(); s != "on_error" {
+		t.Errorf("unexpected policy name: %s", s)
+	}
+
+	run := func(code string) (starlet.StringAnyMap, error) {
+		m, err := p.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		res, err := m.RunScript([]byte(code), nil)
+		if e := p.ReleaseWithError(m, err); e != nil {
+			t.Errorf("release: %v", e)
+		}
+		return res, err
+	}
+
+	// always: no state leaks
+	if _, err := run(`a = 1`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := run(`b = a`); err == nil {
+		t.Errorf("expected undefined error after reset")
+	}
+
+	// never: state carries over
+	p.SetResetPolicy(starlet.PoolResetNever)
+	if _, err := run(`a = 2`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res, err := run(`b = a * 10`); err != nil || res["b"] != int64(20) {
+		t.Errorf("expected carried state, got %v, %v", res, err)
+	}
+
+	// on error: only failed runs reset
+	p.SetResetPolicy(starlet.PoolResetOnError)
+	if _, err := run(`fail("boom")`); err == nil {
+		t.Errorf("expected error")
+	}
+	if _, err := run(`c = a`); err == nil {
+		t.Errorf("expected undefined error after reset on error")
+	}
+	if st := p.Stats(); st.Resets != 4 {
+		t.Errorf("expected 4 resets, got %d", st.Resets)
+	}
+}
+
+func TestMachinePool_AcquireWaitAndClose(t *testing.T) {
+	p, err := starlet.NewMachinePool(1, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m, err := p.Acquire(nil)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	// timeout while the only machine is borrowed
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	// a waiter gets the released machine
+	done := make(chan *starlet.Machine)
+	go func() {
+		w, err := p.Acquire(context.Background())
+		if err != nil {
+			t.Errorf("acquire: %v", err)
+		}
+		done <- w
+	}()
+	for p.Stats().Waiters == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := p.Release(m); err != nil {
+		t.Errorf("release: %v", err)
+	}
+	w := <-done
+	if w != m {
+		t.Errorf("expected the same machine")
+	}
+
+	// foreign and double release
+	if err := p.Release(starlet.NewDefault()); !errors.Is(err, starlet.ErrPoolForeignMachine) {
+		t.Errorf("expected foreign machine error, got %v", err)
+	}
+	if err := p.Release(w); err != nil {
+		t.Errorf("release: %v", err)
+	}
+	if err := p.Release(w); !errors.Is(err, starlet.ErrPoolForeignMachine) {
+		t.Errorf("expected foreign machine error, got %v", err)
+	}
+
+	// closed
+	p.Close()
+	p.Close()
+	if _, err := p.Acquire(context.Background()); !errors.Is(err, starlet.ErrPoolClosed) {
+		t.Errorf("expected closed error, got %v", err)
+	}
+}
+
+func TestMachinePool_WarmUpFailure(t *testing.T) {
+	failing := false
+	ld := func() (starlark.StringDict, error) {
+		if failing {
+			return nil, errors.New("preload unavailable")
+		}
+		return starlark.StringDict{"v": starlark.MakeInt(1)}, nil
+	}
+	p, err := starlet.NewMachinePool(1, nil, starlet.ModuleLoaderList{ld}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a machine failing to warm up on release is not handed out unprepared
+	m, err := p.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	failing = true
+	expectErr(t, p.Release(m), "starlet: load: preload unavailable")
+	_, err = p.Acquire(context.Background())
+	expectErr(t, err, "starlet: load: preload unavailable")
+	if st := p.Stats(); st.Idle != 1 || st.InUse != 0 {
+		t.Errorf("expected the machine kept idle, got %+v", st)
+	}
+
+	// and warmed up again once it can be
+	failing = false
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if m, err = p.Acquire(ctx); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if m.GetStarlarkThread() == nil {
+		t.Errorf("expected the machine warmed up")
+	}
+	if res, err := m.RunScript([]byte(`x = v + 1`), nil); err != nil || res["x"] != int64(2) {
+		t.Errorf("expected x = 2, got %v, %v", res, err)
+	}
+
+	// machines built before a failure are reset
+	var built []*starlet.Machine
+	_, err = starlet.NewMachinePoolWithFactory(2, func() *starlet.Machine {
+		var m *starlet.Machine
+		if len(built) == 0 {
+			m = starlet.NewWithLoaders(nil, starlet.ModuleLoaderList{ld}, nil)
+		} else {
+			_, bad := getErrorModuleLoader()
+			m = starlet.NewWithLoaders(nil, starlet.ModuleLoaderList{bad}, nil)
+		}
+		built = append(built, m)
+		return m
+	})
+	expectErr(t, err, "starlet: load: invalid module loader")
+	if len(built) != 2 || built[0].GetStarlarkThread() != nil {
+		t.Errorf("expected the first machine reset, got %d machines", len(built))
+	}
+}
@@ -0,0 +1,92 @@
+package starlet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// SetPrintLimits sets the maximum number of bytes and lines each run or call of the machine may print; 0 means unlimited, the default.
+// The messages of print(), and pprint() and eprint() of go_idiomatic, count with their trailing newlines. A message exceeding either limit is not printed, and the execution fails with a MaxPrintExceededError.
+// The counters reset at the start of every Run/Call, like the step budget.
+func (m *Machine) SetPrintLimits(maxBytes, maxLines uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.maxPrintBytes = maxBytes
+	m.maxPrintLines = maxLines
+}
+
+// RunCaptured executes a preset script with additional variables like RunWithContext, and returns the lines printed by the script and its loaded modules along with the result.
+// The printed messages are captured instead of being passed to the print function, and a message of multiple lines is split into them. The lines printed before a failure are returned with the error.
+func (m *Machine) RunCaptured(extras StringAnyMap) (StringAnyMap, []string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.capture = true
+	defer func() {
+		m.capture = false
+	}()
+	out, err := m.runInternal(context.Background(), extras, true)
+	var lines []string
+	if m.printed != nil {
+		lines = m.printed.captured
+	}
+	return out, lines, err
+}
+
+// printOutput is the output printed by an execution.
+type printOutput struct {
+	bytes    uint64
+	lines    uint64
+	captured []string
+}
+
+// resetPrintOutput clears the output counted and captured for the previous execution.
+func (m *Machine) resetPrintOutput() {
+	m.printed = &printOutput{}
+}
+
+// getPrintFunc returns the print function for threads of the machine.
+// It counts the messages against the print limits, captures them in the capture mode or hands them to the print function otherwise, and invokes the OnPrint hook if set.
+func (m *Machine) getPrintFunc() PrintFunc {
+	pf := m.printFunc
+	var hook func(e PrintEvent)
+	if m.hooks != nil {
+		hook = m.hooks.OnPrint
+	}
+	return func(thread *starlark.Thread, msg string) {
+		if o := m.printed; o != nil {
+			m.countPrint(o, msg)
+			if m.capture {
+				o.captured = append(o.captured, strings.Split(msg, "\n")...)
+			}
+		}
+		if !m.capture {
+			if pf != nil {
+				pf(thread, msg)
+			} else {
+				// the default of Starlark for a nil print function
+				_, _ = fmt.Fprintln(os.Stderr, msg)
+			}
+		}
+		if hook != nil {
+			hook(PrintEvent{Thread: thread.Name, Message: msg})
+		}
+	}
+}
+
+// countPrint adds the message to the output, or panics with a MaxPrintExceededError if it exceeds a limit, to be recovered by the run/call recover and mapped to a typed error.
+func (m *Machine) countPrint(o *printOutput, msg string) {
+	bytes, lines := o.bytes+uint64(len(msg))+1, o.lines+uint64(strings.Count(msg, "\n"))+1
+	if lim := m.maxPrintBytes; lim > 0 && bytes > lim {
+		panic(MaxPrintExceededError{Limit: lim, Unit: "bytes"})
+	}
+	if lim := m.maxPrintLines; lim > 0 && lines > lim {
+		panic(MaxPrintExceededError{Limit: lim, Unit: "lines"})
+	}
+	o.bytes, o.lines = bytes, lines
+}
@@ -0,0 +1,161 @@
+package starlet_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/1set/starlet"
+	"go.starlark.net/starlark"
+)
+
+func TestMachine_SetPrintLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes uint64
+		maxLines uint64
+		script   string
+		wantErr  *starlet.MaxPrintExceededError
+		printed  []string
+	}{
+		{
+			name:    "unlimited",
+			script:  `print("a" * 100)`,
+			printed: []string{strings.Repeat("a", 100)},
+		},
+		{
+			name:     "within limits",
+			maxBytes: 8,
+			maxLines: 3,
+			script:   "print('abc')\nprint('d\\ne')",
+			printed:  []string{"abc", "d\ne"},
+		},
+		{
+			name:     "bytes exceeded",
+			maxBytes: 8,
+			script:   "print('abc')\nprint('defg')\nprint('never')",
+			wantErr:  &starlet.MaxPrintExceededError{Limit: 8, Unit: "bytes"},
+			printed:  []string{"abc"},
+		},
+		{
+			name:     "lines exceeded",
+			maxLines: 2,
+			script:   "print('a\\nb')\nprint('c')",
+			wantErr:  &starlet.MaxPrintExceededError{Limit: 2, Unit: "lines"},
+			printed:  []string{"a\nb"},
+		},
+		{
+			name:     "go_idiomatic counts",
+			maxLines: 3,
+			script:   "load('go_idiomatic', 'eprint', 'pprint')\nprint(1)\neprint(2)\npprint([3])",
+			wantErr:  &starlet.MaxPrintExceededError{Limit: 3, Unit: "lines"},
+			printed:  []string{"1", "2"},
+		},
+		{
+			name:     "loaded module counts",
+			maxLines: 1,
+			script:   "load('noisy.star', 'x')\nprint(x)",
+			wantErr:  &starlet.MaxPrintExceededError{Limit: 1, Unit: "lines"},
+			printed:  []string{"loading"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var printed []string
+			m := starlet.NewWithNames(nil, nil, []string{"go_idiomatic"})
+			m.SetPrintFunc(func(_ *starlark.Thread, msg string) {
+				printed = append(printed, msg)
+			})
+			m.SetPrintLimits(tt.maxBytes, tt.maxLines)
+			m.SetScript("test.star", []byte(tt.script), MemFS{"noisy.star": "print('loading')\nx = 1\n"})
+			_, err := m.Run()
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else {
+				var me starlet.MaxPrintExceededError
+				if !errors.As(err, &me) || me != *tt.wantErr {
+					t.Errorf("expected %v, got: %v", *tt.wantErr, err)
+				}
+			}
+			if !reflect.DeepEqual(printed, tt.printed) {
+				t.Errorf("expected printed %q, got: %q", tt.printed, printed)
+			}
+		})
+	}
+}
+
+func TestMachine_SetPrintLimits_PerExecution(t *testing.T) {
+	m := starlet.NewDefault()
+	m.SetPrintFunc(starlet.NoopPrintFunc)
+	m.SetPrintLimits(0, 2)
+	m.SetScript("test.star", []byte("def say(n):\n    for i in range(n):\n        print(i)\nsay(2)\n"), nil)
+
+	// the counters reset for each run and call
+	for i := 0; i < 2; i++ {
+		if _, err := m.Run(); err != nil {
+			t.Fatalf("run #%d expects no error, got: %v", i+1, err)
+		}
+	}
+	if _, err := m.Call("say", 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err := m.Call("say", 3)
+	expectErr(t, err, "starlark: call: execution exceeded the print limit (2 lines)")
+}
+
+func TestMachine_RunCaptured(t *testing.T) {
+	var printed, hooked []string
+	m := starlet.NewWithNames(nil, []string{"go_idiomatic"}, nil)
+	m.SetPrintFunc(func(_ *starlark.Thread, msg string) {
+		printed = append(printed, msg)
+	})
+	m.SetHooks(&starlet.Hooks{OnPrint: func(e starlet.PrintEvent) {
+		hooked = append(hooked, e.Message)
+	}})
+	m.SetScript("test.star", []byte(`
+load("noisy.star", "x")
+print("a\nb")
+eprint("oops", x)
+pprint({"k": 1})
+y = 2
+`), MemFS{"noisy.star": "print('loading')\nx = 1\n"})
+
+	out, lines, err := m.RunCaptured(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out["y"] != int64(2) {
+		t.Errorf("unexpected output: %v", out)
+	}
+	want := []string{"loading", "a", "b", "oops 1", "{", `    "k": 1`, "}"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("expected captured %q, got: %q", want, lines)
+	}
+	if len(printed) != 0 {
+		t.Errorf("expected nothing passed to the print function, got: %q", printed)
+	}
+	if len(hooked) != 4 {
+		t.Errorf("expected 4 messages to the hook, got: %q", hooked)
+	}
+
+	// back to the print function afterwards
+	if _, err := m.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(printed) != 3 {
+		t.Errorf("expected 3 messages printed, got: %q", printed)
+	}
+
+	// the lines printed before a failure are returned
+	m = starlet.NewDefault()
+	m.SetPrintLimits(0, 2)
+	m.SetScript("test.star", []byte("print(1)\nprint(2)\nprint(3)\n"), nil)
+	_, lines, err = m.RunCaptured(nil)
+	expectErr(t, err, "starlark: exec: execution exceeded the print limit (2 lines)")
+	if want := []string{"1", "2"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("expected captured %q, got: %q", want, lines)
+	}
+}
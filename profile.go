@@ -0,0 +1,185 @@
+package starlet
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1set/starlet/internal/pprof"
+	"go.starlark.net/starlark"
+)
+
+// RunWithProfile executes a preset script with additional variables like RunWithContext, and writes a profile of the execution to w in the pprof format, e.g. for "go tool pprof".
+//
+// The profile samples every step of the Starlark threads, i.e. the script and the modules executed by load(), with two values for each call stack of Starlark functions: the number of steps and the wall time spent.
+// The time of a builtin call goes to the line of the calling function, and the top level of a module is named after the module, e.g. "lib.star", so the time and steps per loaded module can be seen by the top level functions or the "module" label of the samples.
+// Modules loaded by previous runs are cached and not executed again, so they are not in the profile.
+// The step budget set by SetMaxExecutionSteps applies as usual, and the profile is written even if the run fails, to show where the steps went.
+func (m *Machine) RunWithProfile(w io.Writer, extras StringAnyMap) (StringAnyMap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := newProfiler()
+	m.profile = p
+	out, err := m.runInternal(context.Background(), extras, true)
+	m.profile = nil
+
+	if pe := p.profile().Write(w); pe != nil && err == nil {
+		err = errorStarletError("profile", pe)
+	}
+	return out, err
+}
+
+// profiler samples the call stacks of the Starlark threads at every step.
+type profiler struct {
+	start   time.Time
+	last    time.Time                    // time of the last sample
+	prev    *profSample                  // the last sample, the time until the next one is spent there
+	steps   map[*starlark.Thread]uint64  // steps of the threads at their last samples
+	samples map[string]*profSample       // by the keys of call stacks
+	order   []*profSample                // in the order of first seen, for a stable output
+	funcs   map[starlark.Callable]string // cached keys of functions
+}
+
+// profSample is the accumulated values of a call stack.
+type profSample struct {
+	stack  []pprof.Location
+	steps  int64
+	nanos  int64
+	module string
+}
+
+func newProfiler() *profiler {
+	now := time.Now()
+	return &profiler{
+		start:   now,
+		last:    now,
+		steps:   make(map[*starlark.Thread]uint64),
+		samples: make(map[string]*profSample),
+		funcs:   make(map[starlark.Callable]string),
+	}
+}
+
+// attach samples the thread at every step until it reaches the given step budget, when the OnMaxSteps of the budget armed on the thread takes over.
+func (p *profiler) attach(t *starlark.Thread, limit uint64) {
+	onLimit := t.OnMaxSteps
+	p.steps[t] = t.Steps
+	t.SetMaxExecutionSteps(t.Steps + 1)
+	t.OnMaxSteps = func(t *starlark.Thread) {
+		p.sample(t)
+		if t.Steps >= limit {
+			if onLimit != nil {
+				onLimit(t)
+			} else {
+				t.Cancel("too many steps")
+			}
+			return
+		}
+		t.SetMaxExecutionSteps(t.Steps + 1)
+	}
+}
+
+// sample records the current call stack of the thread, with the steps since its last sample, and gives the time since the last sample of any thread to the previous stack.
+func (p *profiler) sample(t *starlark.Thread) {
+	now := time.Now()
+	if p.prev != nil {
+		p.prev.nanos += now.Sub(p.last).Nanoseconds()
+	}
+	p.last = now
+
+	var key strings.Builder
+	depth := t.CallStackDepth()
+	for i := 0; i < depth; i++ {
+		fr := t.DebugFrame(i)
+		key.WriteString(p.funcKey(fr.Callable()))
+		key.WriteByte(':')
+		key.WriteString(strconv.Itoa(int(fr.Position().Line)))
+		key.WriteByte(';')
+	}
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &profSample{stack: make([]pprof.Location, 0, depth)}
+		for i := 0; i < depth; i++ {
+			fr := t.DebugFrame(i)
+			s.stack = append(s.stack, pprof.Location{
+				Function: profFunction(fr.Callable()),
+				Line:     int64(fr.Position().Line),
+			})
+		}
+		if depth > 0 {
+			s.module = s.stack[0].Function.Filename
+		}
+		p.samples[key.String()] = s
+		p.order = append(p.order, s)
+	}
+	s.steps += int64(t.Steps - p.steps[t])
+	p.steps[t] = t.Steps
+	p.prev = s
+}
+
+// funcKey returns a key identifying the function in the call stacks.
+func (p *profiler) funcKey(fn starlark.Callable) string {
+	switch fn.(type) {
+	case *starlark.Function, *starlark.Builtin:
+		// comparable, so cached
+	default:
+		return p.makeFuncKey(fn)
+	}
+	k, ok := p.funcs[fn]
+	if !ok {
+		k = p.makeFuncKey(fn)
+		p.funcs[fn] = k
+	}
+	return k
+}
+
+func (p *profiler) makeFuncKey(fn starlark.Callable) string {
+	f := profFunction(fn)
+	return f.Filename + ":" + strconv.FormatInt(f.StartLine, 10) + ":" + f.Name
+}
+
+// profile returns the samples collected so far as a profile, the time since the last sample goes to its stack.
+func (p *profiler) profile() *pprof.Profile {
+	now := time.Now()
+	if p.prev != nil {
+		p.prev.nanos += now.Sub(p.last).Nanoseconds()
+		p.prev = nil
+	}
+	p.last = now
+
+	prof := &pprof.Profile{
+		SampleTypes: []pprof.ValueType{
+			{Type: "steps", Unit: "count"},
+			{Type: "wall", Unit: "nanoseconds"},
+		},
+		PeriodType:    pprof.ValueType{Type: "steps", Unit: "count"},
+		Period:        1,
+		TimeNanos:     p.start.UnixNano(),
+		DurationNanos: now.Sub(p.start).Nanoseconds(),
+	}
+	for _, s := range p.order {
+		prof.Samples = append(prof.Samples, pprof.Sample{
+			Stack:  s.stack,
+			Values: []int64{s.steps, s.nanos},
+			Labels: map[string]string{"module": s.module},
+		})
+	}
+	return prof
+}
+
+// profFunction describes the callable as a function in the profile.
+// The top level of a module is named after the module, like the profiler of Starlark.
+func profFunction(fn starlark.Callable) pprof.Function {
+	f, ok := fn.(*starlark.Function)
+	if !ok {
+		return pprof.Function{Name: fn.Name(), Filename: builtinFilename}
+	}
+	pos := f.Position()
+	name := f.Name()
+	if name == "<toplevel>" {
+		name = pos.Filename()
+	}
+	return pprof.Function{Name: name, Filename: pos.Filename(), StartLine: int64(pos.Line)}
+}
@@ -0,0 +1,95 @@
+package starlet_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/1set/starlet"
+)
+
+func readProfile(t *testing.T, b []byte) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("expected gzip, got: %v", err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return raw
+}
+
+func TestMachine_RunWithProfile(t *testing.T) {
+	fsys := MemFS{
+		"lib.star": "def fib(n):\n    if n < 2:\n        return n\n    return fib(n - 1) + fib(n - 2)\n",
+	}
+	script := `
+load("lib.star", "fib")
+def burn():
+    x = 0
+    for i in range(100):
+        x += i
+    return x
+a = fib(10)
+b = burn()
+`
+	m := starlet.NewDefault()
+	m.EnableRecursionSupport()
+	m.SetScript("main.star", []byte(script), fsys)
+
+	var buf bytes.Buffer
+	out, err := m.RunWithProfile(&buf, starlet.StringAnyMap{"c": 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out["a"] != int64(55) || out["b"] != int64(4950) {
+		t.Errorf("unexpected output: %v", out)
+	}
+	raw := readProfile(t, buf.Bytes())
+	for _, s := range []string{"steps", "count", "wall", "nanoseconds", "fib", "burn", "lib.star", "main.star", "module"} {
+		if !bytes.Contains(raw, []byte(s)) {
+			t.Errorf("expected %q in the profile", s)
+		}
+	}
+
+	// the machine runs as usual afterwards
+	steps := m.GetStarlarkThread().Steps
+	if _, err := m.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := m.GetStarlarkThread().Steps; got != steps {
+		t.Errorf("expected %d steps, got: %d", steps, got)
+	}
+}
+
+func TestMachine_RunWithProfile_Error(t *testing.T) {
+	// the budget still applies, and the profile is written
+	m := starlet.NewDefault()
+	m.SetMaxExecutionSteps(100)
+	m.SetScript("loop.star", []byte("def burn():\n    x = 0\n    for i in range(10000):\n        x += 1\n    return x\nr = burn()\n"), nil)
+	var buf bytes.Buffer
+	_, err := m.RunWithProfile(&buf, nil)
+	var me starlet.MaxStepsExceededError
+	if !errors.As(err, &me) || me.Limit != 100 {
+		t.Errorf("expected MaxStepsExceededError{100}, got: %v", err)
+	}
+	if raw := readProfile(t, buf.Bytes()); !bytes.Contains(raw, []byte("burn")) {
+		t.Errorf("expected burn in the profile")
+	}
+
+	// failing to write the profile
+	m = starlet.NewDefault()
+	m.SetScript("ok.star", []byte("x = 1"), nil)
+	_, err = m.RunWithProfile(failWriter{}, nil)
+	expectErr(t, err, "starlet: profile: disk full")
+}
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
@@ -0,0 +1,282 @@
+package starlet
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	itn "github.com/1set/starlet/internal"
+)
+
+// ModuleRegistry is a concurrency-safe set of named builtin modules, each with its loader, capability set and a one-line description.
+//
+// The package keeps a default registry holding the modules shipped with Starlet, which backs the package-level helpers like GetAllBuiltinModuleNames, MakeBuiltinModuleLoaderMap and NewWithNames; third-party modules join it with RegisterBuiltinModule.
+// An isolated registry, created by NewModuleRegistry or cloned from another one, lets tests and tenants have different module sets without touching the global state.
+type ModuleRegistry struct {
+	_    itn.DoNotCompare
+	mu   sync.RWMutex
+	mods map[string]registeredModule
+	caps map[string]ModuleCapability // capability sets of custom modules declared by name only, see RegisterCapability
+}
+
+// registeredModule is an entry of a ModuleRegistry.
+type registeredModule struct {
+	loader ModuleLoader
+	cap    ModuleCapability
+	doc    string
+}
+
+// defaultRegistry is the registry behind the package-level helpers, seeded with the modules shipped with Starlet.
+var defaultRegistry = newSeededRegistry()
+
+func newSeededRegistry() *ModuleRegistry {
+	r := NewModuleRegistry()
+	for name, ld := range allBuiltinModules {
+		r.mods[name] = registeredModule{
+			loader: ld,
+			cap:    builtinModuleCapabilities[name],
+			doc:    builtinModuleDocs[name],
+		}
+	}
+	return r
+}
+
+// NewModuleRegistry creates an empty module registry.
+func NewModuleRegistry() *ModuleRegistry {
+	return &ModuleRegistry{
+		mods: make(map[string]registeredModule),
+		caps: make(map[string]ModuleCapability),
+	}
+}
+
+// NewBuiltinModuleRegistry creates an isolated registry holding the modules of the default registry, i.e. the modules shipped with Starlet and the ones registered by RegisterBuiltinModule so far.
+func NewBuiltinModuleRegistry() *ModuleRegistry {
+	return defaultRegistry.Clone()
+}
+
+// RegisterBuiltinModule adds a module to the default registry, so it participates in the package-level helpers and machines like the modules shipped with Starlet.
+// It returns an error if the name is empty or already registered, or the loader is nil.
+func RegisterBuiltinModule(name string, loader ModuleLoader, cap ModuleCapability, doc string) error {
+	return defaultRegistry.Register(name, loader, cap, doc)
+}
+
+// Register adds a module with its capability set and a one-line description to the registry.
+// It returns an error if the name is empty or already registered, its capability set is declared differently by RegisterCapability, or the loader is nil; an existing module is never replaced, so a module cannot be swapped for a more capable one behind the back of a policy.
+func (r *ModuleRegistry) Register(name string, loader ModuleLoader, cap ModuleCapability, doc string) error {
+	if name == "" {
+		return errorStarletErrorf(`register`, "empty module name")
+	}
+	if loader == nil {
+		return errorStarletErrorf(`register`, "nil module loader: %s", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, found := r.mods[name]; found {
+		return errorStarletErrorf(`register`, "module already registered: %s", name)
+	}
+	if old, found := r.caps[name]; found && old != cap {
+		return errorStarletErrorf(`register`, "module %q is already registered with capability %v", name, old)
+	}
+	r.mods[name] = registeredModule{loader: loader, cap: cap, doc: doc}
+	return nil
+}
+
+// RegisterCapability declares the capability set of a custom module by name, so the capability policy of the machines using the registry covers a module loaded under that name just like a registered one.
+// It returns an error if the name is empty or of a registered module, or it's already declared with a different set, so a policy cannot be loosened by a later declaration.
+func (r *ModuleRegistry) RegisterCapability(name string, cap ModuleCapability) error {
+	if name == "" {
+		return errorStarletErrorf(`register`, "empty module name")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, found := r.mods[name]; found {
+		return errorStarletErrorf(`register`, "cannot register capability of registered module: %s", name)
+	}
+	if old, found := r.caps[name]; found && old != cap {
+		return errorStarletErrorf(`register`, "module %q is already registered with capability %v", name, old)
+	}
+	r.caps[name] = cap
+	return nil
+}
+
+// Clone returns an isolated copy of the registry.
+func (r *ModuleRegistry) Clone() *ModuleRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c := NewModuleRegistry()
+	for k, v := range r.mods {
+		c.mods[k] = v
+	}
+	for k, v := range r.caps {
+		c.caps[k] = v
+	}
+	return c
+}
+
+// Names returns the names of all modules in the registry, sorted in ascending order.
+func (r *ModuleRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.mods))
+	for k := range r.mods {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has reports whether the module with the given name is in the registry.
+func (r *ModuleRegistry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, found := r.mods[name]
+	return found
+}
+
+// Get returns the loader of the module with the given name, or nil if not found.
+func (r *ModuleRegistry) Get(name string) ModuleLoader {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.mods[name].loader
+}
+
+// Capability returns the capability set of the module with the given name; ok is false if not found.
+func (r *ModuleRegistry) Capability(name string) (cap ModuleCapability, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.mods[name]
+	return e.cap, ok
+}
+
+// Doc returns the one-line description of the module with the given name; ok is false if not found.
+func (r *ModuleRegistry) Doc(name string) (doc string, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.mods[name]
+	return e.doc, ok
+}
+
+// LoaderMap returns a map of all modules in the registry.
+func (r *ModuleRegistry) LoaderMap() ModuleLoaderMap {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m := make(ModuleLoaderMap, len(r.mods))
+	for k, v := range r.mods {
+		m[k] = v.loader
+	}
+	return m
+}
+
+// MakeLoaderList creates a list of module loaders from a list of module names.
+// It returns an error as second return value if any module is not found.
+func (r *ModuleRegistry) MakeLoaderList(names ...string) (ModuleLoaderList, error) {
+	ld := make(ModuleLoaderList, len(names))
+	for i, name := range names {
+		ld[i] = r.Get(name)
+		if ld[i] == nil {
+			return ld, errorStarletErrorf(`make`, "module not found: %s", name)
+		}
+	}
+	return ld, nil
+}
+
+// MakeLoaderMap creates a map of module loaders from a list of module names.
+// It returns an error as second return value if any module is not found.
+func (r *ModuleRegistry) MakeLoaderMap(names ...string) (ModuleLoaderMap, error) {
+	ld := make(ModuleLoaderMap, len(names))
+	for _, name := range names {
+		ld[name] = r.Get(name)
+		if ld[name] == nil {
+			return ld, errorStarletErrorf(`make`, "module not found: %s", name)
+		}
+	}
+	return ld, nil
+}
+
+// NamesExcluding returns all module names except the given ones. An unknown name in the exclusion list is an error, because a typo in a denylist must not silently include the module it meant to block.
+func (r *ModuleRegistry) NamesExcluding(excludes ...string) ([]string, error) {
+	ex := make(map[string]bool, len(excludes))
+	for _, e := range excludes {
+		if !r.Has(e) {
+			return nil, fmt.Errorf("unknown builtin module to exclude: %q", e)
+		}
+		ex[e] = true
+	}
+	var names []string
+	for _, n := range r.Names() {
+		if !ex[n] {
+			names = append(names, n)
+		}
+	}
+	return names, nil
+}
+
+// NamesWithoutCapabilities returns the module names whose capability sets share nothing with caps.
+func (r *ModuleRegistry) NamesWithoutCapabilities(caps ModuleCapability) []string {
+	var names []string
+	for _, n := range r.Names() {
+		if c, _ := r.Capability(n); !c.Intersects(caps) {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// NewMachine creates a new Starlark runtime environment with given global variables, preload and lazyload module names of the registry, like NewWithNames does with the default registry.
+// Unlike NewWithNames, it returns an error instead of panicking if any of the given modules is not found. The machine is bound to the registry, see Machine.SetModuleRegistry.
+func (r *ModuleRegistry) NewMachine(globals StringAnyMap, preloads []string, lazyloads []string) (*Machine, error) {
+	pre, err := r.MakeLoaderList(preloads...)
+	if err != nil {
+		return nil, err
+	}
+	lazy, err := r.MakeLoaderMap(lazyloads...)
+	if err != nil {
+		return nil, err
+	}
+	m := NewWithLoaders(globals, pre, lazy)
+	m.preloadNames = append([]string(nil), preloads...)
+	m.registry = r
+	return m, nil
+}
+
+// moduleCapability returns the capability set of a module of the registry or a custom module declared by RegisterCapability.
+func (r *ModuleRegistry) moduleCapability(name string) (ModuleCapability, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if e, ok := r.mods[name]; ok {
+		return e.cap, true
+	}
+	cap, ok := r.caps[name]
+	return cap, ok
+}
+
+// checkPolicy returns a ModuleDeniedError if the module with the given name has any capability in deny.
+func (r *ModuleRegistry) checkPolicy(name string, deny ModuleCapability) error {
+	if deny == CapPure {
+		return nil
+	}
+	if cap, ok := r.moduleCapability(name); ok && cap.Intersects(deny) {
+		return ModuleDeniedError{Name: name, Capability: cap & deny}
+	}
+	return nil
+}
+
+// orDefault returns the registry itself, or the default registry if it's nil.
+func (r *ModuleRegistry) orDefault() *ModuleRegistry {
+	if r == nil {
+		return defaultRegistry
+	}
+	return r
+}
@@ -0,0 +1,243 @@
+package starlet_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/1set/starlet"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+func makeGreetModule() (starlark.StringDict, error) {
+	return starlark.StringDict{
+		"greet": &starlarkstruct.Module{
+			Name: "greet",
+			Members: starlark.StringDict{
+				"hello": starlark.String("hello, world"),
+			},
+		},
+	}, nil
+}
+
+func TestModuleRegistry_Register(t *testing.T) {
+	r := starlet.NewModuleRegistry()
+	if n := r.Names(); len(n) != 0 {
+		t.Errorf("expected an empty registry, got: %v", n)
+	}
+	if err := r.Register("greet", makeGreetModule, starlet.CapPure, "say hello"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	// invalid or duplicate registrations
+	for _, tc := range []struct {
+		name   string
+		loader starlet.ModuleLoader
+		errMsg string
+	}{
+		{"", makeGreetModule, "starlet: register: empty module name"},
+		{"nothing", nil, "starlet: register: nil module loader: nothing"},
+		{"greet", makeGreetModule, "starlet: register: module already registered: greet"},
+	} {
+		err := r.Register(tc.name, tc.loader, starlet.CapNetwork, "")
+		expectErr(t, err, tc.errMsg)
+	}
+
+	if !r.Has("greet") || r.Has("json") {
+		t.Errorf("unexpected Has results")
+	}
+	if c, ok := r.Capability("greet"); !ok || c != starlet.CapPure {
+		t.Errorf("Capability(greet) = %v, %v", c, ok)
+	}
+	if d, ok := r.Doc("greet"); !ok || d != "say hello" {
+		t.Errorf("Doc(greet) = %q, %v", d, ok)
+	}
+	if r.Get("greet") == nil || r.Get("json") != nil {
+		t.Errorf("unexpected Get results")
+	}
+	if _, err := r.MakeLoaderMap("greet", "json"); err == nil {
+		t.Errorf("expected an error for a module not in the registry")
+	}
+}
+
+func TestModuleRegistry_Isolated(t *testing.T) {
+	r := starlet.NewBuiltinModuleRegistry()
+	if got := r.Names(); !reflect.DeepEqual(got, starlet.GetAllBuiltinModuleNames()) {
+		t.Errorf("expected the builtin modules, got: %v", got)
+	}
+	if d, ok := r.Doc("json"); !ok || d == "" {
+		t.Errorf("expected a description of json, got: %q, %v", d, ok)
+	}
+	if err := r.Register("greet", makeGreetModule, starlet.CapPure, "say hello"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	// the default registry and clones are left untouched
+	c := r.Clone()
+	if err := c.Register("extra", makeGreetModule, starlet.CapLog, ""); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if starlet.GetBuiltinModule("greet") != nil {
+		t.Errorf("expected greet not in the default registry")
+	}
+	if r.Has("extra") || !c.Has("greet") {
+		t.Errorf("expected the clone to be isolated")
+	}
+
+	names, err := c.NamesExcluding("extra", "http")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(names) != len(c.Names())-2 {
+		t.Errorf("unexpected names: %v", names)
+	}
+	if _, err := c.NamesExcluding("htpp"); err == nil {
+		t.Errorf("expected an error for an unknown exclusion name")
+	}
+	for _, n := range c.NamesWithoutCapabilities(starlet.CapLog) {
+		if n == "extra" || n == "log" {
+			t.Errorf("module %q must be excluded by its capabilities", n)
+		}
+	}
+}
+
+func TestModuleRegistry_NewMachine(t *testing.T) {
+	r := starlet.NewModuleRegistry()
+	if err := r.Register("greet", makeGreetModule, starlet.CapNetwork, "say hello"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := r.Register("json", starlet.GetBuiltinModule("json"), starlet.CapPure, ""); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := r.NewMachine(nil, []string{"nope"}, nil); err == nil {
+		t.Errorf("expected an error for a module not in the registry")
+	}
+
+	// load a registered module
+	m, err := r.NewMachine(nil, nil, []string{"greet"})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	m.SetScript("test.star", []byte(`load("greet", "hello"); x = hello`), nil)
+	out, err := m.Run()
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if out["x"] != "hello, world" {
+		t.Errorf("unexpected output: %v", out)
+	}
+
+	// a module of the registry not enabled is withheld, and others are not found
+	m, _ = r.NewMachine(nil, []string{"json"}, nil)
+	m.SetScript("test.star", []byte(`load("greet", "hello")`), nil)
+	_, err = m.Run()
+	var wh starlet.ModuleWithheldError
+	if !errors.As(err, &wh) || wh.Name != "greet" {
+		t.Errorf("expected ModuleWithheldError for greet, got: %v", err)
+	}
+	m.SetScript("test.star", []byte(`load("file", "read_string")`), nil)
+	_, err = m.Run()
+	var nf starlet.ModuleNotFoundError
+	if !errors.As(err, &nf) || nf.Name != "file" {
+		t.Errorf("expected ModuleNotFoundError for file, got: %v", err)
+	}
+
+	// the capabilities of the registry drive the policy
+	m, _ = r.NewMachine(nil, []string{"greet"}, nil)
+	m.SetCapabilityPolicy(starlet.CapNetwork)
+	m.SetScript("test.star", []byte(`x = 1`), nil)
+	_, err = m.Run()
+	var de starlet.ModuleDeniedError
+	if !errors.As(err, &de) || de.Name != "greet" || de.Capability != starlet.CapNetwork {
+		t.Errorf("expected ModuleDeniedError for greet, got: %v", err)
+	}
+}
+
+func TestRegisterBuiltinModule(t *testing.T) {
+	// the default registry refuses to replace a builtin module
+	err := starlet.RegisterBuiltinModule("json", makeGreetModule, starlet.CapPure, "")
+	expectErr(t, err, "starlet: register: module already registered: json")
+
+	// nor accepts a capability set conflicting with a declared one
+	if err := starlet.RegisterModuleCapability("reg_builtin_conflict", starlet.CapNetwork); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	err = starlet.RegisterBuiltinModule("reg_builtin_conflict", makeGreetModule, starlet.CapPure, "")
+	if err == nil || !strings.Contains(err.Error(), "already registered with capability network") {
+		t.Errorf("expected a conflict error, got: %v", err)
+	}
+}
+
+func TestModuleRegistry_ClassifyByName(t *testing.T) {
+	// modules built by the same factory are told apart by their names
+	r := starlet.NewModuleRegistry()
+	netmod := starlet.MakeModuleLoaderFromStringDict(starlark.StringDict{"ping": starlark.String("pong")})
+	util := starlet.MakeModuleLoaderFromStringDict(starlark.StringDict{"answer": starlark.MakeInt(42)})
+	if err := r.Register("netmod", netmod, starlet.CapNetwork, ""); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := r.Register("util", util, starlet.CapPure, ""); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	m, err := r.NewMachine(nil, nil, []string{"util", "netmod"})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	m.SetCapabilityPolicy(starlet.CapNetwork)
+	m.SetScript("test.star", []byte(`load("util", "answer"); x = answer`), nil)
+	out, err := m.Run()
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if out["x"] != int64(42) {
+		t.Errorf("unexpected output: %v", out)
+	}
+	m.SetScript("test.star", []byte(`load("netmod", "ping")`), nil)
+	_, err = m.Run()
+	var de starlet.ModuleDeniedError
+	if !errors.As(err, &de) || de.Name != "netmod" {
+		t.Errorf("expected ModuleDeniedError for netmod, got: %v", err)
+	}
+
+	// so are preload modules made by names
+	m, _ = r.NewMachine(nil, []string{"util", "netmod"}, nil)
+	m.SetCapabilityPolicy(starlet.CapNetwork)
+	m.SetScript("test.star", []byte(`x = 1`), nil)
+	_, err = m.Run()
+	if !errors.As(err, &de) || de.Name != "netmod" {
+		t.Errorf("expected ModuleDeniedError for netmod, got: %v", err)
+	}
+}
+
+func TestModuleRegistry_RegisterCapability(t *testing.T) {
+	r := starlet.NewModuleRegistry()
+	if err := r.Register("greet", makeGreetModule, starlet.CapPure, ""); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := r.RegisterCapability("mine", starlet.CapFileSystem); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := r.RegisterCapability("mine", starlet.CapFileSystem); err != nil {
+		t.Errorf("expected no error for the same set, got: %v", err)
+	}
+	expectErr(t, r.RegisterCapability("mine", starlet.CapPure), `starlet: register: module "mine" is already registered with capability filesystem`)
+	expectErr(t, r.RegisterCapability("greet", starlet.CapLog), "starlet: register: cannot register capability of registered module: greet")
+	expectErr(t, r.RegisterCapability("", starlet.CapLog), "starlet: register: empty module name")
+	expectErr(t, r.Register("mine", makeGreetModule, starlet.CapPure, ""), `starlet: register: module "mine" is already registered with capability filesystem`)
+
+	// the declaration stays in the registry and its clones
+	if _, ok := starlet.GetModuleCapability("mine"); ok {
+		t.Errorf("expected mine unclassified in the default registry")
+	}
+	m, _ := r.Clone().NewMachine(nil, nil, nil)
+	m.SetLazyloadModules(starlet.ModuleLoaderMap{"mine": makeGreetModule})
+	m.SetCapabilityPolicy(starlet.CapFileSystem)
+	m.SetScript("test.star", []byte(`load("mine", "greet")`), nil)
+	_, err := m.Run()
+	var de starlet.ModuleDeniedError
+	if !errors.As(err, &de) || de.Name != "mine" || de.Capability != starlet.CapFileSystem {
+		t.Errorf("expected ModuleDeniedError for mine, got: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package starlet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sort"
+	"time"
+)
+
+// ReloadEvent describes the changes found by the hot reload of a Machine, see EnableHotReload.
+type ReloadEvent struct {
+	Script  string   // name of the main script if its content changed, empty otherwise
+	Changed []string // modules loaded from files whose content changed or which disappeared
+	Evicted []string // modules evicted from the load cache: the changed ones and all modules depending on them
+}
+
+// hotReload is the state of the hot reload of a Machine.
+type hotReload struct {
+	interval   time.Duration
+	onReload   func(e ReloadEvent)
+	lastPoll   time.Time
+	scriptName string
+	scriptHash []byte
+}
+
+// EnableHotReload enables the hot reload of the main script and the modules loaded from files by load().
+//
+// It polls the content hash of the files through the filesystems of the machine, so it works with any fs.FS. The poll happens at the start of a run, at most once per interval (zero means every run), before the script is executed: the modules whose files changed are evicted from the load cache along with the modules depending on them, so the run loads them again, and the rest stay cached with the state of the machine intact.
+// If anything changed, onReload is invoked with the changes before the script is executed; like the hooks, it runs while the machine is locked, so it must not call methods of the same Machine that take the lock. It can be nil.
+func (m *Machine) EnableHotReload(interval time.Duration, onReload func(e ReloadEvent)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reload = &hotReload{interval: interval, onReload: onReload}
+}
+
+// DisableHotReload disables the hot reload enabled by EnableHotReload.
+func (m *Machine) DisableHotReload() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reload = nil
+}
+
+// pollHotReload checks the main script and the loaded modules for changes if the hot reload is enabled and due, and applies them.
+// The content of the main script is given if it's read from the script filesystem, nil otherwise.
+func (m *Machine) pollHotReload(scriptName string, script []byte) {
+	r := m.reload
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	if !r.lastPoll.IsZero() && now.Sub(r.lastPoll) < r.interval {
+		return
+	}
+	r.lastPoll = now
+
+	var ev ReloadEvent
+	if script != nil {
+		h := contentHash(script)
+		if r.scriptName == scriptName && r.scriptHash != nil && !bytes.Equal(h, r.scriptHash) {
+			ev.Script = scriptName
+		}
+		r.scriptName, r.scriptHash = scriptName, h
+	}
+	if m.loadCache != nil {
+		ev.Changed, ev.Evicted = m.loadCache.evictChanged()
+	}
+	if (ev.Script != "" || len(ev.Changed) > 0) && r.onReload != nil {
+		r.onReload(ev)
+	}
+}
+
+// evictChanged reads the source files of the loaded modules again, and evicts the modules whose content changed or which disappeared, along with all modules depending on them.
+// It returns the changed modules and all evicted modules, sorted.
+func (c *cache) evictChanged() (changed, evicted []string) {
+	// collect the modules loaded from files
+	c.cacheMu.Lock()
+	files := make(map[string][]byte)
+	for name, e := range c.cache {
+		select {
+		case <-e.ready:
+		default:
+			continue // still loading
+		}
+		if e.hash != nil {
+			files[name] = e.hash
+		}
+	}
+	c.cacheMu.Unlock()
+
+	// read the files without the lock
+	for _, name := range sortedKeys(files) {
+		b, err := c.readFile(name)
+		if err != nil || !bytes.Equal(contentHash(b), files[name]) {
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	// evict the changed modules and their dependents transitively
+	gone := make(map[string]bool)
+	queue := append([]string(nil), changed...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if gone[name] {
+			continue
+		}
+		gone[name] = true
+		for dep := range c.deps[name] {
+			queue = append(queue, dep)
+		}
+	}
+	for name := range gone {
+		if _, ok := c.cache[name]; ok {
+			delete(c.cache, name)
+			evicted = append(evicted, name)
+		}
+		delete(c.deps, name)
+	}
+	sort.Strings(evicted)
+	return changed, evicted
+}
+
+// contentHash returns the hash of the content of a file for change detection.
+func contentHash(b []byte) []byte {
+	h := sha256.Sum256(b)
+	return h[:]
+}
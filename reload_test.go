@@ -0,0 +1,111 @@
+package starlet_test
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/1set/starlet"
+)
+
+func TestMachine_HotReload(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.star": &fstest.MapFile{Data: []byte(`load("a", "va"); load("c", "vc"); x = va + vc`)},
+		"a.star":    &fstest.MapFile{Data: []byte(`load("b", "vb"); va = "a" + vb`)},
+		"b.star":    &fstest.MapFile{Data: []byte(`vb = "b1"`)},
+		"c.star":    &fstest.MapFile{Data: []byte(`vc = "c1"`)},
+	}
+	var (
+		events []starlet.ReloadEvent
+		loads  []string
+	)
+	m := starlet.NewDefault()
+	m.SetScript("main.star", nil, fsys)
+	m.EnableHotReload(0, func(e starlet.ReloadEvent) {
+		events = append(events, e)
+	})
+	m.SetHooks(&starlet.Hooks{OnLoad: func(e starlet.LoadEvent) {
+		if e.Source == starlet.LoadSourceFile {
+			loads = append(loads, e.Module)
+		}
+	}})
+	run := func(want string) {
+		t.Helper()
+		out, err := m.Run()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if out["x"] != want {
+			t.Errorf("expected x = %q, got: %v", want, out["x"])
+		}
+	}
+
+	// nothing changed: no event, nothing executed again
+	run("ab1c1")
+	run("ab1c1")
+	if len(events) != 0 {
+		t.Errorf("expected no events, got: %v", events)
+	}
+	expectStrings(t, "loads", loads, []string{"b", "a", "c"})
+
+	// a change of b evicts b and its dependent a, but not c
+	loads = nil
+	fsys["b.star"] = &fstest.MapFile{Data: []byte(`vb = "b2"`)}
+	run("ab2c1")
+	want := []starlet.ReloadEvent{{Changed: []string{"b"}, Evicted: []string{"a", "b"}}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("expected events %v, got: %v", want, events)
+	}
+	expectStrings(t, "loads", loads, []string{"b", "a"})
+
+	// a change of the main script is reported
+	events = nil
+	fsys["main.star"] = &fstest.MapFile{Data: []byte(`load("a", "va"); x = va`)}
+	run("ab2")
+	want = []starlet.ReloadEvent{{Script: "main.star"}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("expected events %v, got: %v", want, events)
+	}
+
+	// a deleted module is a change as well
+	events = nil
+	delete(fsys, "c.star")
+	run("ab2")
+	want = []starlet.ReloadEvent{{Changed: []string{"c"}, Evicted: []string{"c"}}}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("expected events %v, got: %v", want, events)
+	}
+
+	// no more polling after disabled
+	events = nil
+	m.DisableHotReload()
+	fsys["b.star"] = &fstest.MapFile{Data: []byte(`vb = "b3"`)}
+	run("ab2")
+	if len(events) != 0 {
+		t.Errorf("expected no events, got: %v", events)
+	}
+}
+
+func TestMachine_HotReload_Interval(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.star": &fstest.MapFile{Data: []byte(`load("b", "vb"); x = vb`)},
+		"b.star":    &fstest.MapFile{Data: []byte(`vb = 1`)},
+	}
+	m := starlet.NewDefault()
+	m.SetScript("main.star", nil, fsys)
+	m.EnableHotReload(time.Hour, nil)
+	if _, err := m.Run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// not due yet: the cached module is still used
+	fsys["b.star"] = &fstest.MapFile{Data: []byte(`vb = 2`)}
+	out, err := m.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out["x"] != int64(1) {
+		t.Errorf("expected the cached module, got: %v", out["x"])
+	}
+}
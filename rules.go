@@ -0,0 +1,315 @@
+package starlet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	itn "github.com/1set/starlet/internal"
+	"github.com/1set/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+const (
+	// RulePrefix is the prefix of the names of the top-level functions discovered as rules by naming convention, e.g. rule_min_total is the rule "min_total".
+	RulePrefix = "rule_"
+	// ruleRegistryName is the name of the builtin registering rules in the script of a RuleSet.
+	ruleRegistryName = "rule"
+)
+
+// RuleMode controls when a RuleSet stops evaluating the rules and what makes the set pass.
+type RuleMode uint8
+
+const (
+	// RuleModeAll evaluates all the rules, the set passes if all of them pass.
+	RuleModeAll RuleMode = iota
+	// RuleModeFirstMatch stops at the first rule that passes, the set passes if any rule does.
+	RuleModeFirstMatch
+	// RuleModeAllMustPass stops at the first rule that fails, the set passes if all of them pass.
+	RuleModeAllMustPass
+)
+
+// String returns the name of the mode.
+func (r RuleMode) String() string {
+	switch r {
+	case RuleModeAll:
+		return "all"
+	case RuleModeFirstMatch:
+		return "first_match"
+	case RuleModeAllMustPass:
+		return "all_must_pass"
+	default:
+		return fmt.Sprintf("RuleMode(%d)", uint8(r))
+	}
+}
+
+// Rule describes a rule of a RuleSet.
+type Rule struct {
+	Name     string
+	Tags     []string
+	Timeout  time.Duration // zero for the default of the evaluation
+	MaxSteps uint64        // zero for the default of the evaluation
+	fn       starlark.Callable
+}
+
+// RuleOptions controls an evaluation of a RuleSet.
+type RuleOptions struct {
+	Mode     RuleMode
+	Tags     []string      // only the rules with any of the tags are evaluated, all rules if empty
+	Timeout  time.Duration // per rule without its own timeout, zero means no timeout
+	MaxSteps uint64        // per rule without its own step budget, zero means the step budget of the machine
+}
+
+// RuleResult is the outcome of a rule.
+type RuleResult struct {
+	Name     string
+	Value    interface{}   // the return value, converted like the results of Call
+	Passed   bool          // whether the return value is true in Starlark, false on error
+	Err      error         // the error of the rule, e.g. it fails, times out or exceeds its step budget
+	Duration time.Duration // wall time of the rule
+	Steps    uint64        // steps executed by the rule
+}
+
+// RuleReport is the outcome of an evaluation of a RuleSet.
+type RuleReport struct {
+	Results []RuleResult // in the order of evaluation, the rules skipped by the mode are left out
+	Passed  bool         // whether the set passes by the mode
+	Matched string       // the first rule that passes, for RuleModeFirstMatch
+}
+
+// RuleSet evaluates the rules defined by a script against input documents, for using Starlark as a policy engine.
+//
+// The rules are functions taking the input as the only argument, and the truth of the return value tells whether the rule passes.
+// They're discovered from the script in two ways: top-level functions named with RulePrefix, and the functions registered by the builtin rule(fn, name=fn.name, tags=[], timeout=0, max_steps=0) with the timeout in seconds, which returns the function so it can wrap a definition or a lambda like a decorator, e.g. `check = rule(lambda doc: doc["total"] > 0, name="positive", tags=["order"])`.
+// The registered rules come first in the order of registration, followed by the discovered ones sorted by name, and a function registered is not discovered again.
+type RuleSet struct {
+	_     itn.DoNotCompare
+	m     *Machine
+	rules []*Rule
+}
+
+// NewRuleSet runs the script set on the machine to define the rules, and returns the rule set evaluating them on the machine.
+// The machine should not be run or called by others while the rule set is in use. It fails if the script fails, or no rule is defined.
+func NewRuleSet(m *Machine) (*RuleSet, error) {
+	rs := &RuleSet{m: m}
+	sealed := false
+	registered := make(map[starlark.Value]bool)
+	regErr := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%s: "+format, append([]interface{}{ruleRegistryName}, args...)...)
+	}
+	register := starlark.NewBuiltin(ruleRegistryName, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var (
+			fn       starlark.Callable
+			name     string
+			tags     *starlark.List
+			timeout  starlark.Value = starlark.MakeInt(0)
+			maxSteps uint64
+		)
+		if sealed {
+			return nil, regErr("rules can only be registered by the script of the rule set")
+		}
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "fn", &fn, "name?", &name, "tags?", &tags, "timeout?", &timeout, "max_steps?", &maxSteps); err != nil {
+			return nil, err
+		}
+		if name == "" {
+			name = fn.Name()
+		}
+		if name == "lambda" {
+			return nil, regErr("name is required for lambda")
+		}
+		if rs.find(name) != nil {
+			return nil, regErr("duplicate rule: %s", name)
+		}
+		secs, ok := starlark.AsFloat(timeout)
+		if !ok || secs < 0 {
+			return nil, regErr("invalid timeout: %s", timeout)
+		}
+		r := &Rule{Name: name, Timeout: time.Duration(secs * float64(time.Second)), MaxSteps: maxSteps, fn: fn}
+		if tags != nil {
+			for i := 0; i < tags.Len(); i++ {
+				s, ok := starlark.AsString(tags.Index(i))
+				if !ok {
+					return nil, regErr("tags must be strings, got %s", tags.Index(i).Type())
+				}
+				r.Tags = append(r.Tags, s)
+			}
+		}
+		rs.rules = append(rs.rules, r)
+		registered[fn] = true
+		return fn, nil
+	})
+	_, err := m.RunWithContext(context.Background(), StringAnyMap{ruleRegistryName: register})
+	sealed = true
+	if err != nil {
+		return nil, err
+	}
+
+	// discover the rules by naming convention
+	m.mu.RLock()
+	for _, name := range m.predeclared.Keys() {
+		fn, ok := m.predeclared[name].(*starlark.Function)
+		if !ok || !strings.HasPrefix(name, RulePrefix) || registered[fn] {
+			continue
+		}
+		r := &Rule{Name: strings.TrimPrefix(name, RulePrefix), fn: fn}
+		if rs.find(r.Name) != nil {
+			m.mu.RUnlock()
+			return nil, errorStarletErrorf("rule", "duplicate rule: %s", r.Name)
+		}
+		rs.rules = append(rs.rules, r)
+	}
+	m.mu.RUnlock()
+
+	if len(rs.rules) == 0 {
+		return nil, errorStarletErrorf("rule", "no rules defined")
+	}
+	return rs, nil
+}
+
+// find returns the rule of the name, or nil if not found.
+func (rs *RuleSet) find(name string) *Rule {
+	for _, r := range rs.rules {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// Rules returns the rules in the order of evaluation.
+func (rs *RuleSet) Rules() []Rule {
+	rules := make([]Rule, 0, len(rs.rules))
+	for _, r := range rs.rules {
+		c := *r
+		c.Tags = append([]string(nil), r.Tags...)
+		c.fn = nil
+		rules = append(rules, c)
+	}
+	return rules
+}
+
+// Evaluate evaluates the rules selected by the tags against the input, converted like the arguments of Call, and returns the report.
+// Each rule runs with its own timeout and step budget, or the defaults of the options, and the machine's print and resource limits; its errors are reported in its result without stopping the others, unless the mode says so.
+// The input is shared by the rules, so they should not modify it. It fails only if the machine is reset, the input cannot be converted, or ctx is done, with the results so far.
+func (rs *RuleSet) Evaluate(ctx context.Context, input interface{}, opts RuleOptions) (*RuleReport, error) {
+	m := rs.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.thread == nil {
+		return nil, errorStarletErrorf("rule", "no rules loaded, the machine is reset")
+	}
+	in, err := convert.ToValueWithTag(input, m.customTag)
+	if err != nil {
+		return nil, errorStarlightConvert("input", err)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	report := &RuleReport{Passed: opts.Mode != RuleModeFirstMatch}
+	for _, r := range rs.rules {
+		if !r.hasAnyTag(opts.Tags) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return report, errorStarletError("rule", err)
+		}
+		res := rs.evalRule(ctx, r, in, opts)
+		report.Results = append(report.Results, res)
+
+		switch opts.Mode {
+		case RuleModeFirstMatch:
+			if res.Passed {
+				report.Passed = true
+				report.Matched = r.Name
+				return report, nil
+			}
+		case RuleModeAllMustPass:
+			if !res.Passed {
+				report.Passed = false
+				return report, nil
+			}
+		default:
+			report.Passed = report.Passed && res.Passed
+		}
+	}
+	return report, nil
+}
+
+// hasAnyTag reports whether the rule has any of the tags, or true if no tags are given.
+func (r *Rule) hasAnyTag(tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, t := range tags {
+		for _, rt := range r.Tags {
+			if t == rt {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// evalRule calls the rule with the input on the thread of the machine, which is locked by the caller.
+func (rs *RuleSet) evalRule(ctx context.Context, r *Rule, in starlark.Value, opts RuleOptions) (res RuleResult) {
+	m := rs.m
+	res.Name = r.Name
+	start := time.Now()
+	defer func() {
+		if rv := recover(); rv != nil {
+			res.Err = errorRecovered("rule", rv)
+		}
+		if res.Err != nil {
+			res.Passed = false
+		}
+		res.Duration = time.Since(start)
+		if m.thread != nil {
+			res.Steps = m.thread.Steps
+		}
+	}()
+
+	// arm the limits of the rule
+	timeout, steps := r.Timeout, r.MaxSteps
+	if timeout == 0 {
+		timeout = opts.Timeout
+	}
+	if steps == 0 {
+		steps = opts.MaxSteps
+	}
+	if steps == 0 {
+		steps = m.maxSteps
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	m.thread.Uncancel()
+	m.applyStepLimit(steps)
+	m.resetPrintOutput()
+	m.applyResourceLimits(m.thread)
+	m.thread.SetLocal("context", ctx)
+	stop := m.watchContextCancel(ctx)
+	defer stop()
+
+	v, err := starlark.Call(m.thread, r.fn, starlark.Tuple{in}, nil)
+	if err != nil && timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		res.Err = errorStarletErrorf("rule", "%w after %v", ctx.Err(), timeout)
+		return res
+	}
+	if err != nil {
+		res.Err = m.annotateError(errorStarlarkError("rule", err))
+		return res
+	}
+	res.Passed = bool(v.Truth())
+	if m.enableOutConv {
+		res.Value = convert.FromValue(v)
+	} else {
+		res.Value = v
+	}
+	return res
+}
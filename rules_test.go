@@ -0,0 +1,248 @@
+package starlet_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/1set/starlet"
+)
+
+const ruleScript = `
+def rule_positive(doc):
+    return doc["total"] > 0
+
+def rule_gold(doc):
+    return doc["tier"] == "gold"
+
+def _big(doc):
+    return doc["total"] > 100
+
+big = rule(_big, name="big", tags=["order"])
+rule(lambda doc: doc["total"] < 1000, name="sane", tags=["order", "limit"])
+
+def spin(doc):
+    n = 0
+    for i in range(1000000):
+        n += i
+    return True
+
+rule(spin, timeout=0.05, tags=["slow"])
+rule(spin, name="costly", max_steps=100, tags=["slow"])
+
+def rule_broken(doc):
+    return doc["missing"]
+`
+
+func newRuleSet(t *testing.T) *starlet.RuleSet {
+	t.Helper()
+	m := starlet.NewDefault()
+	m.SetScript("rules.star", []byte(ruleScript), nil)
+	rs, err := starlet.NewRuleSet(m)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return rs
+}
+
+func ruleNames(rs []starlet.RuleResult) []string {
+	var names []string
+	for _, r := range rs {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func TestNewRuleSet(t *testing.T) {
+	rs := newRuleSet(t)
+	var names []string
+	for _, r := range rs.Rules() {
+		names = append(names, r.Name)
+	}
+	want := []string{"big", "sane", "spin", "costly", "broken", "gold", "positive"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("expected rules %v, got: %v", want, names)
+	}
+	rules := rs.Rules()
+	if r := rules[2]; r.Timeout != 50*time.Millisecond || !reflect.DeepEqual(r.Tags, []string{"slow"}) {
+		t.Errorf("unexpected rule: %+v", r)
+	}
+	if r := rules[3]; r.MaxSteps != 100 || r.Timeout != 0 {
+		t.Errorf("unexpected rule: %+v", r)
+	}
+
+	// invalid scripts
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{
+			name:    "no rules",
+			script:  `def check(doc): return True`,
+			wantErr: "starlet: rule: no rules defined",
+		},
+		{
+			name:    "lambda without name",
+			script:  `rule(lambda doc: True)`,
+			wantErr: "starlark: exec: rule: name is required for lambda",
+		},
+		{
+			name:    "duplicate",
+			script:  "def rule_a(doc): return True\nrule(rule_a)\nrule(rule_a)",
+			wantErr: "starlark: exec: rule: duplicate rule: rule_a",
+		},
+		{
+			name:    "duplicate by convention",
+			script:  "def rule_a(doc): return True\ndef a(doc): return True\nrule(a)",
+			wantErr: "starlet: rule: duplicate rule: a",
+		},
+		{
+			name:    "invalid timeout",
+			script:  "def a(doc): return True\nrule(a, timeout=-1)",
+			wantErr: "starlark: exec: rule: invalid timeout: -1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := starlet.NewDefault()
+			m.SetScript("rules.star", []byte(tt.script), nil)
+			_, err := starlet.NewRuleSet(m)
+			expectErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRuleSet_Evaluate(t *testing.T) {
+	rs := newRuleSet(t)
+	doc := map[string]interface{}{"total": 120, "tier": "silver"}
+
+	// all rules, with errors, timeouts and step budgets per rule
+	rep, err := rs.Evaluate(context.Background(), doc, starlet.RuleOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rep.Passed || rep.Matched != "" || len(rep.Results) != 7 {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+	passed := map[string]bool{}
+	for _, r := range rep.Results {
+		passed[r.Name] = r.Passed
+		if r.Duration <= 0 {
+			t.Errorf("expected duration of rule %s", r.Name)
+		}
+	}
+	if want := map[string]bool{"big": true, "sane": true, "spin": false, "costly": false, "broken": false, "gold": false, "positive": true}; !reflect.DeepEqual(passed, want) {
+		t.Errorf("expected %v, got: %v", want, passed)
+	}
+	res := rep.Results
+	if res[0].Value != true || res[0].Err != nil || res[0].Steps == 0 {
+		t.Errorf("unexpected result: %+v", res[0])
+	}
+	expectErr(t, res[2].Err, "starlet: rule: context deadline exceeded after 50ms")
+	if !errors.Is(res[2].Err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got: %v", res[2].Err)
+	}
+	var se starlet.MaxStepsExceededError
+	if !errors.As(res[3].Err, &se) || se.Limit != 100 {
+		t.Errorf("expected step budget exceeded, got: %v", res[3].Err)
+	}
+	expectErr(t, res[4].Err, `starlark: rule: key "missing" not in`)
+
+	// tagged subset, and the default budget of the options
+	rep, err = rs.Evaluate(context.Background(), doc, starlet.RuleOptions{Tags: []string{"limit", "slow"}, MaxSteps: 50})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if names := ruleNames(rep.Results); !reflect.DeepEqual(names, []string{"sane", "spin", "costly"}) {
+		t.Errorf("unexpected rules: %v", names)
+	}
+	if !errors.As(rep.Results[1].Err, &se) || se.Limit != 50 {
+		t.Errorf("expected step budget of options exceeded, got: %v", rep.Results[1].Err)
+	}
+}
+
+func TestRuleSet_Evaluate_Modes(t *testing.T) {
+	rs := newRuleSet(t)
+	tests := []struct {
+		name    string
+		doc     map[string]interface{}
+		mode    starlet.RuleMode
+		tags    []string
+		passed  bool
+		matched string
+		rules   []string
+	}{
+		{
+			name:    "first match",
+			doc:     map[string]interface{}{"total": 50, "tier": "gold"},
+			mode:    starlet.RuleModeFirstMatch,
+			passed:  true,
+			matched: "sane",
+			rules:   []string{"big", "sane"},
+		},
+		{
+			name:  "no match",
+			doc:   map[string]interface{}{"total": 5000, "tier": "gold"},
+			mode:  starlet.RuleModeFirstMatch,
+			tags:  []string{"limit"},
+			rules: []string{"sane"},
+		},
+		{
+			name:  "all must pass fails",
+			doc:   map[string]interface{}{"total": 50, "tier": "gold"},
+			mode:  starlet.RuleModeAllMustPass,
+			rules: []string{"big"},
+		},
+		{
+			name:   "all must pass",
+			doc:    map[string]interface{}{"total": 500, "tier": "gold"},
+			mode:   starlet.RuleModeAllMustPass,
+			tags:   []string{"order"},
+			passed: true,
+			rules:  []string{"big", "sane"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rep, err := rs.Evaluate(context.Background(), tt.doc, starlet.RuleOptions{Mode: tt.mode, Tags: tt.tags})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rep.Passed != tt.passed || rep.Matched != tt.matched {
+				t.Errorf("expected passed=%v matched=%q, got: %v %q", tt.passed, tt.matched, rep.Passed, rep.Matched)
+			}
+			if names := ruleNames(rep.Results); !reflect.DeepEqual(names, tt.rules) {
+				t.Errorf("expected rules %v, got: %v", tt.rules, names)
+			}
+		})
+	}
+
+	// a done context stops the evaluation
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rep, err := rs.Evaluate(ctx, map[string]interface{}{}, starlet.RuleOptions{})
+	if !errors.Is(err, context.Canceled) || rep == nil || len(rep.Results) != 0 {
+		t.Errorf("expected context canceled and empty report, got: %v, %v", rep, err)
+	}
+
+	// the registry is sealed after the script
+	m := starlet.NewDefault()
+	m.SetScript("rules.star", []byte("def rule_late(doc):\n    return rule(rule_late)\n"), nil)
+	rs, err = starlet.NewRuleSet(m)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rep, _ = rs.Evaluate(context.Background(), nil, starlet.RuleOptions{})
+	expectErr(t, rep.Results[0].Err, "starlark: rule: rule: rules can only be registered by the script of the rule set")
+
+	// the rules are gone with a reset
+	m.Reset()
+	rep, err = rs.Evaluate(context.Background(), nil, starlet.RuleOptions{})
+	expectErr(t, err, "starlet: rule: no rules loaded, the machine is reset")
+	if rep != nil {
+		t.Errorf("expected no report, got: %+v", rep)
+	}
+}
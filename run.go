@@ -9,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/1set/starlet/dataconv"
 	"github.com/1set/starlet/lib/goidiomatic"
 	"github.com/1set/starlight/convert"
 	"go.starlark.net/starlark"
@@ -148,50 +149,29 @@ func (m *Machine) watchLoadThread(thread *starlark.Thread) (stop func()) {
 }
 
 func (m *Machine) runInternal(ctx context.Context, extras StringAnyMap, allowCache bool) (out StringAnyMap, err error) {
+	var finish func()
 	defer func() {
 		if r := recover(); r != nil {
-			if me, ok := r.(MaxStepsExceededError); ok {
-				err = errorStarlarkError("exec", me)
-			} else {
-				err = errorStarlarkPanic("exec", r)
-			}
+			err = errorRecovered("exec", r)
+		}
+		// report the final error, including the recovered one
+		if finish != nil {
+			finish()
 		}
 	}()
 
 	// either script content or name and FS must be set
-	var (
-		scriptName = m.scriptName
-		source     interface{}
-	)
-	if m.scriptContent != nil {
-		if scriptName == "" {
-			// for default name, and disable cache to avoid conflict
-			scriptName = "eval.star"
-			allowCache = false
-		}
-		source = m.scriptContent
-	} else if m.scriptFS != nil {
-		if scriptName == "" {
-			// if no name, cannot load
-			return nil, errorStarletErrorf("run", "no script name")
-		}
-		// load the script content from FS, so that the program cache can
-		// key on the content (passing the open reader through degraded the
-		// cache key to the bare filename, letting different files with the
-		// same name hit each other's compiled program) — and the file
-		// handle was never closed
-		rd, e := m.scriptFS.Open(scriptName)
-		if e != nil {
-			return nil, errorStarletError("run", e)
-		}
-		b, e := io.ReadAll(rd)
-		_ = rd.Close()
-		if e != nil {
-			return nil, errorStarletError("run", e)
-		}
-		source = b
-	} else {
-		return nil, errorStarletErrorf("run", "no script to execute")
+	scriptName, source, fromFS, err := m.readScript("run")
+	if err != nil {
+		return nil, err
+	}
+	if m.scriptContent != nil && m.scriptName == "" {
+		// disable cache for the default name to avoid conflict
+		allowCache = false
+	}
+	var fileScript []byte // content read from the script filesystem, for the hot reload
+	if fromFS {
+		fileScript = source
 	}
 
 	// prepare thread
@@ -199,6 +179,12 @@ func (m *Machine) runInternal(ctx context.Context, extras StringAnyMap, allowCac
 		return nil, err
 	}
 
+	// apply changes of the script and loaded modules if hot reload is on
+	m.pollHotReload(scriptName, fileScript)
+
+	// collect the effects of this run only in the dry-run mode
+	m.resetDryRun()
+
 	// cancel thread when context cancelled
 	if ctx == nil {
 		// no context given: use an inert placeholder
@@ -217,15 +203,28 @@ func (m *Machine) runInternal(ctx context.Context, extras StringAnyMap, allowCac
 
 	// run with everything prepared
 	m.runTimes++
+	m.hookRunStart(scriptName)
+	start := time.Now()
+	finish = func() { m.hookRunFinish(scriptName, start, err) }
 	res, err := m.execStarlarkFile(scriptName, source, allowCache)
+	err = hintUndefined(err, m.predeclared)
 	stop()
 
 	// merge result as predeclared for next run
+	if m.frozenBound == nil && len(res) > 0 {
+		m.frozenBound = make(starlark.StringDict, len(res))
+	}
 	for k, v := range res {
 		m.predeclared[k] = v
+		m.frozenBound[k] = v
 	}
 
-	// handle result and convert
+	// handle result and convert, unless it's too large
+	if err == nil {
+		if le := m.checkOutputSize(res); le != nil {
+			return nil, errorStarletError("output", le)
+		}
+	}
 	out = m.convertOutput(res)
 	if err != nil {
 		// for exit code
@@ -243,14 +242,48 @@ func (m *Machine) runInternal(ctx context.Context, extras StringAnyMap, allowCac
 				err = errorStarletErrorf("run", "exit code: %d", exitCode)
 			}
 		} else {
-			// wrap starlark errors
-			err = errorStarlarkError("exec", err)
+			// wrap starlark errors, with the failing source line
+			err = m.annotateError(errorStarlarkError("exec", err))
 		}
 		return out, err
 	}
 	return out, nil
 }
 
+// readScript returns the name and content of the script to execute, and whether the content is read from the script filesystem.
+// A script content without name is named "eval.star".
+func (m *Machine) readScript(action string) (name string, src []byte, fromFS bool, err error) {
+	name = m.scriptName
+	if m.scriptContent != nil {
+		if name == "" {
+			// for default name
+			name = "eval.star"
+		}
+		return name, m.scriptContent, false, nil
+	} else if m.scriptFS != nil {
+		if name == "" {
+			// if no name, cannot load
+			return "", nil, false, errorStarletErrorf(action, "no script name")
+		}
+		// load the script content from FS, so that the program cache can
+		// key on the content (passing the open reader through degraded the
+		// cache key to the bare filename, letting different files with the
+		// same name hit each other's compiled program) — and the file
+		// handle was never closed
+		rd, e := m.scriptFS.Open(name)
+		if e != nil {
+			return "", nil, false, errorStarletError(action, e)
+		}
+		b, e := io.ReadAll(rd)
+		_ = rd.Close()
+		if e != nil {
+			return "", nil, false, errorStarletError(action, e)
+		}
+		return name, b, true, nil
+	}
+	return "", nil, false, errorStarletErrorf(action, "no script to execute")
+}
+
 // prepareThread prepares the thread for execution, including preset globals, preload modules and extras.
 func (m *Machine) prepareThread(extras StringAnyMap) (err error) {
 	mergeExtra := func() error {
@@ -264,6 +297,7 @@ func (m *Machine) prepareThread(extras StringAnyMap) (err error) {
 			return errorStarlightConvert("extras", err)
 		}
 		// merge extras
+		m.bindDict(esd, nil)
 		for k, v := range esd {
 			m.predeclared[k] = v
 		}
@@ -278,9 +312,15 @@ func (m *Machine) prepareThread(extras StringAnyMap) (err error) {
 		if m.predeclared, err = m.convertInput(m.globals); err != nil {
 			return errorStarlightConvert("globals", err)
 		}
-		if err = m.preloadMods.LoadAll(m.predeclared); err != nil {
+		origin := make(map[string]string)
+		if err = m.preloadMods.loadAll(m.predeclared, m.preloadNames, m.registry.orDefault(), m.capDeny, origin); err != nil {
 			return errorStarletError("preload", err)
 		}
+		m.bindDict(m.predeclared, origin)
+		m.hostBound = make(starlark.StringDict, len(m.predeclared))
+		for k, v := range m.predeclared {
+			m.hostBound[k] = v
+		}
 
 		// merge extras into predeclared
 		if err = mergeExtra(); err != nil {
@@ -291,19 +331,25 @@ func (m *Machine) prepareThread(extras StringAnyMap) (err error) {
 		m.loadCache = &cache{
 			cache:    make(map[string]*entry),
 			execOpts: m.getFileOptions(),
-			loadMod:  m.lazyloadMods.GetLazyLoader(),
+			loadMod:  m.bindLoader(),
 			readFile: func(name string) ([]byte, error) {
-				return readScriptFile(name, m.scriptFS)
+				return readScriptFile(name, m.getLoadFS())
 			},
+			resolve:     m.resolveLoadName,
 			globals:     m.predeclared,
 			newThread:   m.newLoadThread,
 			watchCancel: m.watchLoadThread,
+			progCache:   m.progCache,
+			onLoad:      m.hookLoad,
+			deny:        m.capDeny,
+			registry:    m.registry,
+			missing:     m.missingModuleError,
 		}
 		m.thread = &starlark.Thread{
 			Name:  "starlet",
-			Print: m.printFunc,
+			Print: m.getPrintFunc(),
 			Load: func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
-				return m.loadCache.Load(module)
+				return m.loadCache.LoadFrom(thread, module)
 			},
 		}
 	} else {
@@ -315,30 +361,52 @@ func (m *Machine) prepareThread(extras StringAnyMap) (err error) {
 		}
 
 		// set globals for cache
-		m.loadCache.loadMod = m.lazyloadMods.GetLazyLoader()
+		m.loadCache.loadMod = m.bindLoader()
 		m.loadCache.globals = m.predeclared
+		m.loadCache.progCache = m.progCache
+		m.loadCache.deny = m.capDeny
+		m.loadCache.registry = m.registry
 
 		// reset for each run
-		m.thread.Print = m.printFunc
+		m.thread.Print = m.getPrintFunc()
 		m.thread.Uncancel()
 	}
 
-	// arm the per-run step budget
+	// arm the per-run step budget, print and resource limits, and the deterministic mode
 	m.applyStepBudget()
+	m.resetPrintOutput()
+	m.applyResourceLimits(m.thread)
+	m.applyDeterminism()
 	return nil
 }
 
+// bindDict wraps the builtins bound by the host in the dict with the layers observing or replacing their calls: the audit, dry-run, trace and hooks, from the innermost.
+// A member is classified by the module it comes from in origin, or by its own name as a module.
+func (m *Machine) bindDict(d starlark.StringDict, origin map[string]string) {
+	m.auditDict(d, origin)
+	m.dryRunDict(d, origin)
+	m.traceDict(d, origin)
+	m.instrumentDict(d)
+}
+
+// bindLoader returns the lazy loader of the machine, with the builtins of the loaded modules wrapped like bindDict.
+func (m *Machine) bindLoader() NamedModuleLoader {
+	ld := m.lazyloadMods.lazyLoader(m.registry.orDefault(), m.capDeny)
+	return m.instrumentLoader(m.traceLoader(m.dryRunLoader(m.auditLoader(ld))))
+}
+
 // newLoadThread builds the thread that runs a module executed by load(),
 // mirroring the main thread's execution context: the same print func, an
 // independent copy of the step budget (so a loaded module's work is bounded
-// by the DoS guard instead of escaping it), and the current run's context
-// local. The step budget is per-thread, not a shared aggregate counter, so a
-// loaded module gets its own MaxSteps allowance — enough to stop a runaway
-// loop, which is the DoS the bare thread let through.
+// by the DoS guard instead of escaping it), the current run's context local,
+// the resource limits, and the virtual clock and generator of the
+// deterministic mode. The step budget is per-thread, not a shared aggregate
+// counter, so a loaded module gets its own MaxSteps allowance — enough to
+// stop a runaway loop, which is the DoS the bare thread let through.
 func (m *Machine) newLoadThread(load func(*starlark.Thread, string) (starlark.StringDict, error)) *starlark.Thread {
 	t := &starlark.Thread{
 		Name:  "starlet:load",
-		Print: m.printFunc,
+		Print: m.getPrintFunc(),
 		Load:  load,
 	}
 	limit := m.maxSteps
@@ -352,10 +420,19 @@ func (m *Machine) newLoadThread(load func(*starlark.Thread, string) (starlark.St
 			panic(MaxStepsExceededError{Limit: lim})
 		}
 	}
+	if m.profile != nil {
+		m.profile.attach(t, limit)
+	}
+	m.applyResourceLimits(t)
 	if m.thread != nil {
 		if ctx := m.thread.Local("context"); ctx != nil {
 			t.SetLocal("context", ctx)
 		}
+		// share the virtual clock and generator, so the modules continue the sequence of the run
+		if m.determ != nil {
+			dataconv.SetThreadClock(t, dataconv.GetThreadClock(m.thread))
+			dataconv.SetThreadRandReader(t, dataconv.GetThreadRandReader(m.thread))
+		}
 	}
 	return t
 }
@@ -366,12 +443,17 @@ func (m *Machine) newLoadThread(load func(*starlark.Thread, string) (starlark.St
 // MaxUint64 happens here for reused threads; the step counter resets so
 // the budget applies per execution.
 func (m *Machine) applyStepBudget() {
-	limit := m.maxSteps
+	m.applyStepLimit(m.maxSteps)
+}
+
+// applyStepLimit arms the thread with the given step budget instead of the configured one, zero means unlimited.
+func (m *Machine) applyStepLimit(steps uint64) {
+	limit := steps
 	if limit == 0 {
 		limit = math.MaxUint64
 	}
 	m.thread.SetMaxExecutionSteps(limit)
-	if lim := m.maxSteps; lim > 0 {
+	if lim := steps; lim > 0 {
 		m.thread.OnMaxSteps = func(*starlark.Thread) {
 			// recovered by the run/call recover and mapped to a typed error
 			panic(MaxStepsExceededError{Limit: lim})
@@ -380,6 +462,9 @@ func (m *Machine) applyStepBudget() {
 		m.thread.OnMaxSteps = nil
 	}
 	m.thread.Steps = 0
+	if m.profile != nil {
+		m.profile.attach(m.thread, limit)
+	}
 }
 
 // Reset resets the machine to initial state before the first run.
@@ -396,6 +481,8 @@ func (m *Machine) Reset() {
 	m.thread = nil
 	m.loadCache = nil
 	m.predeclared = nil
+	m.hostBound = nil
+	m.frozenBound = nil
 }
 
 // convertInput converts a StringAnyMap to a starlark.StringDict, usually for output variable.
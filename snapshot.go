@@ -0,0 +1,209 @@
+package starlet
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/1set/starlet/lib/serial"
+	"go.starlark.net/starlark"
+)
+
+// snapshotVersion is the version of the snapshot layout, Restore rejects snapshots of other versions.
+const snapshotVersion = 1
+
+// machineSnapshot is the persisted form of a Machine's predeclared state.
+type machineSnapshot struct {
+	Version int `json:"version"`
+	// Bound maps names to the names bound by the host (globals and preload modules) holding the same value, they are re-bound by the restoring machine instead of serialized.
+	Bound map[string]string `json:"bound,omitempty"`
+	// Loaded maps names to the module members they were bound to by load(), they are loaded again by the restoring machine.
+	Loaded map[string]snapshotMember `json:"loaded,omitempty"`
+	// Values holds the user-defined values in the lossless envelope of the serial module.
+	Values map[string]json.RawMessage `json:"values,omitempty"`
+}
+
+// snapshotMember locates a member of a module loaded by load().
+type snapshotMember struct {
+	Module string `json:"module"`
+	Member string `json:"member"`
+}
+
+// Snapshot serializes the predeclared state of the machine, i.e. the variables left by previous runs and extras, so that it can be persisted and resumed later by Restore, possibly in another process.
+//
+// User-defined values are serialized with the lossless envelope of the serial module. Names bound by the host globals and preload modules are only recorded and re-bound by the restoring machine, as are names bound to members of modules by load().
+// It fails on functions, builtins and host objects that cannot round-trip, naming the variable, and fails if the machine has never run.
+func (m *Machine) Snapshot() ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.predeclared == nil {
+		return nil, errorStarletErrorf("snapshot", "no state to snapshot, the machine has not run")
+	}
+
+	snap := machineSnapshot{
+		Version: snapshotVersion,
+		Bound:   make(map[string]string),
+		Loaded:  make(map[string]snapshotMember),
+		Values:  make(map[string]json.RawMessage),
+	}
+	for _, name := range m.predeclared.Keys() {
+		v := m.predeclared[name]
+		if hn, ok := m.findHostBound(name, v); ok {
+			snap.Bound[name] = hn
+			continue
+		}
+		if mod, mem, ok := m.loadCache.findMember(v); ok {
+			snap.Loaded[name] = snapshotMember{Module: mod, Member: mem}
+			continue
+		}
+		s, err := serial.Dumps(v)
+		if err != nil {
+			return nil, errorStarletErrorf("snapshot", "variable %q: %v", name, err)
+		}
+		snap.Values[name] = json.RawMessage(s)
+	}
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return nil, errorStarletError("snapshot", err)
+	}
+	return b, nil
+}
+
+// Restore resumes the predeclared state saved by Snapshot. The machine should be configured with the same globals, preload and lazyload modules as the snapshotted one; the restored values take precedence over them, like the results of a previous run.
+//
+// It prepares the machine like the first run does if it has not run yet, and it fails without changing the state if any recorded host-bound name or loaded module member is missing in this machine.
+func (m *Machine) Restore(data []byte) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = errorStarlarkPanic("restore", r)
+		}
+	}()
+
+	var snap machineSnapshot
+	if err = json.Unmarshal(data, &snap); err != nil {
+		return errorStarletError("restore", err)
+	}
+	if snap.Version != snapshotVersion {
+		return errorStarletErrorf("restore", "unsupported snapshot version: %d", snap.Version)
+	}
+
+	// prepare the thread for globals and preload modules
+	if m.thread == nil {
+		if err = m.prepareThread(nil); err != nil {
+			return err
+		}
+	}
+
+	// resolve everything before touching the state
+	restored := make(starlark.StringDict, len(snap.Bound)+len(snap.Loaded)+len(snap.Values))
+	for _, name := range sortedKeys(snap.Bound) {
+		v, ok := m.hostBound[snap.Bound[name]]
+		if !ok {
+			return errorStarletErrorf("restore", "variable %q: %q is not bound by globals or preload modules of this machine", name, snap.Bound[name])
+		}
+		restored[name] = v
+	}
+	for _, name := range sortedKeys(snap.Loaded) {
+		lm := snap.Loaded[name]
+		mod, e := m.loadCache.Load(lm.Module)
+		if e != nil {
+			return errorStarletErrorf("restore", "variable %q: load module %q: %v", name, lm.Module, e)
+		}
+		v, ok := mod[lm.Member]
+		if !ok {
+			return errorStarletErrorf("restore", "variable %q: module %q has no member %q", name, lm.Module, lm.Member)
+		}
+		restored[name] = v
+	}
+	for _, name := range sortedKeys(snap.Values) {
+		v, e := serial.Loads(string(snap.Values[name]))
+		if e != nil {
+			return errorStarletErrorf("restore", "variable %q: %v", name, e)
+		}
+		// values of previous runs are frozen, so are the restored ones
+		v.Freeze()
+		restored[name] = v
+	}
+
+	for k, v := range restored {
+		m.predeclared[k] = v
+	}
+	if m.frozenBound == nil && len(snap.Values) > 0 {
+		m.frozenBound = make(starlark.StringDict, len(snap.Values))
+	}
+	for name := range snap.Values {
+		m.frozenBound[name] = restored[name]
+	}
+	m.loadCache.globals = m.predeclared
+	return nil
+}
+
+// findHostBound looks up the value among the values bound by the host, and returns the name it's bound to, preferring the given name.
+func (m *Machine) findHostBound(name string, v starlark.Value) (string, bool) {
+	if hv, ok := m.hostBound[name]; ok && sameValue(v, hv) {
+		return name, true
+	}
+	for _, hn := range m.hostBound.Keys() {
+		if sameValue(v, m.hostBound[hn]) {
+			return hn, true
+		}
+	}
+	return "", false
+}
+
+// findMember looks up a value among the members of the modules loaded and cached, and returns the module name and member name of it.
+func (c *cache) findMember(v starlark.Value) (module, member string, found bool) {
+	if c == nil {
+		return "", "", false
+	}
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	for _, mod := range sortedKeys(c.cache) {
+		e := c.cache[mod]
+		select {
+		case <-e.ready:
+		default:
+			continue // still loading
+		}
+		if e.err != nil {
+			continue
+		}
+		for _, name := range e.globals.Keys() {
+			if sameValue(e.globals[name], v) {
+				return mod, name, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// sameValue reports whether the two values are the same one, it compares by identity instead of by value, and never panics on uncomparable types.
+func sameValue(a, b starlark.Value) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	if ta != tb || !ta.Comparable() {
+		return false
+	}
+	// scalar values are equal by value, which is not an identity worth re-binding
+	if ta.Kind() != reflect.Ptr {
+		return false
+	}
+	return a == b
+}
+
+// sortedKeys returns the sorted keys of a string-keyed map.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
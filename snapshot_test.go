@@ -0,0 +1,103 @@
+package starlet_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/1set/starlet"
+)
+
+func TestMachine_SnapshotRestore(t *testing.T) {
+	globals := starlet.StringAnyMap{
+		"greet": func(s string) string { return "hi " + s },
+	}
+	newMachine := func() *starlet.Machine {
+		return starlet.NewWithNames(globals, []string{"base64"}, []string{"json"})
+	}
+
+	// run and snapshot
+	m1 := newMachine()
+	_, err := m1.RunScript([]byte(`
+load("json", "encode")
+enc = encode
+n = 1267650600228229401496703205376
+data = {"a": [1, 2.5, b"raw"], 3: (True, None)}
+msg = greet("there")
+codec = base64
+`), nil)
+	if err != nil {
+		t.Fatalf("unexpected run error: %v", err)
+	}
+	snap, err := m1.Snapshot()
+	if err != nil {
+		t.Fatalf("unexpected snapshot error: %v", err)
+	}
+
+	// restore into another machine and continue
+	m2 := newMachine()
+	if err := m2.Restore(snap); err != nil {
+		t.Fatalf("unexpected restore error: %v", err)
+	}
+	res, err := m2.RunScript([]byte(`
+out = enc({"n": n % 1000, "msg": msg})
+raw = data[3][0] and data["a"][2]
+b64 = codec.encode("x")
+hello = greet("again")
+`), nil)
+	if err != nil {
+		t.Fatalf("unexpected run error after restore: %v", err)
+	}
+	if res["out"] != `{"msg":"hi there","n":376}` {
+		t.Errorf("unexpected out: %v", res["out"])
+	}
+	if res["b64"] != "eA==" || res["hello"] != "hi again" {
+		t.Errorf("unexpected results: %v", res)
+	}
+
+	// restored values are frozen like the results of a run
+	if _, err := m2.RunScript([]byte(`data["a"].append(1)`), nil); err == nil {
+		t.Errorf("expected error on mutating frozen value")
+	}
+}
+
+func TestMachine_Snapshot_Errors(t *testing.T) {
+	// never run
+	if _, err := starlet.NewDefault().Snapshot(); err == nil {
+		t.Errorf("expected error for machine without state")
+	}
+
+	// functions cannot round-trip
+	m := starlet.NewDefault()
+	if _, err := m.RunScript([]byte(`def f(): pass`), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err := m.Snapshot()
+	expectErr(t, err, `starlet: snapshot: variable "f": cannot serialize function`)
+
+	// malformed and mismatched snapshots
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"invalid json", `{`, "starlet: restore: unexpected end of JSON input"},
+		{"wrong version", `{"version":9}`, "starlet: restore: unsupported snapshot version: 9"},
+		{"unknown bound", `{"version":1,"bound":{"x":"nope"}}`, `starlet: restore: variable "x": "nope" is not bound`},
+		{"unknown module", `{"version":1,"loaded":{"x":{"module":"nope","member":"y"}}}`, `starlet: restore: variable "x": load module "nope"`},
+		{"unknown member", `{"version":1,"loaded":{"x":{"module":"json","member":"nope"}}}`, `starlet: restore: variable "x": module "json" has no member "nope"`},
+		{"bad value", `{"version":1,"values":{"x":{"$t":"what"}}}`, `starlet: restore: variable "x": unknown type tag`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := starlet.NewWithNames(nil, nil, []string{"json"})
+			err := m.Restore([]byte(tt.data))
+			expectErr(t, err, tt.want)
+			if err != nil && strings.Contains(tt.name, "unknown") {
+				// the state is untouched on failure
+				if _, err := m.RunScript([]byte(`x = 1`), nil); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
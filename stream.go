@@ -0,0 +1,87 @@
+package starlet
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/1set/starlight/convert"
+	"go.starlark.net/starlark"
+)
+
+// emitName is the name of the builtin emitting values in RunStream.
+const emitName = "emit"
+
+// EmitFunc receives a value emitted by the script in RunStream, with the context of the run.
+// It can block to apply back-pressure, and it should return early with the error of ctx once ctx is done. An error fails the emit call, and thus the run unless the script handles it.
+type EmitFunc func(ctx context.Context, value interface{}) error
+
+// RunStream executes a preset script like RunWithContext, and the script streams values to emit as it runs by calling the predeclared builtin emit(value), e.g. for processing many records without accumulating them in memory.
+//
+// The values are converted like the output if the output conversion is enabled, or frozen and passed as they are otherwise, as the receiver may keep them while the script continues.
+// The emit function runs synchronously within the call of emit(), on the thread of the script or the module calling it, so a slow receiver holds the script back; the steps of the script are counted as usual, a blocked emit consumes none, and the run fails once ctx is done.
+// The builtin emit shadows an extra variable of the same name, and it stays in the machine and fails outside RunStream.
+func (m *Machine) RunStream(ctx context.Context, extras StringAnyMap, emit EmitFunc) (StringAnyMap, error) {
+	if emit == nil {
+		return nil, errorStarletErrorf("stream", "nil emit function")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ext := make(StringAnyMap, len(extras)+1)
+	for k, v := range extras {
+		ext[k] = v
+	}
+	ext[emitName] = starlark.NewBuiltin(emitName, m.emitValue)
+
+	m.emit = emit
+	defer func() { m.emit = nil }()
+	return m.runInternal(ctx, ext, true)
+}
+
+// RunStreamChan executes like RunStream, but sends the emitted values to the channel, blocking emit() until the channel accepts the value or ctx is done.
+// It doesn't close the channel.
+func (m *Machine) RunStreamChan(ctx context.Context, extras StringAnyMap, ch chan<- interface{}) (StringAnyMap, error) {
+	if ch == nil {
+		return nil, errorStarletErrorf("stream", "nil channel")
+	}
+	return m.RunStream(ctx, extras, func(ctx context.Context, value interface{}) error {
+		select {
+		case ch <- value:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// emitValue is the builtin emit(value), it passes the value to the emit function of the running RunStream.
+func (m *Machine) emitValue(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var v starlark.Value
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &v); err != nil {
+		return nil, err
+	}
+	if m.emit == nil {
+		return nil, fmt.Errorf("%s: not streaming, use RunStream", b.Name())
+	}
+
+	ctx, ok := thread.Local("context").(context.Context)
+	if !ok || ctx == nil {
+		ctx = context.TODO()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+
+	var out interface{}
+	if m.enableOutConv {
+		out = convert.FromValue(v)
+	} else {
+		v.Freeze()
+		out = v
+	}
+	if err := m.emit(ctx, out); err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	return starlark.None, nil
+}
@@ -0,0 +1,129 @@
+package starlet_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/1set/starlet"
+	"go.starlark.net/starlark"
+)
+
+func TestMachine_RunStream(t *testing.T) {
+	m := starlet.NewDefault()
+	m.SetScript("test.star", []byte(`
+load("lib.star", "header")
+def process(n):
+    for i in range(n):
+        emit({"id": i, "sq": i * i})
+    return n
+total = process(count)
+`), MemFS{"lib.star": "header = 'h'\nemit(header)\n"})
+
+	var got []interface{}
+	out, err := m.RunStream(context.Background(), starlet.StringAnyMap{"count": 3}, func(_ context.Context, v interface{}) error {
+		got = append(got, v)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out["total"] != int64(3) {
+		t.Errorf("unexpected output: %v", out)
+	}
+	want := []interface{}{
+		"h",
+		map[interface{}]interface{}{"id": int64(0), "sq": int64(0)},
+		map[interface{}]interface{}{"id": int64(1), "sq": int64(1)},
+		map[interface{}]interface{}{"id": int64(2), "sq": int64(4)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected emitted %v, got: %v", want, got)
+	}
+
+	// an error of the receiver fails the run
+	errFull := errors.New("sink is full")
+	_, err = m.RunStream(context.Background(), starlet.StringAnyMap{"count": 3}, func(_ context.Context, v interface{}) error {
+		return errFull
+	})
+	expectErr(t, err, "starlark: exec: emit: sink is full")
+	if !errors.Is(err, errFull) {
+		t.Errorf("expected the error of the receiver, got: %v", err)
+	}
+
+	// not streaming in other runs
+	_, err = m.RunScript([]byte(`emit(1)`), nil)
+	expectErr(t, err, "starlark: exec: emit: not streaming, use RunStream")
+
+	_, err = m.RunStream(context.Background(), nil, nil)
+	expectErr(t, err, "starlet: stream: nil emit function")
+}
+
+func TestMachine_RunStream_Raw(t *testing.T) {
+	m := starlet.NewDefault()
+	m.SetOutputConversionEnabled(false)
+	m.SetScript("test.star", []byte(`
+rec = [1]
+emit(rec)
+ok = True
+rec.append(2)
+`), nil)
+	var got []interface{}
+	_, err := m.RunStream(context.Background(), nil, func(_ context.Context, v interface{}) error {
+		got = append(got, v)
+		return nil
+	})
+	expectErr(t, err, "starlark: exec: append: cannot append to frozen list")
+	if l, ok := got[0].(*starlark.List); !ok || l.Len() != 1 {
+		t.Errorf("expected the list emitted as it is, got: %v", got)
+	}
+}
+
+func TestMachine_RunStreamChan(t *testing.T) {
+	m := starlet.NewDefault()
+	m.SetMaxExecutionSteps(100000)
+	m.SetScript("test.star", []byte(`
+def produce():
+    for i in range(1000000):
+        emit(i)
+produce()
+`), nil)
+
+	// the consumer stops after a few values, the blocked producer honours the context
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan interface{})
+	var got []interface{}
+	go func() {
+		for v := range ch {
+			got = append(got, v)
+			if len(got) == 5 {
+				cancel()
+				return
+			}
+		}
+	}()
+	// either emit or the next step sees the cancellation
+	_, err := m.RunStreamChan(ctx, nil, ch)
+	if err == nil || !strings.Contains(err.Error(), "context cancel") {
+		t.Errorf("expected context cancelled, got: %v", err)
+	}
+	if want := []interface{}{int64(0), int64(1), int64(2), int64(3), int64(4)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected received %v, got: %v", want, got)
+	}
+
+	// the step budget applies to a streaming script
+	ch = make(chan interface{}, 100)
+	go func() {
+		for range ch {
+		}
+	}()
+	_, err = m.RunStreamChan(context.Background(), nil, ch)
+	close(ch)
+	var se starlet.MaxStepsExceededError
+	if !errors.As(err, &se) {
+		t.Errorf("expected step budget exceeded, got: %v", err)
+	}
+}
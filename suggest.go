@@ -0,0 +1,131 @@
+package starlet
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	itn "github.com/1set/starlet/internal"
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+)
+
+// starlarkHintPattern matches the messages of Starlark with its own spelling hint, i.e. an unknown attribute, e.g. "module has no .dump field or method (did you mean .dumps?)", an unknown member of a loaded module, or a name undefined but close to a local one.
+var starlarkHintPattern = regexp.MustCompile(`^(?:undefined: \S+|load: name \S+ not found in module \S+|\S+ has no \.\S+ (?:field or method|attribute)) \(did you mean \.?(\S+)\?\)$`)
+
+// Suggestion returns the name suggested for a misspelled global, module member or module in the error, or empty if there is none.
+func (e ExecError) Suggestion() string {
+	return e.suggestion
+}
+
+// suggestedError is an error with a hint of the name suggested for a misspelled one, which becomes the suggestion of the ExecError wrapping it.
+type suggestedError struct {
+	error
+	name string
+}
+
+// Unwrap returns the hinted error.
+func (e suggestedError) Unwrap() error {
+	return e.error
+}
+
+// suggestionOf returns the name suggested in the cause chain of the error: the hint of undefined names, the nearest module of a module found nowhere, or the spelling hint Starlark adds to the evaluation error of an unknown attribute or member.
+func suggestionOf(err error) string {
+	var (
+		sg suggestedError
+		nf ModuleNotFoundError
+		wh ModuleWithheldError
+		ee *starlark.EvalError
+	)
+	switch {
+	case errors.As(err, &sg):
+		return sg.name
+	case errors.As(err, &nf):
+		return nf.DidYouMean
+	case errors.As(err, &wh):
+		return wh.DidYouMean
+	case errors.As(err, &ee):
+		if sm := starlarkHintPattern.FindStringSubmatch(ee.Msg); sm != nil {
+			return sm[1]
+		}
+	}
+	return ""
+}
+
+// hintUndefined adds the nearest predeclared or universal name as a hint to the "undefined" errors of resolving a file.
+// The resolver only suggests the names defined in the file itself, since it can't enumerate the predeclared ones. The first name suggested is kept for Suggestion. Other errors are returned as they are.
+func hintUndefined(err error, predeclared starlark.StringDict) error {
+	el, ok := err.(resolve.ErrorList)
+	if !ok {
+		return err
+	}
+	var (
+		names     []string
+		suggested string
+	)
+	hinted := make(resolve.ErrorList, len(el))
+	for i, e := range el {
+		hinted[i] = e
+		name := strings.TrimPrefix(e.Msg, "undefined: ")
+		if name == e.Msg {
+			continue
+		}
+		if strings.Contains(name, " ") {
+			// hinted by the resolver already
+			if sm := starlarkHintPattern.FindStringSubmatch(e.Msg); sm != nil && suggested == "" {
+				suggested = sm[1]
+			}
+			continue
+		}
+		if names == nil {
+			names = append(predeclared.Keys(), starlark.Universe.Keys()...)
+		}
+		if n := itn.NearestName(name, names); n != "" {
+			hinted[i].Msg = e.Msg + didYouMean(n)
+			if suggested == "" {
+				suggested = n
+			}
+		}
+	}
+	if suggested == "" {
+		return hinted
+	}
+	return suggestedError{error: hinted, name: suggested}
+}
+
+// suggestModule returns the name of a module the machine can load closest to the given name found nowhere, or empty if none is close enough.
+// The candidates are the lazyload modules allowed by the capability policy and the script files next to the named one; the builtin modules not enabled for the machine are withheld, and never suggested.
+func (m *Machine) suggestModule(name string) string {
+	reg := m.registry.orDefault()
+	var names []string
+	for _, n := range m.lazyloadMods.Keys() {
+		if reg.checkPolicy(n, m.capDeny) == nil {
+			names = append(names, n)
+		}
+	}
+	if fsys := m.getLoadFS(); fsys != nil {
+		dir := path.Dir(name)
+		if des, err := fs.ReadDir(fsys, dir); err == nil {
+			for _, de := range des {
+				if fn := de.Name(); !de.IsDir() && strings.HasSuffix(fn, ".star") {
+					fn = strings.TrimSuffix(fn, ".star")
+					if dir != "." {
+						fn = dir + "/" + fn
+					}
+					names = append(names, fn)
+				}
+			}
+		}
+	}
+	return itn.NearestName(name, names)
+}
+
+// missingModuleError returns the typed error for a module found nowhere, with the nearest available name as a suggestion.
+func (m *Machine) missingModuleError(name string) error {
+	if m.registry.orDefault().Has(name) {
+		return ModuleWithheldError{Name: name, DidYouMean: m.suggestModule(name)}
+	}
+	return ModuleNotFoundError{Name: name, DidYouMean: m.suggestModule(name)}
+}
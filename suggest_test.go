@@ -0,0 +1,142 @@
+package starlet_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/1set/starlet"
+)
+
+func TestExecError_Suggestion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/strings.star": &fstest.MapFile{Data: []byte("def title(s):\n    return s.title()\n")},
+	}
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+		want    string
+	}{
+		{
+			name:    "undefined universal",
+			script:  `x = lenn([])`,
+			wantErr: `starlark: exec: test.star:1:5: undefined: lenn (did you mean len?)`,
+			want:    "len",
+		},
+		{
+			name:    "undefined predeclared",
+			script:  `x = greting`,
+			wantErr: `starlark: exec: test.star:1:5: undefined: greting (did you mean greeting?)`,
+			want:    "greeting",
+		},
+		{
+			name:    "undefined local",
+			script:  "def f():\n    value = 1\n    return valeu\n",
+			wantErr: `starlark: exec: test.star:3:12: undefined: valeu (did you mean value?)`,
+			want:    "value",
+		},
+		{
+			name:    "unknown attribute",
+			script:  `s = json.dump({})`,
+			wantErr: `starlark: exec: module has no .dump field or method (did you mean .dumps?)`,
+			want:    "dumps",
+		},
+		{
+			name:    "unknown member",
+			script:  `load("json", "dump")`,
+			wantErr: `starlark: exec: load: name dump not found in module json (did you mean dumps?)`,
+			want:    "dumps",
+		},
+		{
+			name:    "unknown module",
+			script:  `load("jsom", "dumps")`,
+			wantErr: `starlark: exec: cannot load jsom: module "jsom" not found in builtin modules, custom loaders, or the script filesystem (did you mean json?)`,
+			want:    "json",
+		},
+		{
+			name:    "unknown module file",
+			script:  `load("lib/string", "title")`,
+			wantErr: `starlark: exec: cannot load lib/string: module "lib/string" not found in builtin modules, custom loaders, or the script filesystem (did you mean lib/strings?)`,
+			want:    "lib/strings",
+		},
+		{
+			name:    "withheld module",
+			script:  `load("http", "get")`,
+			wantErr: `starlark: exec: cannot load http: module "http" is withheld and not available to this machine`,
+		},
+		{
+			name:    "hint in failure message",
+			script:  `fail("bad (did you mean .foo?)")`,
+			wantErr: `starlark: exec: fail: bad (did you mean .foo?)`,
+		},
+		{
+			name:    "nothing close",
+			script:  `x = something_else`,
+			wantErr: `starlark: exec: test.star:1:5: undefined: something_else`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := starlet.NewWithNames(starlet.StringAnyMap{"greeting": "hi"}, []string{"json"}, []string{"json"})
+			m.SetScript("test.star", []byte(tt.script), fsys)
+			_, err := m.Run()
+			expectErr(t, err, tt.wantErr)
+			var e starlet.ExecError
+			if !errors.As(err, &e) {
+				t.Fatalf("expected ExecError, got: %v", err)
+			}
+			if got := e.Suggestion(); got != tt.want {
+				t.Errorf("expected suggestion %q, got: %q", tt.want, got)
+			}
+			if got := e.Diagnostics().Suggestion; got != tt.want {
+				t.Errorf("expected suggestion %q in diagnostics, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestModuleNotFoundError_DidYouMean(t *testing.T) {
+	fsys := fstest.MapFS{
+		"helper.star": &fstest.MapFile{Data: []byte(`load("jsom", "dumps")`)},
+	}
+	m := starlet.NewWithNames(nil, nil, []string{"json"})
+	m.SetScript("test.star", []byte(`load("helper", "x")`), fsys)
+	_, err := m.Run()
+	var nf starlet.ModuleNotFoundError
+	if !errors.As(err, &nf) {
+		t.Fatalf("expected ModuleNotFoundError, got: %v", err)
+	}
+	if nf != (starlet.ModuleNotFoundError{Name: "jsom", DidYouMean: "json"}) {
+		t.Errorf("unexpected error: %#v", nf)
+	}
+
+	// withheld modules suggest only available ones
+	fsys = fstest.MapFS{
+		"logs.star": &fstest.MapFile{Data: []byte(`n = 1`)},
+	}
+	m = starlet.NewWithNames(nil, nil, []string{"json"})
+	m.SetScript("test.star", []byte(`load("log", "info")`), fsys)
+	_, err = m.Run()
+	var wh starlet.ModuleWithheldError
+	if !errors.As(err, &wh) {
+		t.Fatalf("expected ModuleWithheldError, got: %v", err)
+	}
+	if wh != (starlet.ModuleWithheldError{Name: "log", DidYouMean: "logs"}) {
+		t.Errorf("unexpected error: %#v", wh)
+	}
+
+	// builtin modules not enabled or denied by the policy are not suggested
+	for _, lazy := range [][]string{nil, {"http"}} {
+		m = starlet.NewWithNames(nil, nil, lazy)
+		m.SetCapabilityPolicy(starlet.CapNetwork)
+		m.SetScript("test.star", []byte(`load("htp", "get")`), nil)
+		_, err = m.Run()
+		if !errors.As(err, &nf) {
+			t.Fatalf("expected ModuleNotFoundError, got: %v", err)
+		}
+		if nf != (starlet.ModuleNotFoundError{Name: "htp"}) {
+			t.Errorf("unexpected error with lazyload %v: %#v", lazy, nf)
+		}
+	}
+}
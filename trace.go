@@ -0,0 +1,461 @@
+package starlet
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	libgoid "github.com/1set/starlet/lib/goidiomatic"
+	stdtime "go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// ReplayMismatchError marks a run diverging from the trace it replays, see EnableReplay: the side-effecting builtin called differs from the recorded one in name or arguments, or the trace is exhausted.
+// Detect it with errors.As through the execution error chain.
+type ReplayMismatchError struct {
+	Seq  int    // sequence number of the call in the trace, starting from 1
+	Want string // the recorded call, or empty if the trace is exhausted
+	Got  string // the call made by the run
+}
+
+// Error returns the error message.
+func (e ReplayMismatchError) Error() string {
+	if e.Want == "" {
+		return fmt.Sprintf("replay: call #%d diverged: want end of trace, got %s", e.Seq, e.Got)
+	}
+	return fmt.Sprintf("replay: call #%d diverged: want %s, got %s", e.Seq, e.Want, e.Got)
+}
+
+// tracedCapabilities are the capabilities of the host state a builtin reads or changes, whose calls are recorded and replayed; the builtins only logging run live on replay, so the logs are written again.
+const tracedCapabilities = CapNetwork | CapFileSystem | CapProcess
+
+// untracedModules are the modules whose builtins always run live, since they control the run itself rather than touch the host, e.g. exit and sleep of go_idiomatic, along with its pure helpers.
+var untracedModules = map[string]bool{
+	libgoid.ModuleName: true,
+}
+
+// traceMode tells whether a tracer records or replays.
+type traceMode uint8
+
+const (
+	traceModeRecord traceMode = iota + 1
+	traceModeReplay
+)
+
+// tracer records the calls of side-effecting builtins to a trace, or replays them from one.
+type tracer struct {
+	mu      sync.Mutex
+	mode    traceMode
+	enc     *json.Encoder  // for recording
+	records []*traceRecord // for replaying
+	seq     int            // number of calls recorded or replayed
+}
+
+// traceRecord is a line of a trace file.
+type traceRecord struct {
+	Seq    int         `json:"seq"`
+	Name   string      `json:"name"`
+	Args   string      `json:"args"`
+	Result *traceValue `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	// Live means the result cannot be recorded, so the builtin is called again on replay
+	Live bool `json:"live,omitempty"`
+}
+
+// traceValue is a Starlark value in a trace file, tagged with its type.
+type traceValue struct {
+	Type   string                 `json:"type"`
+	Value  string                 `json:"value,omitempty"`  // scalar types
+	Items  []*traceValue          `json:"items,omitempty"`  // list, tuple and set; keys and values in turn for dict
+	Fields map[string]*traceValue `json:"fields,omitempty"` // struct and module
+	Name   string                 `json:"name,omitempty"`   // struct constructor, module name, or the bound name of a builtin
+}
+
+// EnableRecord starts recording the calls of side-effecting builtins to the trace writer, so a run can be replayed later with EnableReplay.
+//
+// A builtin is side-effecting if the module it comes from is classified with network, filesystem or process capabilities, see ModuleCapability and RegisterModuleCapability; the builtins of pure and logging modules, unclassified globals, and the run control builtins of go_idiomatic like exit and sleep are left alone, so they run live on replay.
+// Each call is written as a line of JSON with its sequence number, name, arguments, and the result or error. A result that cannot be recorded, e.g. a function or a custom type, is marked live, and the builtin is called again on replay. Builtins in a recorded result, like the methods of an HTTP response, are recorded as well.
+// Like the OnBuiltinCall hook, it only takes effect before the first run or after a reset, since the builtins are wrapped when they are bound. It replaces the replay mode if enabled.
+func (m *Machine) EnableRecord(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.trace = &tracer{mode: traceModeRecord, enc: json.NewEncoder(w)}
+}
+
+// EnableReplay starts replaying the calls of side-effecting builtins from the trace written by EnableRecord, instead of calling them.
+//
+// The calls are matched in order by name and arguments: any divergence, including a call beyond the end of the trace, fails the run with a ReplayMismatchError. The trace continues across runs, so enable it again to replay from the start.
+// Like EnableRecord, it only takes effect before the first run or after a reset. It returns an error if the trace is malformed, and replaces the record mode if enabled.
+func (m *Machine) EnableReplay(r io.Reader) error {
+	var records []*traceRecord
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 64<<20)
+	for line := 1; sc.Scan(); line++ {
+		b := sc.Bytes()
+		if len(strings.TrimSpace(string(b))) == 0 {
+			continue
+		}
+		rec := &traceRecord{}
+		if err := json.Unmarshal(b, rec); err != nil {
+			return errorStarletErrorf("replay", "malformed trace at line %d: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return errorStarletError("replay", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.trace = &tracer{mode: traceModeReplay, records: records}
+	return nil
+}
+
+// DisableRecordReplay stops recording or replaying enabled by EnableRecord or EnableReplay, the builtins already bound are called as usual from then on.
+func (m *Machine) DisableRecordReplay() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.trace = nil
+}
+
+// traceDict wraps the side-effecting builtins in the dict for recording or replaying, if enabled.
+// A member is classified by the module it comes from in origin, or by its own name as a module.
+func (m *Machine) traceDict(d starlark.StringDict, origin map[string]string) {
+	if m.trace == nil {
+		return
+	}
+	reg := m.registry.orDefault()
+	for k, v := range d {
+		module := k
+		if o, ok := origin[k]; ok {
+			module = o
+		}
+		if reg.isTraced(module) {
+			d[k] = mapBuiltins(k, v, m.traceBuiltin)
+		}
+	}
+}
+
+// traceLoader wraps the lazy loader so the builtins of the side-effecting modules are recorded or replayed, if enabled.
+func (m *Machine) traceLoader(ld NamedModuleLoader) NamedModuleLoader {
+	if m.trace == nil {
+		return ld
+	}
+	return func(s string) (starlark.StringDict, error) {
+		d, err := ld(s)
+		if err != nil || d == nil {
+			return d, err
+		}
+		if !m.registry.orDefault().isTraced(s) {
+			return d, nil
+		}
+		// copy to keep the dicts owned by the module intact
+		nd := make(starlark.StringDict, len(d))
+		for k, v := range d {
+			nd[k] = mapBuiltins(s+"."+k, v, m.traceBuiltin)
+		}
+		return nd, nil
+	}
+}
+
+// isTraced reports whether the builtins of the module with the given name are recorded and replayed, see tracedCapabilities.
+func (r *ModuleRegistry) isTraced(module string) bool {
+	if untracedModules[module] {
+		return false
+	}
+	cap, ok := r.moduleCapability(module)
+	return ok && cap.Intersects(tracedCapabilities)
+}
+
+// traceBuiltin wraps the builtin bound to the given name to be recorded or replayed, as long as the trace is enabled.
+func (m *Machine) traceBuiltin(name string, b *starlark.Builtin) *starlark.Builtin {
+	w := starlark.NewBuiltin(b.Name(), func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		switch t := m.trace; {
+		case t == nil:
+			return b.CallInternal(thread, args, kwargs)
+		case t.mode == traceModeReplay:
+			return t.replay(thread, name, b, args, kwargs)
+		default:
+			return t.record(thread, name, b, args, kwargs)
+		}
+	})
+	if recv := b.Receiver(); recv != nil {
+		w = w.BindReceiver(recv)
+	}
+	return w
+}
+
+// record calls the builtin, and writes the call with its outcome to the trace.
+func (t *tracer) record(thread *starlark.Thread, name string, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	res, err := b.CallInternal(thread, args, kwargs)
+	rec := &traceRecord{Name: name, Args: traceArgs(args, kwargs)}
+	if err != nil {
+		rec.Error = err.Error()
+	} else if tv, ok := encodeTraceValue(name, res); ok {
+		rec.Result = tv
+		// the builtins in the result have side effects as well
+		res = mapBuiltins(name, res, func(n string, nb *starlark.Builtin) *starlark.Builtin {
+			return t.wrapNested(n, nb)
+		})
+	} else {
+		rec.Live = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	rec.Seq = t.seq
+	if we := t.enc.Encode(rec); we != nil {
+		return nil, fmt.Errorf("record: %w", we)
+	}
+	return res, err
+}
+
+// wrapNested wraps a builtin found in a recorded result to be recorded as well.
+func (t *tracer) wrapNested(name string, b *starlark.Builtin) *starlark.Builtin {
+	w := starlark.NewBuiltin(b.Name(), func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		return t.record(thread, name, b, args, kwargs)
+	})
+	if recv := b.Receiver(); recv != nil {
+		w = w.BindReceiver(recv)
+	}
+	return w
+}
+
+// replay returns the recorded outcome of the next call in the trace, which must be the same call. The builtin is called only if the call is recorded live, and it's nil for builtins in replayed results.
+func (t *tracer) replay(thread *starlark.Thread, name string, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	got := traceCall(name, traceArgs(args, kwargs))
+
+	t.mu.Lock()
+	t.seq++
+	seq := t.seq
+	var rec *traceRecord
+	if seq <= len(t.records) {
+		rec = t.records[seq-1]
+	}
+	t.mu.Unlock()
+
+	switch {
+	case rec == nil:
+		return nil, ReplayMismatchError{Seq: seq, Got: got}
+	case rec.Name != name || traceCall(rec.Name, rec.Args) != got:
+		return nil, ReplayMismatchError{Seq: seq, Want: traceCall(rec.Name, rec.Args), Got: got}
+	case rec.Error != "":
+		return nil, errors.New(rec.Error)
+	case rec.Live:
+		if b == nil {
+			return nil, fmt.Errorf("replay: call #%d cannot be made live: %s", seq, got)
+		}
+		return b.CallInternal(thread, args, kwargs)
+	}
+	return t.decode(rec.Result)
+}
+
+// traceArgs renders the arguments of a call for matching.
+func traceArgs(args starlark.Tuple, kwargs []starlark.Tuple) string {
+	parts := make([]string, 0, len(args)+len(kwargs))
+	for _, a := range args {
+		parts = append(parts, a.String())
+	}
+	for _, kv := range kwargs {
+		k, _ := starlark.AsString(kv[0])
+		parts = append(parts, fmt.Sprintf("%s=%s", k, kv[1].String()))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// traceCall renders a call with its arguments, e.g. `http.get("https://example.com", timeout=5)`.
+func traceCall(name, args string) string {
+	return name + "(" + args + ")"
+}
+
+// encodeTraceValue encodes the value of the given bound name for a trace, it returns false if the value or any value in it cannot be recorded.
+// The name is empty for the elements of containers.
+func encodeTraceValue(name string, v starlark.Value) (*traceValue, bool) {
+	switch t := v.(type) {
+	case starlark.NoneType:
+		return &traceValue{Type: "none"}, true
+	case starlark.Bool:
+		return &traceValue{Type: "bool", Value: strconv.FormatBool(bool(t))}, true
+	case starlark.Int:
+		return &traceValue{Type: "int", Value: t.String()}, true
+	case starlark.Float:
+		return &traceValue{Type: "float", Value: strconv.FormatFloat(float64(t), 'g', -1, 64)}, true
+	case starlark.String:
+		return &traceValue{Type: "string", Value: string(t)}, true
+	case starlark.Bytes:
+		return &traceValue{Type: "bytes", Value: base64.StdEncoding.EncodeToString([]byte(t))}, true
+	case stdtime.Time:
+		return &traceValue{Type: "time", Value: time.Time(t).Format(time.RFC3339Nano)}, true
+	case stdtime.Duration:
+		return &traceValue{Type: "duration", Value: strconv.FormatInt(int64(t), 10)}, true
+	case *starlark.Builtin:
+		// only the ones in structs and modules are wrapped, see record
+		return &traceValue{Type: "builtin", Name: name}, name != ""
+	case *starlark.List, starlark.Tuple, *starlark.Set:
+		tv := &traceValue{Type: v.Type()}
+		iter := starlark.Iterate(v)
+		defer iter.Done()
+		var x starlark.Value
+		for iter.Next(&x) {
+			e, ok := encodeTraceValue("", x)
+			if !ok {
+				return nil, false
+			}
+			tv.Items = append(tv.Items, e)
+		}
+		return tv, true
+	case *starlark.Dict:
+		tv := &traceValue{Type: "dict"}
+		for _, kv := range t.Items() {
+			k, ok1 := encodeTraceValue("", kv[0])
+			v, ok2 := encodeTraceValue("", kv[1])
+			if !ok1 || !ok2 {
+				return nil, false
+			}
+			tv.Items = append(tv.Items, k, v)
+		}
+		return tv, true
+	case *starlarkstruct.Struct:
+		ctor, ok := t.Constructor().(starlark.String)
+		if !ok {
+			return nil, false
+		}
+		sd := make(starlark.StringDict)
+		t.ToStringDict(sd)
+		fields, ok := encodeTraceFields(name, sd)
+		return &traceValue{Type: "struct", Name: string(ctor), Fields: fields}, ok
+	case *starlarkstruct.Module:
+		fields, ok := encodeTraceFields(name, t.Members)
+		return &traceValue{Type: "module", Name: t.Name, Fields: fields}, ok
+	}
+	return nil, false
+}
+
+// encodeTraceFields encodes the members of a struct or module of the given bound name.
+func encodeTraceFields(name string, d starlark.StringDict) (map[string]*traceValue, bool) {
+	fields := make(map[string]*traceValue, len(d))
+	for k, v := range d {
+		e, ok := encodeTraceValue(name+"."+k, v)
+		if !ok {
+			return nil, false
+		}
+		fields[k] = e
+	}
+	return fields, true
+}
+
+// decode decodes a value of the trace, the builtins in it replay their calls from the trace.
+func (t *tracer) decode(tv *traceValue) (starlark.Value, error) {
+	if tv == nil {
+		return nil, errors.New("replay: missing result")
+	}
+	switch tv.Type {
+	case "none":
+		return starlark.None, nil
+	case "bool":
+		return starlark.Bool(tv.Value == "true"), nil
+	case "int":
+		n, ok := new(big.Int).SetString(tv.Value, 10)
+		if !ok {
+			return nil, fmt.Errorf("replay: invalid int: %q", tv.Value)
+		}
+		return starlark.MakeBigInt(n), nil
+	case "float":
+		f, err := strconv.ParseFloat(tv.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("replay: invalid float: %w", err)
+		}
+		return starlark.Float(f), nil
+	case "string":
+		return starlark.String(tv.Value), nil
+	case "bytes":
+		b, err := base64.StdEncoding.DecodeString(tv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("replay: invalid bytes: %w", err)
+		}
+		return starlark.Bytes(b), nil
+	case "time":
+		ts, err := time.Parse(time.RFC3339Nano, tv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("replay: invalid time: %w", err)
+		}
+		return stdtime.Time(ts), nil
+	case "duration":
+		d, err := strconv.ParseInt(tv.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("replay: invalid duration: %w", err)
+		}
+		return stdtime.Duration(d), nil
+	case "builtin":
+		name := tv.Name
+		short := name[strings.LastIndex(name, ".")+1:]
+		return starlark.NewBuiltin(short, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			return t.replay(thread, name, nil, args, kwargs)
+		}), nil
+	case "list", "tuple", "set":
+		items := make([]starlark.Value, 0, len(tv.Items))
+		for _, e := range tv.Items {
+			v, err := t.decode(e)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		switch tv.Type {
+		case "list":
+			return starlark.NewList(items), nil
+		case "tuple":
+			return starlark.Tuple(items), nil
+		}
+		s := starlark.NewSet(len(items))
+		for _, v := range items {
+			if err := s.Insert(v); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case "dict":
+		d := starlark.NewDict(len(tv.Items) / 2)
+		for i := 0; i+1 < len(tv.Items); i += 2 {
+			k, err := t.decode(tv.Items[i])
+			if err != nil {
+				return nil, err
+			}
+			v, err := t.decode(tv.Items[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if err := d.SetKey(k, v); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	case "struct", "module":
+		sd := make(starlark.StringDict, len(tv.Fields))
+		for k, e := range tv.Fields {
+			v, err := t.decode(e)
+			if err != nil {
+				return nil, err
+			}
+			sd[k] = v
+		}
+		if tv.Type == "module" {
+			return &starlarkstruct.Module{Name: tv.Name, Members: sd}, nil
+		}
+		return starlarkstruct.FromStringDict(starlark.String(tv.Name), sd), nil
+	}
+	return nil, fmt.Errorf("replay: unknown value type: %q", tv.Type)
+}
@@ -0,0 +1,217 @@
+package starlet_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/1set/starlet"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// newTraceRegistry returns a registry with a side-effecting module "svc" and a pure module "calc", which count the real calls of their builtins.
+func newTraceRegistry(t *testing.T, calls *int) *starlet.ModuleRegistry {
+	fetch := func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var url string
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "url", &url); err != nil {
+			return nil, err
+		}
+		*calls++
+		if url == "bad" {
+			return nil, errors.New("connection refused")
+		}
+		n := *calls
+		return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"status": starlark.MakeInt(200),
+			"body": starlark.NewBuiltin("body", func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+				*calls++
+				return starlark.String(fmt.Sprintf("%s#%d", url, n)), nil
+			}),
+		}), nil
+	}
+	double := func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var n int
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs, "n", &n); err != nil {
+			return nil, err
+		}
+		*calls++
+		return starlark.MakeInt(n * 2), nil
+	}
+	r := starlet.NewBuiltinModuleRegistry()
+	if err := r.Register("svc", func() (starlark.StringDict, error) {
+		return starlark.StringDict{"svc": &starlarkstruct.Module{Name: "svc", Members: starlark.StringDict{
+			"fetch": starlark.NewBuiltin("svc.fetch", fetch),
+		}}}, nil
+	}, starlet.CapNetwork, "fake service"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("calc", func() (starlark.StringDict, error) {
+		return starlark.StringDict{"calc": &starlarkstruct.Module{Name: "calc", Members: starlark.StringDict{
+			"double": starlark.NewBuiltin("calc.double", double),
+		}}}, nil
+	}, starlet.CapPure, "fake calculator"); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestMachine_RecordReplay(t *testing.T) {
+	var calls int
+	r := newTraceRegistry(t, &calls)
+	newMachine := func(script string) *starlet.Machine {
+		m, err := r.NewMachine(nil, []string{"calc"}, []string{"svc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetScript("test.star", []byte(script), nil)
+		return m
+	}
+	const script = `
+load("svc", "fetch")
+resp = fetch("a")
+out = [resp.status, resp.body(), calc.double(21)]
+`
+
+	// record the side-effecting calls only
+	var trace bytes.Buffer
+	m := newMachine(script)
+	m.EnableRecord(&trace)
+	res, err := m.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []interface{}{int64(200), "a#1", int64(42)}
+	if !reflect.DeepEqual(res["out"], want) {
+		t.Errorf("expected %v, got: %v", want, res["out"])
+	}
+	lines := strings.Split(strings.TrimSpace(trace.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"name":"svc.fetch","args":"\"a\""`) || !strings.Contains(lines[1], `"name":"svc.fetch.body"`) {
+		t.Errorf("unexpected trace:\n%s", trace.String())
+	}
+
+	// replay without calling the side-effecting builtins
+	calls = 0
+	m = newMachine(script)
+	if err := m.EnableReplay(bytes.NewReader(trace.Bytes())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, err = m.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(res["out"], want) {
+		t.Errorf("expected %v, got: %v", want, res["out"])
+	}
+	if calls != 1 {
+		t.Errorf("expected only the pure builtin called, got %d calls", calls)
+	}
+
+	// divergences
+	for _, tc := range []struct {
+		script string
+		want   starlet.ReplayMismatchError
+	}{
+		{
+			script: `load("svc", "fetch"); fetch("b")`,
+			want:   starlet.ReplayMismatchError{Seq: 1, Want: `svc.fetch("a")`, Got: `svc.fetch("b")`},
+		},
+		{
+			script: `load("svc", "fetch"); r = fetch("a"); r.body(); fetch("a")`,
+			want:   starlet.ReplayMismatchError{Seq: 3, Got: `svc.fetch("a")`},
+		},
+	} {
+		m = newMachine(tc.script)
+		if err := m.EnableReplay(bytes.NewReader(trace.Bytes())); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, err = m.Run()
+		var me starlet.ReplayMismatchError
+		if !errors.As(err, &me) {
+			t.Fatalf("expected ReplayMismatchError, got: %v", err)
+		}
+		if me != tc.want {
+			t.Errorf("expected %#v, got: %#v", tc.want, me)
+		}
+	}
+}
+
+func TestMachine_RecordReplay_Error(t *testing.T) {
+	var calls int
+	r := newTraceRegistry(t, &calls)
+	run := func(setup func(m *starlet.Machine)) error {
+		m, err := r.NewMachine(nil, nil, []string{"svc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetScript("test.star", []byte(`load("svc", "fetch"); fetch("bad")`), nil)
+		setup(m)
+		_, err = m.Run()
+		return err
+	}
+
+	var trace bytes.Buffer
+	err := run(func(m *starlet.Machine) { m.EnableRecord(&trace) })
+	expectErr(t, err, "starlark: exec: connection refused")
+
+	calls = 0
+	err = run(func(m *starlet.Machine) {
+		if err := m.EnableReplay(&trace); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	expectErr(t, err, "starlark: exec: connection refused")
+	if calls != 0 {
+		t.Errorf("expected no real calls, got %d", calls)
+	}
+
+	// malformed trace
+	m := starlet.NewDefault()
+	err = m.EnableReplay(strings.NewReader("{\"seq\":1}\nnot json\n"))
+	expectErr(t, err, "starlet: replay: malformed trace at line 2:")
+}
+
+func TestMachine_RecordReplay_Live(t *testing.T) {
+	var calls int
+	r := newTraceRegistry(t, &calls)
+	run := func(setup func(m *starlet.Machine)) (starlet.StringAnyMap, error) {
+		m, err := r.NewMachine(nil, []string{"go_idiomatic"}, []string{"svc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.SetScript("test.star", []byte(`
+load("svc", "fetch")
+status = fetch("a").status
+n = length("abc")
+exit(3)
+`), nil)
+		setup(m)
+		return m.Run()
+	}
+
+	// the builtins of go_idiomatic are not recorded
+	var trace bytes.Buffer
+	out, err := run(func(m *starlet.Machine) { m.EnableRecord(&trace) })
+	expectErr(t, err, "starlet: run: exit code: 3")
+	if lines := strings.Split(strings.TrimSpace(trace.String()), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"name":"svc.fetch"`) {
+		t.Errorf("unexpected trace:\n%s", trace.String())
+	}
+
+	// and run live on replay, so exit still sets the exit code
+	calls = 0
+	out, err = run(func(m *starlet.Machine) {
+		if err := m.EnableReplay(bytes.NewReader(trace.Bytes())); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	expectErr(t, err, "starlet: run: exit code: 3")
+	if out["status"] != int64(200) || out["n"] != int64(3) {
+		t.Errorf("unexpected output: %v", out)
+	}
+	if calls != 0 {
+		t.Errorf("expected no real calls of svc, got %d", calls)
+	}
+}